@@ -2,10 +2,17 @@ import Queue from './Queue';
 import OrderedQueue from './OrderedQueue';
 import { AppointmentsQueue } from './AppointmentsQueue';
 
+// Admins can be given as just an email (keeping their current role, or
+// becoming a TA if they're new) or with a role.
+export type CourseAdmin = string | { email: string; role: string };
+
+export const CourseRoles = ['observer', 'ta', 'head_ta', 'instructor'];
+
 export default class Course {
 	public readonly id: string;
 	public readonly shortName: string;
 	public readonly fullName: string;
+	public readonly timeZone: string;
 
 	public readonly queues: Queue[] = [];
 
@@ -15,6 +22,7 @@ export default class Course {
 		this.id = data['id'];
 		this.shortName = data['short_name'];
 		this.fullName = data['full_name'];
+		this.timeZone = data['time_zone'];
 		this.queues = data['queues'].map((q: any) => {
 			switch (q.type) {
 				case 'ordered': {
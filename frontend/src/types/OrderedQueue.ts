@@ -11,11 +11,20 @@ import g from '../main';
 import ErrorDialog from '@/util/ErrorDialog';
 import EscapeHTML from '@/util/Sanitization';
 
+// A stretch of the day, in minutes since midnight in the queue's time
+// zone, when the queue is open (o) or open for early sign up (p). The end
+// isn't included.
+export interface ScheduleInterval {
+	start: number;
+	end: number;
+	status: string;
+}
+
 export default class OrderedQueue extends Queue {
 	public entries: QueueEntry[] = [];
 	public stack: RemovedQueueEntry[] = [];
 	public open = false;
-	public schedule?: string;
+	public intervals?: ScheduleInterval[];
 
 	public personallyRemovedEntries = new Set<string>();
 
@@ -27,7 +36,7 @@ export default class OrderedQueue extends Queue {
 				(e: any) => new RemovedQueueEntry(e)
 			);
 			this.open = data['open'];
-			this.schedule = data['schedule'];
+			this.intervals = data['intervals'];
 			this.online.forEach((email: string) => {
 				this.entries
 					.filter((e: QueueEntry) => e.email === email)
@@ -150,14 +159,22 @@ export default class OrderedQueue extends Queue {
 				break;
 			}
 			case 'ENTRY_HELPING': {
+				const i = this.entries.findIndex((e) => e.id === data.id);
+				if (i !== -1) {
+					this.entries[i].update(data);
+				}
+
 				if (data.helping) {
+					const helper = data.helping_name || 'A staff member';
 					SendNotification(
 						'You are being helped!',
-						`Please be ready for a staff member to join you!`
+						`${helper} is on the way! Please be ready for them to join you!`
 					);
 					Dialog.alert({
 						title: `You're up!`,
-						message: `A staff member is now coming to help you. Please be ready for them to join!`,
+						message: `${EscapeHTML(
+							helper
+						)} is on the way to help you. Please be ready for them to join!`,
 						type: 'is-success',
 						hasIcon: true,
 					});
@@ -291,82 +308,50 @@ export default class OrderedQueue extends Queue {
 		this.stack = this.stack.filter((e) => e.id !== entryId);
 	}
 
-	public getHalfHour(time: Moment): number {
-		// This represents the half hour with regard to the normal
-		// 48-half-hour schedule, not necessarily the index in the day
-		// (looking at you, daylight savings)
-		return Math.floor(
-			(time
-				.clone()
-				.tz('America/New_York')
-				.hour() *
-				60 +
-				time
-					.clone()
-					.tz('America/New_York')
-					.minute()) /
-				30
-		);
+	public getMinute(time: Moment): number {
+		const t = time.clone().tz(this.timeZone);
+		return t.hour() * 60 + t.minute();
 	}
 
-	public halfHourToTime(halfHour: number): Moment {
-		// We need to calculate the hour manually instead of just using minutes
-		// for daylight savings purposes (if the half hour was usually at 10 AM,
+	public minuteToTime(minute: number): Moment {
+		// We need to calculate the hour manually instead of just adding minutes
+		// for daylight savings purposes (if the minute was usually at 10 AM,
 		// we do not want it to occur at 9 AM or 11 AM)
 		return moment()
-			.tz('America/New_York')
+			.tz(this.timeZone)
 			.startOf('day')
-			.hour(Math.floor(halfHour / 2))
-			.minute((halfHour % 2) * 30)
+			.hour(Math.floor(minute / 60))
+			.minute(minute % 60)
 			.local();
 	}
 
-	public getOpenHalfHours(): number[] {
-		if (this.schedule === undefined) {
-			return [];
-		}
-
-		const open: number[] = [];
-
-		for (let i = 0; i < this.schedule.length; i++) {
-			if (this.schedule.charAt(i) !== 'c') {
-				open.push(i);
-			}
-		}
-
-		return open;
-	}
-
 	public isOpen(time: Moment): boolean {
 		return this.config?.scheduled ? this.scheduledOpen(time) : this.open;
 	}
 
 	public scheduledOpen(time: Moment): boolean {
-		return this.getOpenHalfHours().includes(this.getHalfHour(time));
+		const minute = this.getMinute(time);
+		return (this.intervals || []).some(
+			(i) => i.start <= minute && minute < i.end
+		);
 	}
 
-	public getNextOpenHalfHour(halfHour: number): number {
-		const open = this.getOpenHalfHours();
-		for (let i = 0; i < open.length; i++) {
-			if (open[i] > halfHour) {
-				return open[i];
-			}
-		}
-
-		return -1;
+	public getNextOpenMinute(minute: number): number {
+		const next = (this.intervals || []).find((i) => i.start > minute);
+		return next === undefined ? -1 : next.start;
 	}
 
-	public getNextCloseTime(halfHour: number): number {
-		const open = this.getOpenHalfHours();
-		const restOfDay = open.slice(open.indexOf(halfHour));
-
-		for (let i = 1; i < restOfDay.length; i++) {
-			if (restOfDay[i] - 1 > restOfDay[i - 1]) {
-				return restOfDay[i - 1] + 1;
+	public getNextCloseTime(minute: number): number {
+		// Intervals that touch (like early sign up running into open) are
+		// one stretch of the queue being open.
+		let close = minute;
+		for (const i of this.intervals || []) {
+			if (i.start <= close && close < i.end) {
+				close = i.end;
 			}
 		}
 
-		return restOfDay[restOfDay.length - 1] + 1;
+		return close;
 	}
 
 	public entryIndex(email: string | undefined): number {
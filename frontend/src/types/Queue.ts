@@ -33,6 +33,8 @@ export default class Queue {
 	public readonly name!: string;
 	public readonly location!: string;
 	public readonly map!: string;
+	// The IANA time zone the queue's schedule is in
+	public readonly timeZone!: string;
 	public announcements: Announcement[] = [];
 
 	public config: QueueConfiguration | null;
@@ -48,6 +50,7 @@ export default class Queue {
 		this.name = data['name'];
 		this.location = data['location'];
 		this.map = data['map'];
+		this.timeZone = data['time_zone'] || 'America/New_York';
 
 		this.course = course;
 		this.online = new Set<string>();
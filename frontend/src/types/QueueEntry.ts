@@ -10,6 +10,9 @@ export class QueueEntry {
 	public priority!: number;
 	public pinned!: boolean;
 	public helping!: boolean;
+	public helpingBy: string | undefined;
+	public helpingName: string | undefined;
+	public helpingSince: Moment | undefined;
 	public helped!: boolean;
 	public online!: boolean;
 
@@ -23,6 +26,7 @@ export class QueueEntry {
 		this.priority = data['priority'] || 0;
 		this.pinned = data['pinned'] || false;
 		this.helping = data['helping'] || false;
+		this.setHelper(data);
 		this.helped = data['helped'] || false;
 		this.online = data['online'] || false;
 	}
@@ -35,10 +39,26 @@ export class QueueEntry {
 		this.priority = data['priority'] || this.priority;
 		this.pinned = data['pinned'] || this.pinned;
 		this.helping = data['helping'];
+		this.setHelper(data);
 		this.helped = data['helped'] || this.helped;
 		this.online = data['online'] || this.online;
 	}
 
+	// Staff see who's helping a student, and students see the first name
+	// of whoever's helping them. Everyone else gets updates without any
+	// of it, which shouldn't forget what we already know.
+	private setHelper(data: { [index: string]: any }) {
+		if (!this.helping) {
+			this.helpingBy = undefined;
+			this.helpingName = undefined;
+			this.helpingSince = undefined;
+		} else if (data['helping_since'] !== undefined) {
+			this.helpingBy = data['helping_by'];
+			this.helpingName = data['helping_name'];
+			this.helpingSince = moment(data['helping_since']).local();
+		}
+	}
+
 	// Get the humanized timestamp in relation to time.
 	// We pass in a parameter here instead of using moment()
 	// to overcome reactivity issues between Vue and moment.
@@ -0,0 +1,319 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/segmentio/ksuid"
+)
+
+// parseValidDomains reads the comma-separated list of domains whose
+// users can log in (e.g. "umich.edu, partner.edu").
+func parseValidDomains(s string) []string {
+	var domains []string
+	for _, d := range strings.Split(s, ",") {
+		d = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(d), "@"))
+		if d != "" {
+			domains = append(domains, d)
+		}
+	}
+	return domains
+}
+
+// inValidDomain reports whether email belongs to one of the valid domains.
+// Without any valid domains, every email does, like before there could be
+// more than one (when an empty domain matched everything); that's what
+// local development with no QUEUE_VALID_DOMAIN relies on.
+func (s *Server) inValidDomain(email string) bool {
+	if len(s.validDomains) == 0 {
+		return true
+	}
+
+	email = strings.ToLower(email)
+	for _, d := range s.validDomains {
+		if strings.HasSuffix(email, "@"+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// validDomainsDescription lists the valid domains for error messages,
+// like "@a.edu or @b.edu".
+func (s *Server) validDomainsDescription() string {
+	// Nobody's turned away then, but the messages should still read right.
+	if len(s.validDomains) == 0 {
+		return "allowed"
+	}
+
+	domains := make([]string, len(s.validDomains))
+	for i, d := range s.validDomains {
+		domains[i] = "@" + d
+	}
+	if len(domains) < 2 {
+		return strings.Join(domains, "")
+	}
+	return strings.Join(domains[:len(domains)-1], ", ") + " or " + domains[len(domains)-1]
+}
+
+// normalizeEmail is how emails on allow lists are stored and looked up.
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+type checkAllowedEmail interface {
+	siteAdmin
+	courseRole
+	getCourseRoles
+
+	// CourseAllowsEmail reports whether email is on course's allow list.
+	CourseAllowsEmail(ctx context.Context, course ksuid.KSUID, email string) (bool, error)
+
+	// EmailAllowedInAnyCourse reports whether email is on the allow list
+	// of at least one course.
+	EmailAllowedInAnyCourse(ctx context.Context, email string) (bool, error)
+}
+
+// emailAllowed reports whether email can use the queue in course, or
+// anywhere outside of a course if course is nil. Users in a valid domain
+// always can; anyone else needs to be on the course's allow list or on
+// its staff. Outside of a course, being on any course's allow list or
+// staff is enough.
+func (s *Server) emailAllowed(ctx context.Context, ca checkAllowedEmail, course *ksuid.KSUID, email string) (bool, error) {
+	if s.inValidDomain(email) {
+		return true, nil
+	}
+
+	if course != nil {
+		role, err := ca.CourseRole(ctx, *course, email)
+		if err != nil {
+			return false, err
+		}
+		if role.Valid() {
+			return true, nil
+		}
+		return ca.CourseAllowsEmail(ctx, *course, normalizeEmail(email))
+	}
+
+	admin, err := ca.SiteAdmin(ctx, email)
+	if err != nil {
+		return false, err
+	}
+	if admin {
+		return true, nil
+	}
+
+	roles, err := ca.GetCourseRoles(ctx, email)
+	if err != nil {
+		return false, err
+	}
+	if len(roles) > 0 {
+		return true, nil
+	}
+	return ca.EmailAllowedInAnyCourse(ctx, normalizeEmail(email))
+}
+
+// ensureEmailAllowed is emailAllowed for handlers, with the error to send
+// back if the user isn't allowed.
+func (s *Server) ensureEmailAllowed(ctx context.Context, ca checkAllowedEmail, course *ksuid.KSUID, email string) error {
+	allowed, err := s.emailAllowed(ctx, ca, course, email)
+	if err != nil {
+		return err
+	}
+	if allowed {
+		return nil
+	}
+
+	if course != nil {
+		return StatusError{
+			http.StatusForbidden,
+			"Oh dear, it looks like you don't have an " + s.validDomainsDescription() + " account, and you aren't on this course's list of outside users. Contact your course staff if you think this is a mistake!",
+		}
+	}
+	return StatusError{
+		http.StatusUnauthorized,
+		"Oh dear, it looks like you don't have an " + s.validDomainsDescription() + " account.",
+	}
+}
+
+// contextCourse is the ID of the course the request is in, if any.
+func contextCourse(r *http.Request) *ksuid.KSUID {
+	if c, ok := r.Context().Value(courseContextKey).(*Course); ok {
+		return &c.ID
+	}
+	if q, ok := r.Context().Value(queueContextKey).(*Queue); ok {
+		return &q.Course
+	}
+	return nil
+}
+
+type getAllowedEmails interface {
+	GetAllowedEmails(ctx context.Context, course ksuid.KSUID) ([]string, error)
+}
+
+func (s *Server) GetAllowedEmails(ga getAllowedEmails) E {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		c := r.Context().Value(courseContextKey).(*Course)
+
+		emails, err := ga.GetAllowedEmails(r.Context(), c.ID)
+		if err != nil {
+			s.logger.Errorw("failed to get allowed emails",
+				RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+				"course_id", c.ID,
+				"err", err,
+			)
+			return err
+		}
+
+		return s.sendResponse(http.StatusOK, emails, w, r)
+	}
+}
+
+// decodeAllowedEmails reads a JSON array of emails from the body,
+// normalized and without duplicates.
+func decodeAllowedEmails(r *http.Request) ([]string, error) {
+	var body []string
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		return nil, StatusError{
+			http.StatusBadRequest,
+			"I couldn't decode the body. Are you sure it's a JSON array of emails (strings)? This error might help: " + err.Error(),
+		}
+	}
+
+	seen := make(map[string]bool, len(body))
+	emails := make([]string, 0, len(body))
+	for _, e := range body {
+		e = normalizeEmail(e)
+		at := strings.Index(e, "@")
+		if at <= 0 || at != strings.LastIndex(e, "@") || at == len(e)-1 {
+			return nil, StatusError{
+				http.StatusBadRequest,
+				`"` + e + `" doesn't look like an email to me.`,
+			}
+		}
+		if !seen[e] {
+			seen[e] = true
+			emails = append(emails, e)
+		}
+	}
+	sort.Strings(emails)
+	return emails, nil
+}
+
+type addAllowedEmails interface {
+	addAuditLogEntry
+	getAllowedEmails
+	AddAllowedEmails(ctx context.Context, course ksuid.KSUID, emails []string, overwrite bool) error
+}
+
+func (s *Server) AddAllowedEmails(aa addAllowedEmails) E {
+	return s.addAllowedEmails(aa, false)
+}
+
+func (s *Server) UpdateAllowedEmails(aa addAllowedEmails) E {
+	return s.addAllowedEmails(aa, true)
+}
+
+func (s *Server) addAllowedEmails(aa addAllowedEmails, overwrite bool) E {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		c := r.Context().Value(courseContextKey).(*Course)
+		email := r.Context().Value(emailContextKey).(string)
+		l := s.logger.With(
+			RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+			"course_id", c.ID,
+			"email", email,
+		)
+
+		emails, err := decodeAllowedEmails(r)
+		if err != nil {
+			l.Warnw("got invalid allowed emails", "err", err)
+			return err
+		}
+
+		before, err := aa.GetAllowedEmails(r.Context(), c.ID)
+		if err != nil {
+			l.Errorw("failed to get allowed emails", "err", err)
+			return err
+		}
+
+		err = aa.AddAllowedEmails(r.Context(), c.ID, emails, overwrite)
+		if err != nil {
+			l.Errorw("failed to update allowed emails", "err", err)
+			return err
+		}
+
+		after, err := aa.GetAllowedEmails(r.Context(), c.ID)
+		if err != nil {
+			l.Errorw("failed to get allowed emails", "err", err)
+			return err
+		}
+
+		action := AuditAllowedEmailsAdd
+		if overwrite {
+			action = AuditAllowedEmailsUpdate
+		}
+		err = s.auditCourse(r.Context(), aa, c.ID, action, "", before, after)
+		if err != nil {
+			l.Errorw("failed to audit allowed email change", "err", err)
+			return err
+		}
+
+		l.Infow("updated allowed emails", "allowed_emails", emails, "overwrite", overwrite)
+		return s.sendResponse(http.StatusNoContent, nil, w, r)
+	}
+}
+
+type removeAllowedEmails interface {
+	addAuditLogEntry
+	getAllowedEmails
+	RemoveAllowedEmails(ctx context.Context, course ksuid.KSUID, emails []string) error
+}
+
+func (s *Server) RemoveAllowedEmails(ra removeAllowedEmails) E {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		c := r.Context().Value(courseContextKey).(*Course)
+		email := r.Context().Value(emailContextKey).(string)
+		l := s.logger.With(
+			RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+			"course_id", c.ID,
+			"email", email,
+		)
+
+		emails, err := decodeAllowedEmails(r)
+		if err != nil {
+			l.Warnw("got invalid allowed emails", "err", err)
+			return err
+		}
+
+		before, err := ra.GetAllowedEmails(r.Context(), c.ID)
+		if err != nil {
+			l.Errorw("failed to get allowed emails", "err", err)
+			return err
+		}
+
+		err = ra.RemoveAllowedEmails(r.Context(), c.ID, emails)
+		if err != nil {
+			l.Errorw("failed to remove allowed emails", "err", err)
+			return err
+		}
+
+		after, err := ra.GetAllowedEmails(r.Context(), c.ID)
+		if err != nil {
+			l.Errorw("failed to get allowed emails", "err", err)
+			return err
+		}
+
+		err = s.auditCourse(r.Context(), ra, c.ID, AuditAllowedEmailsRemove, "", before, after)
+		if err != nil {
+			l.Errorw("failed to audit allowed email change", "err", err)
+			return err
+		}
+
+		l.Infow("removed allowed emails", "allowed_emails", emails)
+		return s.sendResponse(http.StatusNoContent, nil, w, r)
+	}
+}
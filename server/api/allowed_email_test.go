@@ -0,0 +1,30 @@
+package api_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestValidDomains(t *testing.T) {
+	ts := newTestServerIn(t, "example.edu, @Partner.edu")
+	q := ts.addQueue("ordered")
+	ts.openQueue(q, map[string]interface{}{})
+
+	ts.must("student@partner.edu", "POST", "/queues/"+q+"/entries", testEntry, nil)
+
+	b := ts.expect(http.StatusForbidden, "student@gmail.com", "POST", "/queues/"+q+"/entries", testEntry)
+	if !strings.Contains(string(b), "an @example.edu or @partner.edu account") {
+		t.Errorf("outside user refused with %s, want the valid domains named", b)
+	}
+}
+
+func TestNoValidDomains(t *testing.T) {
+	ts := newTestServerIn(t, "")
+	q := ts.addQueue("ordered")
+	ts.openQueue(q, map[string]interface{}{})
+
+	// Like it's always been, everyone's let in.
+	ts.must("student@gmail.com", "POST", "/queues/"+q+"/entries", testEntry, nil)
+	ts.must("student@gmail.com", "GET", "/users/@me", nil, nil)
+}
@@ -0,0 +1,213 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/segmentio/ksuid"
+)
+
+// How far back analytics go if the request doesn't say.
+const defaultAnalyticsRange = 7 * 24 * time.Hour
+
+// The number of half hours listed in QueueAnalytics.BusiestHalfHours.
+const busiestHalfHours = 5
+
+type getRemovedQueueEntries interface {
+	GetRemovedQueueEntries(ctx context.Context, queue ksuid.KSUID, from, to time.Time) ([]*RemovedQueueEntry, error)
+}
+
+// QueueAnalytics summarizes the entries that joined a queue over a range
+// of time and have since been removed. Durations are in seconds, and are
+// nil when there's nothing to compute them from.
+type QueueAnalytics struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+
+	Entries int `json:"entries"`
+
+	// Entries are either helped, removed by staff without being helped
+	// (or cleared), or removed by the student themselves.
+	Helped        int     `json:"helped"`
+	NotHelped     int     `json:"not_helped"`
+	SelfRemoved   int     `json:"self_removed"`
+	NotHelpedRate float64 `json:"not_helped_rate"`
+
+	// Averaged over the hours in which at least one entry joined, so
+	// that hours the queue was closed don't drag it down.
+	EntriesPerHour float64 `json:"entries_per_hour"`
+
+	// From joining the queue until a staff member started helping them
+	// (or removed them, if nobody marked them as being helped).
+	MedianWait *int `json:"median_wait"`
+	P90Wait    *int `json:"p90_wait"`
+
+	// From a staff member starting to help them until they were removed.
+	MedianHelpDuration *int `json:"median_help_duration"`
+	P90HelpDuration    *int `json:"p90_help_duration"`
+
+	Staff []*StaffAnalytics `json:"staff"`
+
+	// Indexed the same way as the characters of a schedule string.
+	HalfHours        [48]HalfHourAnalytics `json:"half_hours"`
+	BusiestHalfHours []int                 `json:"busiest_half_hours"`
+}
+
+type StaffAnalytics struct {
+	Email              string `json:"email"`
+	Helped             int    `json:"helped"`
+	MedianHelpDuration *int   `json:"median_help_duration"`
+}
+
+type HalfHourAnalytics struct {
+	Entries    int  `json:"entries"`
+	Helped     int  `json:"helped"`
+	MedianWait *int `json:"median_wait"`
+}
+
+// percentile returns the pth percentile (by nearest rank) of durations,
+// in seconds, sorting them in the process.
+func percentile(durations []time.Duration, p int) *int {
+	if len(durations) == 0 {
+		return nil
+	}
+
+	sort.Slice(durations, func(i, j int) bool {
+		return durations[i] < durations[j]
+	})
+	rank := (p*len(durations) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	seconds := int(durations[rank-1].Seconds())
+	return &seconds
+}
+
+// analyzeQueue computes the analytics for entries, which must be sorted by
+// ID and have all been removed, with half hours of the day taken in loc.
+func analyzeQueue(entries []*RemovedQueueEntry, from, to time.Time, loc *time.Location) *QueueAnalytics {
+	a := &QueueAnalytics{
+		From:             from,
+		To:               to,
+		Entries:          len(entries),
+		Staff:            make([]*StaffAnalytics, 0),
+		BusiestHalfHours: make([]int, 0),
+	}
+
+	var waits, helpDurations []time.Duration
+	var halfHourWaits [48][]time.Duration
+	staff := make(map[string]*StaffAnalytics)
+	staffHelpDurations := make(map[string][]time.Duration)
+	hours := make(map[time.Time]bool)
+
+	for _, e := range entries {
+		joined := e.ID.Time()
+		halfHour := HalfHour(joined, loc)
+		hours[joined.Truncate(time.Hour)] = true
+		a.HalfHours[halfHour].Entries++
+
+		if e.RemovedBy == e.Email {
+			a.SelfRemoved++
+			continue
+		}
+		if !e.Helped {
+			a.NotHelped++
+			continue
+		}
+
+		a.Helped++
+		a.HalfHours[halfHour].Helped++
+
+		// Whoever's helping the student when they're removed gets the
+		// credit; otherwise it's whoever removed them.
+		helper := e.RemovedBy
+		if e.HelpingBy != nil {
+			helper = *e.HelpingBy
+		}
+		st := staff[helper]
+		if st == nil {
+			st = &StaffAnalytics{Email: helper}
+			staff[helper] = st
+			a.Staff = append(a.Staff, st)
+		}
+		st.Helped++
+
+		helped := e.RemovedAt
+		if e.HelpingSince != nil {
+			helped = *e.HelpingSince
+			helpDuration := e.RemovedAt.Sub(helped)
+			helpDurations = append(helpDurations, helpDuration)
+			staffHelpDurations[helper] = append(staffHelpDurations[helper], helpDuration)
+		}
+
+		wait := helped.Sub(joined)
+		if wait < 0 {
+			wait = 0
+		}
+		waits = append(waits, wait)
+		halfHourWaits[halfHour] = append(halfHourWaits[halfHour], wait)
+	}
+
+	if removed := a.Helped + a.NotHelped + a.SelfRemoved; removed > 0 {
+		a.NotHelpedRate = float64(a.NotHelped+a.SelfRemoved) / float64(removed)
+	}
+	if len(hours) > 0 {
+		a.EntriesPerHour = float64(a.Entries) / float64(len(hours))
+	}
+
+	a.MedianWait = percentile(waits, 50)
+	a.P90Wait = percentile(waits, 90)
+	a.MedianHelpDuration = percentile(helpDurations, 50)
+	a.P90HelpDuration = percentile(helpDurations, 90)
+
+	for _, st := range a.Staff {
+		st.MedianHelpDuration = percentile(staffHelpDurations[st.Email], 50)
+	}
+	sort.SliceStable(a.Staff, func(i, j int) bool {
+		return a.Staff[i].Helped > a.Staff[j].Helped
+	})
+
+	for i := range a.HalfHours {
+		a.HalfHours[i].MedianWait = percentile(halfHourWaits[i], 50)
+		if a.HalfHours[i].Entries > 0 {
+			a.BusiestHalfHours = append(a.BusiestHalfHours, i)
+		}
+	}
+	sort.SliceStable(a.BusiestHalfHours, func(i, j int) bool {
+		return a.HalfHours[a.BusiestHalfHours[i]].Entries > a.HalfHours[a.BusiestHalfHours[j]].Entries
+	})
+	if len(a.BusiestHalfHours) > busiestHalfHours {
+		a.BusiestHalfHours = a.BusiestHalfHours[:busiestHalfHours]
+	}
+
+	return a
+}
+
+func (s *Server) GetQueueAnalytics(ga getRemovedQueueEntries) E {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		q := r.Context().Value(queueContextKey).(*Queue)
+		email := r.Context().Value(emailContextKey).(string)
+		l := s.logger.With(
+			RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+			"queue_id", q.ID,
+			"email", email,
+		)
+
+		from, to, err := timeRange(r, defaultAnalyticsRange, q.Zone())
+		if err != nil {
+			l.Warnw("failed to read time range", "err", err)
+			return err
+		}
+
+		entries, err := ga.GetRemovedQueueEntries(r.Context(), q.ID, from, to)
+		if err != nil {
+			l.Errorw("failed to get removed queue entries", "err", err)
+			return err
+		}
+
+		l.Infow("fetched queue analytics", "from", from, "to", to, "entries", len(entries))
+		return s.sendResponse(http.StatusOK, analyzeQueue(entries, from, to, q.Zone()), w, r)
+	}
+}
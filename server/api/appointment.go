@@ -125,7 +125,7 @@ func (s *Server) GetAppointments(ga getAppointments) E {
 
 		var appointments []*AppointmentSlot
 		var err error
-		start, end := WeekdayBounds(day)
+		start, end := WeekdayBounds(day, q.Zone())
 		if admin {
 			appointments, err = ga.GetAppointments(r.Context(), q.ID, start, end)
 		} else {
@@ -154,7 +154,7 @@ func (s *Server) GetAppointmentsForCurrentUser(ga getAppointmentsForUser) E {
 		email := r.Context().Value(emailContextKey).(string)
 		day := r.Context().Value(appointmentDayContextKey).(int)
 
-		start, end := WeekdayBounds(day)
+		start, end := WeekdayBounds(day, q.Zone())
 		appointments, err := ga.GetAppointmentsForUser(r.Context(), q.ID, start, end, email)
 		if err != nil {
 			s.logger.Errorw("failed to get appointments for user",
@@ -217,6 +217,7 @@ func (s *Server) GetAppointmentScheduleForDay(gs getAppointmentScheduleForDay) E
 }
 
 type claimTimeslot interface {
+	addAuditLogEntry
 	ClaimTimeslot(ctx context.Context, queue ksuid.KSUID, day, timeslot int, email string) (*AppointmentSlot, error)
 }
 
@@ -245,13 +246,20 @@ func (s *Server) ClaimTimeslot(cs claimTimeslot) E {
 
 		l.Infow("appointment claimed")
 
-		s.ps.Pub(WS("APPOINTMENT_CREATE", appointment), QueueTopicAdmin(q.ID))
+		err = s.auditQueue(r.Context(), cs, q, AuditAppointmentClaim, appointment.ID.String(), nil, appointment)
+		if err != nil {
+			l.Errorw("failed to audit appointment claim", "err", err)
+			return err
+		}
+
+		s.publish(r.Context(), q.ID, WS("APPOINTMENT_CREATE", appointment), QueueTopicAdmin(q.ID))
 
 		return s.sendResponse(http.StatusCreated, nil, w, r)
 	}
 }
 
 type unclaimAppointment interface {
+	addAuditLogEntry
 	UnclaimAppointment(ctx context.Context, appointment ksuid.KSUID) (deleted bool, err error)
 }
 
@@ -276,11 +284,21 @@ func (s *Server) UnclaimAppointment(us unclaimAppointment) E {
 			"email", r.Context().Value(emailContextKey),
 		)
 
+		err = s.auditQueue(r.Context(), us, q, AuditAppointmentUnclaim, appointment.ID.String(), appointment, nil)
+		if err != nil {
+			s.logger.Errorw("failed to audit appointment unclaim",
+				RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+				"appointment_id", appointment.ID,
+				"err", err,
+			)
+			return err
+		}
+
 		if deleted {
-			s.ps.Pub(WS("APPOINTMENT_REMOVE", appointment), QueueTopicAdmin(q.ID))
+			s.publish(r.Context(), q.ID, WS("APPOINTMENT_REMOVE", appointment), QueueTopicAdmin(q.ID))
 		} else {
 			appointment.StaffEmail = nil
-			s.ps.Pub(WS("APPOINTMENT_UPDATE", appointment), QueueTopicAdmin(q.ID))
+			s.publish(r.Context(), q.ID, WS("APPOINTMENT_UPDATE", appointment), QueueTopicAdmin(q.ID))
 		}
 
 		return s.sendResponse(http.StatusNoContent, nil, w, r)
@@ -288,6 +306,7 @@ func (s *Server) UnclaimAppointment(us unclaimAppointment) E {
 }
 
 type updateAppointmentSchedule interface {
+	addAuditLogEntry
 	getAppointmentsInTimeFrame
 	getAppointmentScheduleForDay
 	getAppointmentsByTimeslot
@@ -322,7 +341,7 @@ func (s *Server) UpdateAppointmentSchedule(us updateAppointmentSchedule) E {
 			}
 		}
 
-		from, to := WeekdayBounds(day)
+		from, to := WeekdayBounds(day, q.Zone())
 		appointments, err := us.GetAppointments(r.Context(), q.ID, from, to)
 		if err != nil {
 			l.Errorw("failed to get appointments", "err", err)
@@ -367,7 +386,13 @@ func (s *Server) UpdateAppointmentSchedule(us updateAppointmentSchedule) E {
 
 		l.Infow("updated appointment schedule")
 
-		s.ps.Pub(WS("REFRESH", nil), QueueTopicGeneric(q.ID))
+		err = s.auditQueue(r.Context(), us, q, AuditAppointmentSchedule, strconv.Itoa(day), currentSchedule, &schedule)
+		if err != nil {
+			l.Errorw("failed to audit appointment schedule update", "err", err)
+			return err
+		}
+
+		s.publish(r.Context(), q.ID, WS("REFRESH", nil), QueueTopicGeneric(q.ID))
 
 		return s.sendResponse(http.StatusNoContent, nil, w, r)
 	}
@@ -378,10 +403,12 @@ type getAppointmentsByTimeslot interface {
 }
 
 type signupForAppointment interface {
+	addAuditLogEntry
 	getQueueConfiguration
 	getAppointmentScheduleForDay
 	getAppointmentsForUser
 	getAppointmentsByTimeslot
+	checkAllowedEmail
 	UserInQueueRoster(ctx context.Context, queue ksuid.KSUID, email string) (bool, error)
 	TeammateHasAppointment(ctx context.Context, queue ksuid.KSUID, from, to time.Time, email string) (bool, error)
 	SignupForAppointment(ctx context.Context, queue ksuid.KSUID, appointment *AppointmentSlot) (*AppointmentSlot, error)
@@ -403,6 +430,12 @@ func (s *Server) SignupForAppointment(sa signupForAppointment) E {
 			"email", email,
 		)
 
+		err := s.ensureEmailAllowed(r.Context(), sa, &q.Course, email)
+		if err != nil {
+			l.Warnw("user not allowed in course attempted appointment sign up", "err", err)
+			return err
+		}
+
 		config, err := sa.GetQueueConfiguration(r.Context(), q.ID)
 		if err != nil {
 			l.Errorw("failed to get queue configuration", "err", err)
@@ -476,7 +509,7 @@ func (s *Server) SignupForAppointment(sa signupForAppointment) E {
 			}
 		}
 
-		start, end := WeekdayBounds(day)
+		start, end := WeekdayBounds(day, q.Zone())
 
 		// First: check if there are any slots open at this timeslot
 		timeslotAppointments, err := sa.GetAppointmentsByTimeslot(r.Context(), q.ID, start, end, timeslot)
@@ -520,7 +553,7 @@ func (s *Server) SignupForAppointment(sa signupForAppointment) E {
 		// Force some values that were previously validated by middleware
 		appointment.Queue = q.ID
 		appointment.Timeslot = timeslot
-		appointment.ScheduledTime = TimeslotToTime(day, timeslot, schedule.Duration)
+		appointment.ScheduledTime = TimeslotToTime(day, timeslot, schedule.Duration, q.Zone())
 		appointment.Duration = schedule.Duration
 		appointment.StudentEmail = &email
 
@@ -543,10 +576,16 @@ func (s *Server) SignupForAppointment(sa signupForAppointment) E {
 			"scheduled_time", appointment.ScheduledTime,
 		)
 
-		s.ps.Pub(WS("APPOINTMENT_CREATE", newAppointment), QueueTopicAdmin(q.ID))
-		s.ps.Pub(WS("APPOINTMENT_CREATE", newAppointment.Anonymized()), QueueTopicNonPrivileged(q.ID))
+		err = s.auditQueue(r.Context(), sa, q, AuditAppointmentAdd, newAppointment.ID.String(), nil, newAppointment)
+		if err != nil {
+			l.Errorw("failed to audit appointment sign up", "err", err)
+			return err
+		}
+
+		s.publish(r.Context(), q.ID, WS("APPOINTMENT_CREATE", newAppointment), QueueTopicAdmin(q.ID))
+		s.publish(r.Context(), q.ID, WS("APPOINTMENT_CREATE", newAppointment.Anonymized()), QueueTopicNonPrivileged(q.ID))
 		if !admin {
-			s.ps.Pub(WS("APPOINTMENT_UPDATE", newAppointment.NoStaffEmail()), QueueTopicEmail(q.ID, email))
+			s.publish(r.Context(), q.ID, WS("APPOINTMENT_UPDATE", newAppointment.NoStaffEmail()), QueueTopicEmail(q.ID, email))
 		}
 
 		return s.sendResponse(http.StatusCreated, newAppointment, w, r)
@@ -554,6 +593,7 @@ func (s *Server) SignupForAppointment(sa signupForAppointment) E {
 }
 
 type removeAppointmentSignup interface {
+	addAuditLogEntry
 	RemoveAppointmentSignup(ctx context.Context, appointment ksuid.KSUID) (deleted bool, newAppointment *AppointmentSlot, err error)
 }
 
@@ -640,24 +680,30 @@ func (s *Server) UpdateAppointment(ua updateAppointment) E {
 			}
 			l.Infow("updated appointment")
 
-			s.ps.Pub(WS("APPOINTMENT_UPDATE", &newAppointment), QueueTopicAdmin(q.ID))
+			err = s.auditQueue(r.Context(), ua, q, AuditAppointmentUpdate, a.ID.String(), a, &newAppointment)
+			if err != nil {
+				l.Errorw("failed to audit appointment update", "err", err)
+				return err
+			}
+
+			s.publish(r.Context(), q.ID, WS("APPOINTMENT_UPDATE", &newAppointment), QueueTopicAdmin(q.ID))
 			if !admin {
-				s.ps.Pub(WS("APPOINTMENT_UPDATE", newAppointment.NoStaffEmail()), QueueTopicEmail(q.ID, email))
+				s.publish(r.Context(), q.ID, WS("APPOINTMENT_UPDATE", newAppointment.NoStaffEmail()), QueueTopicEmail(q.ID, email))
 			}
 
 			return s.sendResponse(http.StatusNoContent, nil, w, r)
 		}
 
 		// We're changing the appointment time. Not so simple.
-		day := int(time.Now().Local().Weekday())
+		day := CurrentWeekday(q.Zone())
 		schedule, err := ua.GetAppointmentScheduleForDay(r.Context(), a.Queue, day)
 		if err != nil {
 			l.Errorw("failed to get appointment schedule", "err", err)
 			return err
 		}
 
-		start, end := WeekdayBounds(day)
-		newTime := TimeslotToTime(day, newAppointment.Timeslot, schedule.Duration)
+		start, end := WeekdayBounds(day, q.Zone())
+		newTime := TimeslotToTime(day, newAppointment.Timeslot, schedule.Duration, q.Zone())
 		newAppointment.ScheduledTime = newTime
 
 		// If the new time is in the past, stop.
@@ -717,17 +763,24 @@ func (s *Server) UpdateAppointment(ua updateAppointment) E {
 		}
 		l.Infow("removed appointment for update")
 
+		// It's a new appointment now, but it's still the same student's.
+		err = s.auditQueue(r.Context(), ua, q, AuditAppointmentUpdate, a.ID.String(), a, createdAppointment)
+		if err != nil {
+			l.Errorw("failed to audit appointment update", "err", err)
+			return err
+		}
+
 		if deleted {
-			s.ps.Pub(WS("APPOINTMENT_REMOVE", a.Anonymized()), QueueTopicGeneric(q.ID))
+			s.publish(r.Context(), q.ID, WS("APPOINTMENT_REMOVE", a.Anonymized()), QueueTopicGeneric(q.ID))
 		} else {
-			s.ps.Pub(WS("APPOINTMENT_UPDATE", newSlot), QueueTopicAdmin(q.ID))
-			s.ps.Pub(WS("APPOINTMENT_REMOVE", a.Anonymized()), QueueTopicNonPrivileged(q.ID))
+			s.publish(r.Context(), q.ID, WS("APPOINTMENT_UPDATE", newSlot), QueueTopicAdmin(q.ID))
+			s.publish(r.Context(), q.ID, WS("APPOINTMENT_REMOVE", a.Anonymized()), QueueTopicNonPrivileged(q.ID))
 		}
 
-		s.ps.Pub(WS("APPOINTMENT_CREATE", createdAppointment), QueueTopicAdmin(q.ID))
-		s.ps.Pub(WS("APPOINTMENT_CREATE", createdAppointment.Anonymized()), QueueTopicNonPrivileged(q.ID))
+		s.publish(r.Context(), q.ID, WS("APPOINTMENT_CREATE", createdAppointment), QueueTopicAdmin(q.ID))
+		s.publish(r.Context(), q.ID, WS("APPOINTMENT_CREATE", createdAppointment.Anonymized()), QueueTopicNonPrivileged(q.ID))
 		if !admin {
-			s.ps.Pub(WS("APPOINTMENT_UPDATE", createdAppointment.NoStaffEmail()), QueueTopicEmail(q.ID, email))
+			s.publish(r.Context(), q.ID, WS("APPOINTMENT_UPDATE", createdAppointment.NoStaffEmail()), QueueTopicEmail(q.ID, email))
 		}
 
 		return s.sendResponse(http.StatusCreated, createdAppointment, w, r)
@@ -780,11 +833,17 @@ func (s *Server) RemoveAppointmentSignup(rs removeAppointmentSignup) E {
 
 		l.Infow("removed signup for appointment")
 
+		err = s.auditQueue(r.Context(), rs, q, AuditAppointmentRemove, a.ID.String(), a, nil)
+		if err != nil {
+			l.Errorw("failed to audit appointment sign up removal", "err", err)
+			return err
+		}
+
 		if deleted {
-			s.ps.Pub(WS("APPOINTMENT_REMOVE", a.Anonymized()), QueueTopicGeneric(q.ID))
+			s.publish(r.Context(), q.ID, WS("APPOINTMENT_REMOVE", a.Anonymized()), QueueTopicGeneric(q.ID))
 		} else {
-			s.ps.Pub(WS("APPOINTMENT_UPDATE", newSlot), QueueTopicAdmin(q.ID))
-			s.ps.Pub(WS("APPOINTMENT_REMOVE", a.Anonymized()), QueueTopicNonPrivileged(q.ID))
+			s.publish(r.Context(), q.ID, WS("APPOINTMENT_UPDATE", newSlot), QueueTopicAdmin(q.ID))
+			s.publish(r.Context(), q.ID, WS("APPOINTMENT_REMOVE", a.Anonymized()), QueueTopicNonPrivileged(q.ID))
 		}
 
 		return s.sendResponse(http.StatusNoContent, nil, w, r)
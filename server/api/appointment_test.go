@@ -0,0 +1,174 @@
+package api_test
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CarsonHoffman/office-hours-queue/server/api"
+)
+
+var testAppointment = map[string]string{
+	"description": "Questions about the midterm",
+	"location":    "Zoom",
+}
+
+// addAppointmentQueue sets up an appointment queue with ten-minute
+// appointments tomorrow: one slot at timeslot 100 and two at 101.
+// It returns the queue's ID and the path to tomorrow's appointments.
+func (ts *testServer) addAppointmentQueue(config map[string]interface{}) (string, string) {
+	ts.t.Helper()
+	q := ts.addQueue("appointments")
+	ts.openQueue(q, config)
+
+	// The course is in UTC, so tomorrow is all still to come.
+	day := strconv.Itoa(int(time.Now().UTC().AddDate(0, 0, 1).Weekday()))
+	slots := []byte(strings.Repeat("0", 144))
+	slots[100], slots[101] = '1', '2'
+	ts.must(testAdmin, "PUT", "/queues/"+q+"/appointments/schedule/"+day, api.AppointmentSchedule{
+		Duration: 10,
+		Schedule: string(slots),
+	}, nil)
+
+	return q, "/queues/" + q + "/appointments/" + day
+}
+
+func TestSignupForAppointment(t *testing.T) {
+	ts := newTestServer(t)
+	_, day := ts.addAppointmentQueue(map[string]interface{}{})
+
+	const (
+		alice = "alice@example.edu"
+		bob   = "bob@example.edu"
+	)
+
+	ts.expect(http.StatusBadRequest, alice, "POST", day+"/100", map[string]string{"location": "Zoom"})
+
+	var appointment api.AppointmentSlot
+	ts.must(alice, "POST", day+"/100", testAppointment, &appointment)
+	if appointment.StudentEmail == nil || *appointment.StudentEmail != alice || appointment.Timeslot != 100 || appointment.Duration != 10 {
+		t.Errorf("got appointment %+v, want alice's at timeslot 100", appointment)
+	}
+
+	// Timeslot 100 only has the one slot, and alice can only have one
+	// appointment coming up.
+	ts.expect(http.StatusConflict, bob, "POST", day+"/100", testAppointment)
+	ts.expect(http.StatusConflict, alice, "POST", day+"/101", testAppointment)
+	ts.expect(http.StatusConflict, bob, "POST", day+"/99", testAppointment)
+
+	ts.must(bob, "POST", day+"/101", testAppointment, nil)
+
+	// Once alice cancels, her slot is free for someone else.
+	ts.must(alice, "DELETE", "/queues/"+appointment.Queue.String()+"/appointments/"+appointment.ID.String(), nil, nil)
+	ts.must("carol@example.edu", "POST", day+"/100", testAppointment, nil)
+}
+
+func TestSignupForAppointmentTeammate(t *testing.T) {
+	ts := newTestServer(t)
+	q, day := ts.addAppointmentQueue(map[string]interface{}{"prevent_groups": true})
+
+	const (
+		alice = "alice@example.edu"
+		bob   = "bob@example.edu"
+	)
+	ts.must(testAdmin, "PUT", "/queues/"+q+"/groups", [][]string{{alice, bob}}, nil)
+
+	ts.must(alice, "POST", day+"/101", testAppointment, nil)
+	ts.expect(http.StatusConflict, bob, "POST", day+"/101", testAppointment)
+	ts.must("carol@example.edu", "POST", day+"/101", testAppointment, nil)
+}
+
+func TestClaimTimeslot(t *testing.T) {
+	ts := newTestServer(t)
+	_, day := ts.addAppointmentQueue(map[string]interface{}{})
+
+	const student = "student@example.edu"
+	ts.expect(http.StatusForbidden, student, "PUT", day+"/claims/100", nil)
+
+	var appointment api.AppointmentSlot
+	ts.must(student, "POST", day+"/100", testAppointment, &appointment)
+
+	// Claiming a timeslot takes the student's appointment first, and
+	// then there's nothing left at it to claim.
+	ts.must(testTA, "PUT", day+"/claims/100", nil, nil)
+	ts.expect(http.StatusBadRequest, testTA, "PUT", day+"/claims/100", nil)
+
+	var appointments []*api.AppointmentSlot
+	ts.must(testTA, "GET", day, nil, &appointments)
+	if len(appointments) != 1 || appointments[0].ID != appointment.ID ||
+		appointments[0].StaffEmail == nil || *appointments[0].StaffEmail != testTA {
+		t.Fatalf("after claiming, got appointments %+v, want the student's claimed by %s", appointments, testTA)
+	}
+
+	// A claimed timeslot without a student keeps a slot for them, which
+	// the next student to sign up gets.
+	ts.must(testTA, "PUT", day+"/claims/101", nil, nil)
+	ts.must(testTA, "PUT", day+"/claims/101", nil, nil)
+	ts.expect(http.StatusBadRequest, testTA, "PUT", day+"/claims/101", nil)
+
+	var signup api.AppointmentSlot
+	ts.must("other@example.edu", "POST", day+"/101", testAppointment, &signup)
+	var afterSignup []*api.AppointmentSlot
+	ts.must(testTA, "GET", day, nil, &afterSignup)
+	claimed := 0
+	for _, a := range afterSignup {
+		if a.Timeslot == 101 {
+			claimed++
+			if a.ID == signup.ID && (a.StaffEmail == nil || *a.StaffEmail != testTA) {
+				t.Errorf("student signed up for %+v, want a claimed slot", a)
+			}
+		}
+	}
+	if claimed != 2 {
+		t.Errorf("got %d appointments at timeslot 101, want 2", claimed)
+	}
+
+	// Unclaiming an appointment with a student leaves it with them.
+	ts.must(testTA, "DELETE", "/queues/"+appointment.Queue.String()+"/appointments/claims/"+appointment.ID.String(), nil, nil)
+	var unclaimed []*api.AppointmentSlot
+	ts.must(testTA, "GET", day, nil, &unclaimed)
+	for _, a := range unclaimed {
+		if a.ID == appointment.ID && a.StaffEmail != nil {
+			t.Errorf("after unclaiming, got %+v, want no staff", a)
+		}
+	}
+}
+
+func TestAuditAppointments(t *testing.T) {
+	ts := newTestServer(t)
+	q, day := ts.addAppointmentQueue(map[string]interface{}{})
+
+	const student = "student@example.edu"
+	var appointment api.AppointmentSlot
+	ts.must(student, "POST", day+"/100", testAppointment, &appointment)
+	path := "/queues/" + q + "/appointments/" + appointment.ID.String()
+	ts.must(student, "PUT", path, map[string]interface{}{
+		"description": "Questions about the final",
+		"location":    "Zoom",
+		"timeslot":    100,
+	}, nil)
+	ts.must(testTA, "PUT", day+"/claims/100", nil, nil)
+	ts.must(testTA, "DELETE", "/queues/"+q+"/appointments/claims/"+appointment.ID.String(), nil, nil)
+	ts.must(student, "DELETE", path, nil, nil)
+
+	want := map[string]string{
+		api.AuditAppointmentAdd:     student,
+		api.AuditAppointmentUpdate:  student,
+		api.AuditAppointmentClaim:   testTA,
+		api.AuditAppointmentUnclaim: testTA,
+		api.AuditAppointmentRemove:  student,
+	}
+	for _, e := range ts.auditLog(q) {
+		if actor, ok := want[e.Action]; ok {
+			if e.Actor != actor || e.Target != appointment.ID.String() {
+				t.Errorf("%s by %s of %s, want by %s of %s", e.Action, e.Actor, e.Target, actor, appointment.ID)
+			}
+			delete(want, e.Action)
+		}
+	}
+	for action := range want {
+		t.Errorf("no %s in the audit log", action)
+	}
+}
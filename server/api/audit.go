@@ -0,0 +1,270 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/ksuid"
+)
+
+// SystemActor is the actor of changes the server makes on its own, like
+// clearing a queue when it closes on its schedule.
+const SystemActor = "system"
+
+// The actions recorded in the audit log.
+const (
+	AuditEntryAdd       = "entry.add"
+	AuditEntryRemove    = "entry.remove"
+	AuditEntryPin       = "entry.pin"
+	AuditEntryHelping   = "entry.helping"
+	AuditEntryNotHelped = "entry.not_helped"
+
+	AuditAppointmentAdd     = "appointment.add"
+	AuditAppointmentUpdate  = "appointment.update"
+	AuditAppointmentRemove  = "appointment.remove"
+	AuditAppointmentClaim   = "appointment.claim"
+	AuditAppointmentUnclaim = "appointment.unclaim"
+
+	AuditCourseUpdate = "course.update"
+	AuditCourseRemove = "course.remove"
+
+	AuditQueueAdd       = "queue.add"
+	AuditQueueUpdate    = "queue.update"
+	AuditQueueRemove    = "queue.remove"
+	AuditQueueRandomize = "queue.randomize"
+	AuditQueueClear     = "queue.clear"
+	AuditQueueOpen      = "queue.open"
+	AuditQueueCarryOver = "queue.carry_over"
+
+	AuditConfigurationUpdate = "configuration.update"
+	AuditScheduleUpdate      = "schedule.update"
+	AuditAppointmentSchedule = "appointment_schedule.update"
+	AuditRosterUpdate        = "roster.update"
+
+	AuditScheduleOverrideUpdate = "schedule_override.update"
+	AuditScheduleOverrideRemove = "schedule_override.remove"
+
+	AuditAnnouncementAdd    = "announcement.add"
+	AuditAnnouncementRemove = "announcement.remove"
+
+	AuditAdminsAdd    = "admins.add"
+	AuditAdminsUpdate = "admins.update"
+	AuditAdminsRemove = "admins.remove"
+
+	AuditAllowedEmailsAdd    = "allowed_emails.add"
+	AuditAllowedEmailsUpdate = "allowed_emails.update"
+	AuditAllowedEmailsRemove = "allowed_emails.remove"
+
+	AuditAPITokenAdd    = "api_token.add"
+	AuditAPITokenRemove = "api_token.remove"
+
+	AuditImpersonationStart = "impersonation.start"
+	AuditImpersonationStop  = "impersonation.stop"
+
+	AuditSessionsRemove = "sessions.remove"
+)
+
+const (
+	defaultAuditLogLimit = 100
+	maxAuditLogLimit     = 1000
+)
+
+// AuditLogEntry is a record of a change someone made. Queue is nil for
+// changes to the course as a whole, and Course is ksuid.Nil for things
+// that aren't about any one course (like impersonation). Before and After are whatever was
+// changed, as it was and as it became, where that makes sense.
+type AuditLogEntry struct {
+	ID     ksuid.KSUID     `json:"id" db:"id"`
+	Course ksuid.KSUID     `json:"course" db:"course"`
+	Queue  *ksuid.KSUID    `json:"queue" db:"queue"`
+	Actor  string          `json:"actor" db:"actor"`
+	Action string          `json:"action" db:"action"`
+	Target string          `json:"target,omitempty" db:"target"`
+	Before json.RawMessage `json:"before,omitempty" db:"before"`
+	After  json.RawMessage `json:"after,omitempty" db:"after"`
+}
+
+// AuditLogFilter selects audit log entries, newest first. Empty fields
+// match everything; Before is the ID of the last entry of the previous
+// page, if any.
+type AuditLogFilter struct {
+	Course ksuid.KSUID
+	Queue  *ksuid.KSUID
+	Actor  string
+	Action string
+	Target string
+	Before ksuid.KSUID
+	Limit  int
+}
+
+type addAuditLogEntry interface {
+	AddAuditLogEntry(ctx context.Context, entry *AuditLogEntry) error
+}
+
+type getAuditLog interface {
+	GetAuditLog(ctx context.Context, filter *AuditLogFilter) ([]*AuditLogEntry, error)
+}
+
+// newAuditLogID returns an ID for a new audit log entry. KSUIDs are only
+// ordered to the second, and the log is paged through by ID, so the
+// nanoseconds go at the front of the payload to keep entries written in
+// quick succession (often by the same request) in order.
+func newAuditLogID() (ksuid.KSUID, error) {
+	now := time.Now()
+	var payload [16]byte
+	binary.BigEndian.PutUint32(payload[:4], uint32(now.Nanosecond()))
+	_, err := rand.Read(payload[4:])
+	if err != nil {
+		return ksuid.Nil, err
+	}
+	return ksuid.FromParts(now, payload[:])
+}
+
+// audit records a change to the audit log. It's written in the request's
+// transaction, so it's only kept if the change itself is.
+func (s *Server) audit(ctx context.Context, al addAuditLogEntry, course ksuid.KSUID, queue *ksuid.KSUID, action, target string, before, after interface{}) error {
+	id, err := newAuditLogID()
+	if err != nil {
+		return fmt.Errorf("failed to generate audit log ID: %w", err)
+	}
+
+	// Whoever is impersonating someone is the one responsible.
+	actor, ok := ctx.Value(impersonatorContextKey).(string)
+	if !ok {
+		actor, _ = ctx.Value(emailContextKey).(string)
+	}
+	if actor == "" {
+		actor = SystemActor
+	}
+	entry := &AuditLogEntry{
+		ID:     id,
+		Course: course,
+		Queue:  queue,
+		Actor:  actor,
+		Action: action,
+		Target: target,
+	}
+
+	if before != nil {
+		entry.Before, err = json.Marshal(before)
+		if err != nil {
+			return fmt.Errorf("failed to marshal audit log before value: %w", err)
+		}
+	}
+	if after != nil {
+		entry.After, err = json.Marshal(after)
+		if err != nil {
+			return fmt.Errorf("failed to marshal audit log after value: %w", err)
+		}
+	}
+
+	err = al.AddAuditLogEntry(ctx, entry)
+	if err != nil {
+		return fmt.Errorf("failed to add audit log entry: %w", err)
+	}
+	return nil
+}
+
+// auditQueue records a change to q.
+func (s *Server) auditQueue(ctx context.Context, al addAuditLogEntry, q *Queue, action, target string, before, after interface{}) error {
+	return s.audit(ctx, al, q.Course, &q.ID, action, target, before, after)
+}
+
+// auditCourse records a change to the course as a whole.
+func (s *Server) auditCourse(ctx context.Context, al addAuditLogEntry, course ksuid.KSUID, action, target string, before, after interface{}) error {
+	return s.audit(ctx, al, course, nil, action, target, before, after)
+}
+
+// auditSite records something that isn't about any one course.
+func (s *Server) auditSite(ctx context.Context, al addAuditLogEntry, action, target string, before, after interface{}) error {
+	return s.audit(ctx, al, ksuid.Nil, nil, action, target, before, after)
+}
+
+// GetAuditLog serves a page of the audit log of the course or queue in
+// the URL (or the site-wide one, outside of a course), filtered by the
+// actor, action and target query parameters. The response's next field
+// is the before parameter for the next page.
+func (s *Server) GetAuditLog(ga getAuditLog) E {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		email := r.Context().Value(emailContextKey).(string)
+		l := s.logger.With(
+			RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+			"email", email,
+		)
+
+		filter := AuditLogFilter{
+			Actor:  r.URL.Query().Get("actor"),
+			Action: r.URL.Query().Get("action"),
+			Target: r.URL.Query().Get("target"),
+			Limit:  defaultAuditLogLimit,
+		}
+
+		if q, ok := r.Context().Value(queueContextKey).(*Queue); ok {
+			filter.Course = q.Course
+			filter.Queue = &q.ID
+			l = l.With("queue_id", q.ID)
+		} else if c, ok := r.Context().Value(courseContextKey).(*Course); ok {
+			filter.Course = c.ID
+			l = l.With("course_id", c.ID)
+
+			if v := r.URL.Query().Get("queue"); v != "" {
+				queue, err := ksuid.Parse(v)
+				if err != nil {
+					l.Warnw("failed to parse queue filter", "queue", v, "err", err)
+					return StatusError{
+						http.StatusBadRequest,
+						"I couldn't read the queue ID to filter by.",
+					}
+				}
+				filter.Queue = &queue
+			}
+		}
+
+		if v := r.URL.Query().Get("before"); v != "" {
+			before, err := ksuid.Parse(v)
+			if err != nil {
+				l.Warnw("failed to parse cursor", "before", v, "err", err)
+				return StatusError{
+					http.StatusBadRequest,
+					"I couldn't read the `before` cursor.",
+				}
+			}
+			filter.Before = before
+		}
+
+		if v := r.URL.Query().Get("limit"); v != "" {
+			limit, err := strconv.Atoi(v)
+			if err != nil || limit < 1 || limit > maxAuditLogLimit {
+				l.Warnw("invalid limit", "limit", v)
+				return StatusError{
+					http.StatusBadRequest,
+					fmt.Sprintf("The limit needs to be a number between 1 and %d.", maxAuditLogLimit),
+				}
+			}
+			filter.Limit = limit
+		}
+
+		entries, err := ga.GetAuditLog(r.Context(), &filter)
+		if err != nil {
+			l.Errorw("failed to get audit log", "err", err)
+			return err
+		}
+
+		resp := struct {
+			Entries []*AuditLogEntry `json:"entries"`
+			Next    *ksuid.KSUID     `json:"next,omitempty"`
+		}{Entries: entries}
+		if len(entries) == filter.Limit {
+			resp.Next = &entries[len(entries)-1].ID
+		}
+
+		l.Infow("fetched audit log", "num_entries", len(entries))
+		return s.sendResponse(http.StatusOK, resp, w, r)
+	}
+}
@@ -2,14 +2,13 @@ package api
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"os"
-	"strings"
+	"sort"
 
 	"github.com/dchest/uniuri"
-	"google.golang.org/api/idtoken"
-	goauth2 "google.golang.org/api/oauth2/v2"
-	"google.golang.org/api/option"
+	"github.com/segmentio/ksuid"
 )
 
 const (
@@ -28,55 +27,137 @@ var emptySessionCookie = &http.Cookie{
 	HttpOnly: true,
 	Secure:   os.Getenv("USE_SECURE_COOKIES") == "true",
 	Path:     "/",
+	SameSite: http.SameSiteLaxMode,
 }
 
-func (s *Server) ValidLoginMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		session, err := s.sessions.Get(r, "session")
-		if err != nil {
-			s.logger.Infow("got invalid session",
-				RequestIDContextKey, r.Context().Value(RequestIDContextKey),
-				"err", err,
-			)
-			http.SetCookie(w, emptySessionCookie)
-			s.errorMessage(
-				http.StatusUnauthorized,
-				"Try logging in again.",
-				w, r,
-			)
-			return
-		}
+// ValidLoginMiddleware only lets through logged-in users who are allowed
+// to use the queue (see emailAllowed), in the request's course if it has
+// one.
+func (s *Server) ValidLoginMiddleware(ca checkAllowedEmail) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var email string
+			if token, ok := r.Context().Value(apiTokenContextKey).(*APIToken); ok {
+				// Course-scoped tokens are checked against their course in
+				// CheckCourseAdmin; anywhere without a course, they're no good.
+				_, inCourse := r.Context().Value(courseContextKey).(*Course)
+				_, inQueue := r.Context().Value(queueContextKey).(*Queue)
+				if token.Course != nil && !inCourse && !inQueue {
+					s.logger.Warnw("course-scoped API token used outside of course",
+						RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+						"token_id", token.ID,
+						"email", token.Email,
+					)
+					s.errorMessage(
+						http.StatusForbidden,
+						"That API token can only be used in its course.",
+						w, r,
+					)
+					return
+				}
+				email = token.Email
+			} else {
+				session, err := s.sessions.Get(r, "session")
+				if err != nil {
+					s.logger.Infow("got invalid session",
+						RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+						"err", err,
+					)
+					http.SetCookie(w, emptySessionCookie)
+					s.errorMessage(
+						http.StatusUnauthorized,
+						"Try logging in again.",
+						w, r,
+					)
+					return
+				}
+
+				// The session might have been revoked or be impersonating
+				// someone, so it's whatever sessionRetriever made of it
+				// that counts.
+				var ok bool
+				email, ok = r.Context().Value(emailContextKey).(string)
+				if !session.IsNew && !ok {
+					http.SetCookie(w, emptySessionCookie)
+				}
+				if !ok {
+					s.errorMessage(
+						http.StatusUnauthorized,
+						"Come back with a login!",
+						w, r,
+					)
+					return
+				}
+
+				// Impersonation is only for looking around; the impersonated
+				// user is the one who needs to be allowed in.
+				if impersonator, ok := r.Context().Value(impersonatorContextKey).(string); ok {
+					if r.Method != http.MethodGet && r.Method != http.MethodHead {
+						s.logger.Warnw("attempted change while impersonating",
+							RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+							"impersonator", impersonator,
+							"email", email,
+						)
+						s.errorMessage(
+							http.StatusForbidden,
+							"You're impersonating "+email+", so you can only look around. Stop impersonating to make changes.",
+							w, r,
+						)
+						return
+					}
+				}
+			}
 
-		email, ok := session.Values["email"].(string)
-		if !ok {
-			s.errorMessage(
-				http.StatusUnauthorized,
-				"Come back with a login!",
-				w, r,
-			)
-			return
-		}
+			err := s.ensureEmailAllowed(r.Context(), ca, contextCourse(r), email)
+			if err != nil {
+				var serr StatusError
+				if !errors.As(err, &serr) {
+					s.logger.Errorw("failed to check whether email is allowed",
+						RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+						"email", email,
+						"err", err,
+					)
+					s.internalServerError(w, r)
+					return
+				}
+
+				s.logger.Warnw("found valid session with email that isn't allowed",
+					RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+					"valid_domains", s.validDomains,
+					"email", email,
+				)
+				s.errorMessage(serr.status, serr.message, w, r)
+				return
+			}
 
-		domain := os.Getenv("QUEUE_VALID_DOMAIN")
-		if !strings.HasSuffix(email, "@"+domain) {
-			s.logger.Warnw("found valid session with email outside valid domain",
-				RequestIDContextKey, r.Context().Value(RequestIDContextKey),
-				"valid_domain", domain,
-				"email", email,
-			)
-			s.errorMessage(
-				http.StatusUnauthorized,
-				"Oh dear, it looks like you don't have an @"+os.Getenv("QUEUE_VALID_DOMAIN")+" account.",
-				w, r,
-			)
-			return
-		}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
 
-		next.ServeHTTP(w, r)
-	})
+// UserInfo is what we learn about a user when they log in.
+type UserInfo struct {
+	Email     string
+	Name      string
+	FirstName string
+	Picture   string
 }
 
-func (s *Server) Login() E {
+// LoginProvider is an identity provider users log in with.
+type LoginProvider interface {
+	// AuthCodeURL is where to send the user to log in. They come back to
+	// the OAuth2 callback with state.
+	AuthCodeURL(state string) string
+
+	// Exchange finishes a login with the code from the OAuth2 callback.
+	Exchange(ctx context.Context, code, state string) (*UserInfo, error)
+
+	// ValidateIDToken logs a user in with an ID token the client got
+	// from the provider itself.
+	ValidateIDToken(ctx context.Context, token string) (*UserInfo, error)
+}
+
+func (s *Server) Login(as addUserSession) E {
 	return func(w http.ResponseWriter, r *http.Request) error {
 		session, err := s.sessions.New(r, "session")
 		if err != nil {
@@ -89,8 +170,7 @@ func (s *Server) Login() E {
 			return nil
 		}
 
-		token := r.FormValue("idtoken")
-		payload, err := idtoken.Validate(r.Context(), token, os.Getenv("QUEUE_OAUTH2_CLIENT_ID"))
+		info, err := s.loginProvider.ValidateIDToken(r.Context(), r.FormValue("idtoken"))
 		if err != nil {
 			s.logger.Warnw("failed to validate token",
 				RequestIDContextKey, r.Context().Value(RequestIDContextKey),
@@ -102,10 +182,11 @@ func (s *Server) Login() E {
 			}
 		}
 
-		email, ok := payload.Claims["email"].(string)
-		if !ok {
-			s.logger.Errorw("failed to get email from validated token",
+		err = s.saveLogin(as, w, r, session, info)
+		if err != nil {
+			s.logger.Errorw("failed to save login",
 				RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+				"email", info.Email,
 				"err", err,
 			)
 			return err
@@ -113,11 +194,9 @@ func (s *Server) Login() E {
 
 		s.logger.Infow("processed login",
 			RequestIDContextKey, r.Context().Value(RequestIDContextKey),
-			"email", email,
+			"email", info.Email,
 		)
-
-		session.Values["email"] = email
-		return s.sessions.Save(r, w, session)
+		return nil
 	}
 }
 
@@ -138,14 +217,14 @@ func (s *Server) OAuth2LoginLink() E {
 		session.Values["state"] = state
 		s.sessions.Save(r, w, session)
 
-		url := s.oauthConfig.AuthCodeURL(state)
+		url := s.loginProvider.AuthCodeURL(state)
 
 		http.Redirect(w, r, url, http.StatusTemporaryRedirect)
 		return nil
 	}
 }
 
-func (s *Server) OAuth2Callback() E {
+func (s *Server) OAuth2Callback(as addUserSession) E {
 	return func(w http.ResponseWriter, r *http.Request) error {
 		l := s.logger.With(RequestIDContextKey, r.Context().Value(RequestIDContextKey))
 		code := r.FormValue("code")
@@ -173,30 +252,19 @@ func (s *Server) OAuth2Callback() E {
 			}
 		}
 
-		token, err := s.oauthConfig.Exchange(r.Context(), code)
+		info, err := s.loginProvider.Exchange(r.Context(), code, state)
 		if err != nil {
-			l.Errorw("failed to exchange token", "err", err)
+			l.Errorw("failed to finish login", "err", err)
 			return err
 		}
 
-		service, err := goauth2.NewService(r.Context(), option.WithTokenSource(s.oauthConfig.TokenSource(r.Context(), token)))
+		delete(session.Values, "state")
+		err = s.saveLogin(as, w, r, session, info)
 		if err != nil {
-			l.Errorw("failed to set up OAuth2 service", "err", err)
+			l.Errorw("failed to save login", "email", info.Email, "err", err)
 			return err
 		}
 
-		info, err := service.Userinfo.V2.Me.Get().Do()
-		if err != nil {
-			l.Errorw("failed to fetch user info", "err", err)
-			return err
-		}
-
-		session.Values["email"] = info.Email
-		session.Values["profile_pic"] = info.Picture
-		session.Values["name"] = info.Name
-		session.Values["first_name"] = info.GivenName
-		s.sessions.Save(r, w, session)
-
 		s.logger.Infow("processed login",
 			RequestIDContextKey, r.Context().Value(RequestIDContextKey),
 			"email", info.Email,
@@ -207,26 +275,47 @@ func (s *Server) OAuth2Callback() E {
 	}
 }
 
-func (s *Server) Logout() E {
+// Logout ends the session, both in the browser and wherever the session
+// is stored, so the cookie can't be used again even if it's kept around.
+func (s *Server) Logout(rs removeUserSession) E {
 	return func(w http.ResponseWriter, r *http.Request) error {
-		s.logger.Infow("logged out",
+		l := s.logger.With(
 			RequestIDContextKey, r.Context().Value(RequestIDContextKey),
 			emailContextKey, r.Context().Value(emailContextKey),
 		)
 
-		http.SetCookie(w, emptySessionCookie)
-		http.Redirect(w, r, s.baseURL, http.StatusTemporaryRedirect)
-		return nil
+		if id, ok := r.Context().Value(sessionIDContextKey).(ksuid.KSUID); ok {
+			err := rs.RemoveUserSession(r.Context(), id)
+			if err != nil {
+				l.Errorw("failed to remove session", "err", err)
+				return err
+			}
+		}
+
+		session, err := s.sessions.Get(r, "session")
+		if err == nil {
+			session.Options.MaxAge = -1
+			err = s.sessions.Save(r, w, session)
+		}
+		if err != nil {
+			l.Warnw("failed to destroy session", "err", err)
+			http.SetCookie(w, emptySessionCookie)
+		}
+
+		l.Infow("logged out")
+		return s.sendResponse(http.StatusNoContent, nil, w, r)
 	}
 }
 
-type getAdminCourses interface {
-	GetAdminCourses(ctx context.Context, email string) ([]string, error)
+// getCourseRoles gets the user's role in each course they're on the staff
+// of, keyed by course ID. Site admins are instructors in every course.
+type getCourseRoles interface {
+	GetCourseRoles(ctx context.Context, email string) (map[string]CourseRole, error)
 }
 
 type getUserInfo interface {
 	siteAdmin
-	getAdminCourses
+	getCourseRoles
 }
 
 func (s *Server) GetCurrentUserInfo(gi getUserInfo) E {
@@ -243,9 +332,9 @@ func (s *Server) GetCurrentUserInfo(gi getUserInfo) E {
 			return err
 		}
 
-		courses, err := gi.GetAdminCourses(r.Context(), email)
+		roles, err := gi.GetCourseRoles(r.Context(), email)
 		if err != nil {
-			s.logger.Errorw("failed to get admin courses",
+			s.logger.Errorw("failed to get course roles",
 				RequestIDContextKey, r.Context().Value(RequestIDContextKey),
 				"email", email,
 				"err", err,
@@ -253,21 +342,30 @@ func (s *Server) GetCurrentUserInfo(gi getUserInfo) E {
 			return err
 		}
 
+		courses := make([]string, 0, len(roles))
+		for course := range roles {
+			courses = append(courses, course)
+		}
+		sort.Strings(courses)
+
 		// If any read or assertion fails, the string will be empty and
 		// will get caught by omitempty in the JSON encoding. It looks bad,
 		// but is actually not horrible!
 		name, _ := r.Context().Value(nameContextKey).(string)
 		firstName, _ := r.Context().Value(firstNameContextKey).(string)
 		profilePicture, _ := r.Context().Value(profilePictureContextKey).(string)
+		impersonator, _ := r.Context().Value(impersonatorContextKey).(string)
 
 		resp := struct {
-			Email          string   `json:"email"`
-			SiteAdmin      bool     `json:"site_admin"`
-			AdminCourses   []string `json:"admin_courses"`
-			Name           string   `json:"name"`
-			FirstName      string   `json:"first_name"`
-			ProfilePicture string   `json:"profile_pic,omitempty"`
-		}{email, admin, courses, name, firstName, profilePicture}
+			Email          string                `json:"email"`
+			SiteAdmin      bool                  `json:"site_admin"`
+			AdminCourses   []string              `json:"admin_courses"`
+			CourseRoles    map[string]CourseRole `json:"course_roles"`
+			Name           string                `json:"name"`
+			FirstName      string                `json:"first_name"`
+			ProfilePicture string                `json:"profile_pic,omitempty"`
+			Impersonator   string                `json:"impersonator,omitempty"`
+		}{email, admin, courses, roles, name, firstName, profilePicture, impersonator}
 
 		return s.sendResponse(http.StatusOK, resp, w, r)
 	}
@@ -0,0 +1,217 @@
+package api
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cskr/pubsub"
+	"github.com/segmentio/ksuid"
+)
+
+// Broker gets WebSocket events to their subscribers and keeps track of
+// who's connected to each queue. With more than one instance of the
+// server running, it's responsible for both of those spanning all of
+// them, since a client can be connected to any instance.
+type Broker interface {
+	// Publish assigns msg the next sequence number for queue and sends
+	// it to the subscribers of each of topics. Handlers shouldn't call
+	// this directly; see Server.publish.
+	Publish(ctx context.Context, queue ksuid.KSUID, msg *WSMessage, topics ...string)
+
+	// Subscribe returns a channel on which events published to any of
+	// topics are received, until it's passed to Unsubscribe.
+	Subscribe(topics ...string) chan interface{}
+	Unsubscribe(ch chan interface{})
+
+	// Replay returns the events sent to queue on any of topics after
+	// since, for a client that's reconnecting. If some of them are no
+	// longer available, ok is false.
+	Replay(ctx context.Context, queue ksuid.KSUID, since uint64, topics ...string) (events []*WSMessage, ok bool, err error)
+
+	// Connect records a new WebSocket to queue, from email if the user
+	// is logged in. It returns the number of WebSockets now connected to
+	// queue and whether this is the user's first.
+	Connect(ctx context.Context, queue ksuid.KSUID, email string) (connections int, first bool, err error)
+
+	// Disconnect is the reverse of Connect; last is whether the user
+	// no longer has any WebSockets connected to queue.
+	Disconnect(ctx context.Context, queue ksuid.KSUID, email string) (connections int, last bool, err error)
+
+	// Online returns the logged-in users with a WebSocket to queue.
+	Online(ctx context.Context, queue ksuid.KSUID) ([]string, error)
+}
+
+type outboxEvent struct {
+	queue  ksuid.KSUID
+	msg    *WSMessage
+	topics []string
+}
+
+// outbox holds the events published during a request until its
+// transaction commits. If it doesn't, they're dropped, since clients
+// would otherwise hear about changes that never happened.
+type outbox struct {
+	events []outboxEvent
+}
+
+func (o *outbox) flush(b Broker) {
+	for _, e := range o.events {
+		b.Publish(context.Background(), e.queue, e.msg, e.topics...)
+	}
+	o.events = nil
+}
+
+// publish sends msg to topics once the request's transaction commits.
+// Outside of a request (e.g. from a WebSocket's own goroutines), it's
+// sent right away.
+func (s *Server) publish(ctx context.Context, queue ksuid.KSUID, msg *WSMessage, topics ...string) {
+	o, ok := ctx.Value(outboxContextKey).(*outbox)
+	if !ok {
+		s.broker.Publish(ctx, queue, msg, topics...)
+		return
+	}
+
+	o.events = append(o.events, outboxEvent{queue, msg, topics})
+}
+
+// The number of events kept for each topic for replaying to clients
+// that reconnect.
+const replaySize = 256
+
+// LocalBroker is a Broker for a single instance of the server; events
+// and connections never leave the process.
+type LocalBroker struct {
+	ps     *pubsub.PubSub
+	replay *ReplayBuffer
+
+	// Sequence numbers start at the time the broker was created (in
+	// milliseconds), so that they keep going up across restarts and a
+	// client from before one doesn't think it's caught up.
+	start    uint64
+	seqs     map[ksuid.KSUID]uint64
+	seqsLock sync.Mutex
+
+	// Held through delivery so that events go out in sequence order.
+	publishLock sync.Mutex
+
+	// The number of WebSockets connected to each queue.
+	websocketCount        map[ksuid.KSUID]int
+	websocketCountByEmail map[ksuid.KSUID]map[string]int
+	websocketCountLock    sync.Mutex
+}
+
+func NewLocalBroker() *LocalBroker {
+	// TODO: evaluate capacity choice for channel. This assumes that
+	// there isn't likely to be more than 5 events in "quick" succession
+	// to any particular connection, and reduces overall latency between
+	// sending on different connections in that case, but allocates room
+	// for 5 events on every connection. There isn't an empirical basis here.
+	// Just a guess.
+	b := &LocalBroker{
+		ps:                    pubsub.New(5),
+		start:                 uint64(time.Now().UnixNano() / int64(time.Millisecond)),
+		seqs:                  make(map[ksuid.KSUID]uint64),
+		websocketCount:        make(map[ksuid.KSUID]int),
+		websocketCountByEmail: make(map[ksuid.KSUID]map[string]int),
+	}
+	b.replay = NewReplayBuffer(replaySize, b.seq)
+	return b
+}
+
+func (b *LocalBroker) seq(queue ksuid.KSUID) (uint64, error) {
+	b.seqsLock.Lock()
+	defer b.seqsLock.Unlock()
+
+	if seq, ok := b.seqs[queue]; ok {
+		return seq, nil
+	}
+	return b.start, nil
+}
+
+func (b *LocalBroker) Publish(ctx context.Context, queue ksuid.KSUID, msg *WSMessage, topics ...string) {
+	b.publishLock.Lock()
+	defer b.publishLock.Unlock()
+
+	b.seqsLock.Lock()
+	seq, ok := b.seqs[queue]
+	if !ok {
+		seq = b.start
+	}
+	seq++
+	b.seqs[queue] = seq
+	b.seqsLock.Unlock()
+
+	m := *msg
+	m.Seq = seq
+	b.replay.Add(queue, &m, topics...)
+	b.ps.Pub(&m, topics...)
+}
+
+func (b *LocalBroker) Subscribe(topics ...string) chan interface{} {
+	return b.ps.Sub(topics...)
+}
+
+func (b *LocalBroker) Unsubscribe(ch chan interface{}) {
+	b.ps.Unsub(ch)
+}
+
+func (b *LocalBroker) Replay(ctx context.Context, queue ksuid.KSUID, since uint64, topics ...string) ([]*WSMessage, bool, error) {
+	return b.replay.Since(queue, since, topics...)
+}
+
+func (b *LocalBroker) Connect(ctx context.Context, queue ksuid.KSUID, email string) (int, bool, error) {
+	b.websocketCountLock.Lock()
+	defer b.websocketCountLock.Unlock()
+
+	ws := b.websocketCount[queue]
+	ws++
+	b.websocketCount[queue] = ws
+
+	first := false
+	if email != "" {
+		e := b.websocketCountByEmail[queue]
+		if e == nil {
+			e = make(map[string]int)
+			b.websocketCountByEmail[queue] = e
+		}
+		first = e[email] == 0
+		e[email]++
+	}
+
+	return ws, first, nil
+}
+
+func (b *LocalBroker) Disconnect(ctx context.Context, queue ksuid.KSUID, email string) (int, bool, error) {
+	b.websocketCountLock.Lock()
+	defer b.websocketCountLock.Unlock()
+
+	ws := b.websocketCount[queue]
+	ws--
+	b.websocketCount[queue] = ws
+
+	last := false
+	if email != "" {
+		e := b.websocketCountByEmail[queue]
+		last = e[email] == 1
+		e[email]--
+		if last {
+			delete(e, email)
+		}
+	}
+
+	return ws, last, nil
+}
+
+func (b *LocalBroker) Online(ctx context.Context, queue ksuid.KSUID) ([]string, error) {
+	b.websocketCountLock.Lock()
+	defer b.websocketCountLock.Unlock()
+
+	m := make([]string, 0, len(b.websocketCountByEmail[queue]))
+	for e := range b.websocketCountByEmail[queue] {
+		m = append(m, e)
+	}
+	sort.Strings(m)
+	return m, nil
+}
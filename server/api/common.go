@@ -27,7 +27,11 @@ func (s StatusError) Error() string { return s.message }
 func (e E) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	err := e(w, r)
 	if err != nil {
-		*(r.Context().Value(RequestErrorContextKey).(*error)) = err
+		// Handlers outside of a transaction (like metrics) have nothing
+		// to roll back.
+		if p, ok := r.Context().Value(RequestErrorContextKey).(*error); ok {
+			*p = err
+		}
 		if errors.Is(err, context.Canceled) {
 			// Custom nginx response code indicating client close.
 			// The client won't actually receive this (since they
@@ -110,18 +114,107 @@ func (s *Server) sendResponse(code int, data interface{}, w http.ResponseWriter,
 	return err
 }
 
-func CurrentHalfHour() int {
-	return (time.Now().Hour()*60 + time.Now().Minute()) / 30
+// CurrentHalfHour returns the index of the current half hour of the day
+// in loc.
+func CurrentHalfHour(loc *time.Location) int {
+	return HalfHour(time.Now(), loc)
+}
+
+// HalfHour returns the index of the half hour of the day t is in, in loc,
+// matching the characters of a schedule string.
+func HalfHour(t time.Time, loc *time.Location) int {
+	t = t.In(loc)
+	return (t.Hour()*60 + t.Minute()) / 30
+}
+
+// CurrentMinute returns the current minute of the day in loc, matching the
+// starts and ends of schedule intervals.
+func CurrentMinute(loc *time.Location) int {
+	t := time.Now().In(loc)
+	return t.Hour()*60 + t.Minute()
+}
+
+// DateFormat is the format of calendar dates, like those of schedule
+// overrides.
+const DateFormat = "2006-01-02"
+
+// CurrentDate returns today's date in loc.
+func CurrentDate(loc *time.Location) string {
+	return time.Now().In(loc).Format(DateFormat)
+}
+
+// CurrentWeekday returns today's day of the week in loc, matching the
+// days of schedules.
+func CurrentWeekday(loc *time.Location) int {
+	return int(time.Now().In(loc).Weekday())
+}
+
+// parseTime reads a time from a query parameter, either as a full
+// RFC 3339 timestamp or as a date in loc.
+func parseTime(v string, loc *time.Location) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, v)
+	if err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation(DateFormat, v, loc)
+}
+
+// timeRange reads the from and to query parameters of r, with dates
+// taken to be in loc. to defaults to
+// now, and from to defaultRange before to, or to the beginning of time if
+// defaultRange is zero. Since ranges are mostly used to look up queue
+// entries by ID, they're kept to the times a KSUID can represent.
+func timeRange(r *http.Request, defaultRange time.Duration, loc *time.Location) (from, to time.Time, err error) {
+	to = time.Now()
+	if v := r.URL.Query().Get("to"); v != "" {
+		to, err = parseTime(v, loc)
+		if err != nil {
+			return from, to, StatusError{
+				http.StatusBadRequest,
+				"I couldn't read the `to` time. Try a date like 2021-01-31 or a full RFC 3339 timestamp.",
+			}
+		}
+	}
+
+	from = ksuid.Nil.Time()
+	if defaultRange != 0 {
+		from = to.Add(-defaultRange)
+	}
+	if v := r.URL.Query().Get("from"); v != "" {
+		from, err = parseTime(v, loc)
+		if err != nil {
+			return from, to, StatusError{
+				http.StatusBadRequest,
+				"I couldn't read the `from` time. Try a date like 2021-01-31 or a full RFC 3339 timestamp.",
+			}
+		}
+	}
+
+	if from.Before(ksuid.Nil.Time()) {
+		from = ksuid.Nil.Time()
+	}
+	if to.After(ksuid.Max.Time()) {
+		to = ksuid.Max.Time()
+	}
+
+	if !from.Before(to) {
+		return from, to, StatusError{
+			http.StatusBadRequest,
+			"The `from` time needs to be before the `to` time.",
+		}
+	}
+
+	return from, to, nil
 }
 
 // WeekdayBounds gets the bounds of the specified
-// day of the week in the local time zone. start is the first instant
+// day of the week in loc. start is the first instant
 // of the day, and end is the last nanosecond of the day.
 // If the value of day is less than the current day, it is
 // assumed to represent the day in the next week.
-func WeekdayBounds(day int) (start time.Time, end time.Time) {
-	currentDay := time.Now().Local().Weekday()
-	difference := day - int(currentDay)
+func WeekdayBounds(day int, loc *time.Location) (start time.Time, end time.Time) {
+	now := time.Now().In(loc)
+	difference := day - int(now.Weekday())
 
 	// If difference is negative, it's next week
 	if difference < 0 {
@@ -129,19 +222,19 @@ func WeekdayBounds(day int) (start time.Time, end time.Time) {
 	}
 
 	// Get the absolute day value in the month
-	day = time.Now().Local().Day() + difference
+	day = now.Day() + difference
 
-	start = time.Date(time.Now().Local().Year(), time.Now().Month(), day, 0, 0, 0, 0, time.Local)
-	end = time.Date(time.Now().Local().Year(), time.Now().Month(), day+1, 0, 0, 0, -1, time.Local)
+	start = time.Date(now.Year(), now.Month(), day, 0, 0, 0, 0, loc)
+	end = time.Date(now.Year(), now.Month(), day+1, 0, 0, 0, -1, loc)
 	return
 }
 
-// TimeslotToTime converts an appointment timeslot number to its time.
+// TimeslotToTime converts an appointment timeslot number to its time in loc.
 // Takes daylight savings time into account (i.e. it gives the "normal" time,
 // rather than just the index of the timeslot in the day in terms of minutes)
-func TimeslotToTime(day, timeslot, duration int) time.Time {
-	start, _ := WeekdayBounds(day)
-	return time.Date(start.Year(), start.Month(), start.Day(), (timeslot*duration)/60, (timeslot*duration)%60, 0, 0, start.Local().Location())
+func TimeslotToTime(day, timeslot, duration int, loc *time.Location) time.Time {
+	start, _ := WeekdayBounds(day, loc)
+	return time.Date(start.Year(), start.Month(), start.Day(), (timeslot*duration)/60, (timeslot*duration)%60, 0, 0, loc)
 }
 
 // BigTime returns (roughly) the maximum time representable by PostgreSQL.
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// Config is how a server is set up for where it's deployed.
+type Config struct {
+	// SessionsKey signs session cookies.
+	SessionsKey []byte
+
+	// SecureCookies only sends session cookies over HTTPS.
+	SecureCookies bool
+
+	// MetricsPassword is what Prometheus has to give to scrape /metrics.
+	MetricsPassword string
+
+	// ValidDomain is the comma-separated list of domains whose users
+	// count as in every course's allowed list; see parseValidDomains.
+	ValidDomain string
+
+	// BaseURL is where the queue is served from, for links in emails and
+	// the like.
+	BaseURL string
+
+	// BehindProxy takes client addresses from X-Forwarded-For.
+	BehindProxy bool
+
+	// RateLimits overrides the default rate limits, by name (entries,
+	// messages or announcements) for the per-user limit, and by name with
+	// an _ip suffix for the per-address limit.
+	RateLimits map[string]string
+}
+
+// rateLimitNames are the rate limits that can be set in a Config.
+var rateLimitNames = []string{"entries", "messages", "announcements"}
+
+// ConfigFromEnv reads a Config from the environment variables the deploy
+// files set.
+func ConfigFromEnv() (Config, error) {
+	key, err := ioutil.ReadFile(os.Getenv("QUEUE_SESSIONS_KEY_FILE"))
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to load sessions key: %w", err)
+	}
+
+	metricsPassword, err := ioutil.ReadFile(os.Getenv("METRICS_PASSWORD_FILE"))
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to load metrics password: %w", err)
+	}
+
+	rateLimits := make(map[string]string)
+	for _, name := range rateLimitNames {
+		env := "QUEUE_RATE_LIMIT_" + strings.ToUpper(name)
+		if v := os.Getenv(env); v != "" {
+			rateLimits[name] = v
+		}
+		if v := os.Getenv(env + "_IP"); v != "" {
+			rateLimits[name+"_ip"] = v
+		}
+	}
+
+	return Config{
+		SessionsKey:     key,
+		SecureCookies:   os.Getenv("USE_SECURE_COOKIES") == "true",
+		MetricsPassword: string(metricsPassword),
+		ValidDomain:     os.Getenv("QUEUE_VALID_DOMAIN"),
+		BaseURL:         os.Getenv("QUEUE_BASE_URL"),
+		BehindProxy:     os.Getenv("QUEUE_BEHIND_PROXY") == "true",
+		RateLimits:      rateLimits,
+	}, nil
+}
@@ -67,11 +67,10 @@ func (s *Server) CourseIDMiddleware(gc getCourse) func(http.Handler) http.Handle
 
 const courseAdminContextKey = "course_admin"
 
-type courseAdmin interface {
-	CourseAdmin(ctx context.Context, course ksuid.KSUID, email string) (bool, error)
-}
-
-func (s *Server) CheckCourseAdmin(ca courseAdmin) func(http.Handler) http.Handler {
+// CheckCourseAdmin looks up the user's role in the course (or the queue's
+// course), and whether they're on its staff at all, which is enough to see
+// the staff's view of things.
+func (s *Server) CheckCourseAdmin(cr courseRole) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			var courseID ksuid.KSUID
@@ -83,16 +82,31 @@ func (s *Server) CheckCourseAdmin(ca courseAdmin) func(http.Handler) http.Handle
 				courseID = q.Course
 			}
 
+			if !apiTokenAllowedIn(r, courseID) {
+				s.logger.Warnw("course-scoped API token used in other course",
+					RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+					"course_id", courseID,
+					"email", r.Context().Value(emailContextKey),
+				)
+				s.errorMessage(
+					http.StatusForbidden,
+					"That API token can only be used in its course.",
+					w, r,
+				)
+				return
+			}
+
 			email, ok := r.Context().Value(emailContextKey).(string)
 			if !ok {
 				ctx := context.WithValue(r.Context(), courseAdminContextKey, false)
+				ctx = context.WithValue(ctx, courseRoleContextKey, CourseRole(""))
 				next.ServeHTTP(w, r.WithContext(ctx))
 				return
 			}
 
-			admin, err := ca.CourseAdmin(r.Context(), courseID, email)
+			role, err := cr.CourseRole(r.Context(), courseID, email)
 			if err != nil {
-				s.logger.Errorw("failed to check course admin status",
+				s.logger.Errorw("failed to check course role",
 					RequestIDContextKey, r.Context().Value(RequestIDContextKey),
 					"course_id", courseID,
 					"email", email,
@@ -102,12 +116,15 @@ func (s *Server) CheckCourseAdmin(ca courseAdmin) func(http.Handler) http.Handle
 				return
 			}
 
-			ctx := context.WithValue(r.Context(), courseAdminContextKey, admin)
+			ctx := context.WithValue(r.Context(), courseAdminContextKey, role.Valid())
+			ctx = context.WithValue(ctx, courseRoleContextKey, role)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
+// EnsureCourseAdmin only lets through members of the course's staff, in
+// any role; see EnsureCourseRole for anything that changes things.
 func (s *Server) EnsureCourseAdmin(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var courseID ksuid.KSUID
@@ -193,7 +210,7 @@ func (s *Server) GetQueues(gq getQueues) E {
 }
 
 type addCourse interface {
-	AddCourse(ctx context.Context, shortName, fullName string) (*Course, error)
+	AddCourse(ctx context.Context, shortName, fullName, timeZone string) (*Course, error)
 }
 
 func (s *Server) AddCourse(ac addCourse) E {
@@ -222,7 +239,18 @@ func (s *Server) AddCourse(ac addCourse) E {
 			}
 		}
 
-		newCourse, err := ac.AddCourse(r.Context(), course.ShortName, course.FullName)
+		if !validTimeZone(course.TimeZone) {
+			s.logger.Warnw("received course with invalid time zone",
+				RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+				"time_zone", course.TimeZone,
+			)
+			return StatusError{
+				http.StatusBadRequest,
+				"I don't know that time zone. Try one like America/Detroit.",
+			}
+		}
+
+		newCourse, err := ac.AddCourse(r.Context(), course.ShortName, course.FullName, course.TimeZone)
 		if err != nil {
 			s.logger.Errorw("failed to create course",
 				RequestIDContextKey, r.Context().Value(RequestIDContextKey),
@@ -241,7 +269,8 @@ func (s *Server) AddCourse(ac addCourse) E {
 }
 
 type updateCourse interface {
-	UpdateCourse(ctx context.Context, course ksuid.KSUID, shortName, fullName string) error
+	addAuditLogEntry
+	UpdateCourse(ctx context.Context, course ksuid.KSUID, shortName, fullName, timeZone string) error
 }
 
 func (s *Server) UpdateCourse(uc updateCourse) E {
@@ -272,7 +301,18 @@ func (s *Server) UpdateCourse(uc updateCourse) E {
 			}
 		}
 
-		err = uc.UpdateCourse(r.Context(), course.ID, bodyCourse.ShortName, bodyCourse.FullName)
+		if !validTimeZone(bodyCourse.TimeZone) {
+			s.logger.Warnw("received course with invalid time zone",
+				RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+				"time_zone", bodyCourse.TimeZone,
+			)
+			return StatusError{
+				http.StatusBadRequest,
+				"I don't know that time zone. Try one like America/Detroit.",
+			}
+		}
+
+		err = uc.UpdateCourse(r.Context(), course.ID, bodyCourse.ShortName, bodyCourse.FullName, bodyCourse.TimeZone)
 		if err != nil {
 			s.logger.Errorw("failed to update course",
 				RequestIDContextKey, r.Context().Value(RequestIDContextKey),
@@ -286,11 +326,31 @@ func (s *Server) UpdateCourse(uc updateCourse) E {
 			"course_id", course.ID,
 			"email", r.Context().Value(emailContextKey).(string),
 		)
+
+		// The time zone is in here too, which moves when every queue in
+		// the course opens and closes.
+		before := *course
+		before.Queues = nil
+		after := Course{
+			ID:        course.ID,
+			ShortName: bodyCourse.ShortName,
+			FullName:  bodyCourse.FullName,
+			TimeZone:  bodyCourse.TimeZone,
+		}
+		err = s.auditCourse(r.Context(), uc, course.ID, AuditCourseUpdate, "", &before, &after)
+		if err != nil {
+			s.logger.Errorw("failed to audit course update",
+				RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+				"err", err,
+			)
+			return err
+		}
 		return s.sendResponse(http.StatusNoContent, nil, w, r)
 	}
 }
 
 type deleteCourse interface {
+	addAuditLogEntry
 	DeleteCourse(ctx context.Context, course ksuid.KSUID) error
 }
 
@@ -313,11 +373,21 @@ func (s *Server) DeleteCourse(dc deleteCourse) E {
 			"course_id", course.ID,
 			"email", r.Context().Value(emailContextKey).(string),
 		)
+
+		err = s.auditCourse(r.Context(), dc, course.ID, AuditCourseRemove, "", course, nil)
+		if err != nil {
+			s.logger.Errorw("failed to audit course deletion",
+				RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+				"err", err,
+			)
+			return err
+		}
 		return s.sendResponse(http.StatusNoContent, nil, w, r)
 	}
 }
 
-const defaultQueueSchedule = "cccccccccccccccccccccccccccccccccccccccccccccccc"
+// New queues are closed all day until someone sets their schedule.
+var defaultQueueSchedule = DaySchedule{}
 
 var defaultAppointmentSchedule = &AppointmentSchedule{
 	Duration: 15,
@@ -326,8 +396,9 @@ var defaultAppointmentSchedule = &AppointmentSchedule{
 }
 
 type addQueue interface {
+	addAuditLogEntry
 	AddQueue(ctx context.Context, course ksuid.KSUID, queue *Queue) (*Queue, error)
-	AddQueueSchedule(ctx context.Context, queue ksuid.KSUID, day int, schedule string) error
+	AddQueueSchedule(ctx context.Context, queue ksuid.KSUID, day int, schedule DaySchedule) error
 	AddAppointmentSchedule(ctx context.Context, queue ksuid.KSUID, day int, schedule *AppointmentSchedule) error
 }
 
@@ -375,6 +446,12 @@ func (s *Server) AddQueue(aq addQueue) E {
 			"email", r.Context().Value(emailContextKey).(string),
 		)
 
+		err = s.auditQueue(r.Context(), aq, newQueue, AuditQueueAdd, "", nil, newQueue)
+		if err != nil {
+			l.Errorw("failed to audit queue creation", "err", err)
+			return err
+		}
+
 		for day := 0; day < 7; day++ {
 			err = aq.AddQueueSchedule(r.Context(), newQueue.ID, day, defaultQueueSchedule)
 			if err != nil {
@@ -402,7 +479,7 @@ func (s *Server) AddQueue(aq addQueue) E {
 }
 
 type getCourseAdmins interface {
-	GetCourseAdmins(ctx context.Context, course ksuid.KSUID) ([]string, error)
+	GetCourseAdmins(ctx context.Context, course ksuid.KSUID) ([]*CourseAdmin, error)
 }
 
 func (s *Server) GetCourseAdmins(ga getCourseAdmins) E {
@@ -424,7 +501,9 @@ func (s *Server) GetCourseAdmins(ga getCourseAdmins) E {
 }
 
 type addCourseAdmins interface {
-	AddCourseAdmins(ctx context.Context, course ksuid.KSUID, admins []string, overwrite bool) error
+	addAuditLogEntry
+	getCourseAdmins
+	AddCourseAdmins(ctx context.Context, course ksuid.KSUID, admins []*CourseAdmin, overwrite bool) error
 }
 
 func (s *Server) AddCourseAdmins(aa addCourseAdmins) E {
@@ -437,16 +516,28 @@ func (s *Server) AddCourseAdmins(aa addCourseAdmins) E {
 			"email", email,
 		)
 
-		var admins []string
+		var admins []*CourseAdmin
 		err := json.NewDecoder(r.Body).Decode(&admins)
 		if err != nil {
 			l.Warnw("failed to decode admins from body", "err", err)
 			return StatusError{
 				http.StatusBadRequest,
-				"I couldn't decode the body. Are you sure it's a JSON array of emails (strings)? This error might help: " + err.Error(),
+				"I couldn't decode the body. Are you sure it's a JSON array of emails (strings) or objects with an email and role? This error might help: " + err.Error(),
 			}
 		}
 
+		before, err := aa.GetCourseAdmins(r.Context(), c.ID)
+		if err != nil {
+			l.Errorw("failed to get course admins", "err", err)
+			return err
+		}
+
+		err = resolveCourseAdmins(admins, before)
+		if err != nil {
+			l.Warnw("got invalid admins", "err", err)
+			return err
+		}
+
 		err = aa.AddCourseAdmins(r.Context(), c.ID, admins, false)
 		var pqerr *pq.Error
 		if errors.As(err, &pqerr) && pqerr.Code == "23505" {
@@ -461,6 +552,18 @@ func (s *Server) AddCourseAdmins(aa addCourseAdmins) E {
 		}
 
 		l.Infow("added admins", "admins", admins)
+
+		after, err := aa.GetCourseAdmins(r.Context(), c.ID)
+		if err != nil {
+			l.Errorw("failed to get course admins", "err", err)
+			return err
+		}
+
+		err = s.auditCourse(r.Context(), aa, c.ID, AuditAdminsAdd, "", before, after)
+		if err != nil {
+			l.Errorw("failed to audit admin change", "err", err)
+			return err
+		}
 		return s.sendResponse(http.StatusNoContent, nil, w, r)
 	}
 }
@@ -475,16 +578,28 @@ func (s *Server) UpdateCourseAdmins(aa addCourseAdmins) E {
 			"email", email,
 		)
 
-		var admins []string
+		var admins []*CourseAdmin
 		err := json.NewDecoder(r.Body).Decode(&admins)
 		if err != nil {
 			l.Warnw("failed to decode admins from body", "err", err)
 			return StatusError{
 				http.StatusBadRequest,
-				"I couldn't decode the body. Are you sure it's a JSON array of emails (strings)? This error might help: " + err.Error(),
+				"I couldn't decode the body. Are you sure it's a JSON array of emails (strings) or objects with an email and role? This error might help: " + err.Error(),
 			}
 		}
 
+		before, err := aa.GetCourseAdmins(r.Context(), c.ID)
+		if err != nil {
+			l.Errorw("failed to get course admins", "err", err)
+			return err
+		}
+
+		err = resolveCourseAdmins(admins, before)
+		if err != nil {
+			l.Warnw("got invalid admins", "err", err)
+			return err
+		}
+
 		err = aa.AddCourseAdmins(r.Context(), c.ID, admins, true)
 		if err != nil {
 			l.Errorw("failed to update course admins", "err", err)
@@ -492,11 +607,25 @@ func (s *Server) UpdateCourseAdmins(aa addCourseAdmins) E {
 		}
 
 		l.Infow("overwrote admins", "admins", admins)
+
+		after, err := aa.GetCourseAdmins(r.Context(), c.ID)
+		if err != nil {
+			l.Errorw("failed to get course admins", "err", err)
+			return err
+		}
+
+		err = s.auditCourse(r.Context(), aa, c.ID, AuditAdminsUpdate, "", before, after)
+		if err != nil {
+			l.Errorw("failed to audit admin change", "err", err)
+			return err
+		}
 		return s.sendResponse(http.StatusNoContent, nil, w, r)
 	}
 }
 
 type removeCourseAdmins interface {
+	addAuditLogEntry
+	getCourseAdmins
 	RemoveCourseAdmins(ctx context.Context, course ksuid.KSUID, admins []string) error
 }
 
@@ -510,23 +639,46 @@ func (s *Server) RemoveCourseAdmins(ra removeCourseAdmins) E {
 			"email", email,
 		)
 
-		var admins []string
+		var admins []*CourseAdmin
 		err := json.NewDecoder(r.Body).Decode(&admins)
 		if err != nil {
 			l.Warnw("failed to decode admins from body", "err", err)
 			return StatusError{
 				http.StatusBadRequest,
-				"I couldn't decode the body. Are you sure it's a JSON array of emails (strings)? This error might help: " + err.Error(),
+				"I couldn't decode the body. Are you sure it's a JSON array of emails (strings) or objects with an email and role? This error might help: " + err.Error(),
 			}
 		}
 
-		err = ra.RemoveCourseAdmins(r.Context(), c.ID, admins)
+		before, err := ra.GetCourseAdmins(r.Context(), c.ID)
+		if err != nil {
+			l.Errorw("failed to get course admins", "err", err)
+			return err
+		}
+
+		emails := make([]string, 0, len(admins))
+		for _, a := range admins {
+			emails = append(emails, a.Email)
+		}
+
+		err = ra.RemoveCourseAdmins(r.Context(), c.ID, emails)
 		if err != nil {
 			l.Errorw("failed to remove admins", "err", err)
 			return err
 		}
 
-		l.Infow("removed admins", "admins", admins)
+		l.Infow("removed admins", "admins", emails)
+
+		after, err := ra.GetCourseAdmins(r.Context(), c.ID)
+		if err != nil {
+			l.Errorw("failed to get course admins", "err", err)
+			return err
+		}
+
+		err = s.auditCourse(r.Context(), ra, c.ID, AuditAdminsRemove, "", before, after)
+		if err != nil {
+			l.Errorw("failed to audit admin change", "err", err)
+			return err
+		}
 		return s.sendResponse(http.StatusNoContent, nil, w, r)
 	}
 }
@@ -0,0 +1,58 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/CarsonHoffman/office-hours-queue/server/api"
+)
+
+func TestAuditCourse(t *testing.T) {
+	ts := newTestServer(t)
+	ts.store.AddSiteAdmin(testAdmin)
+
+	var course api.Course
+	ts.must(testAdmin, "POST", "/courses", map[string]string{
+		"short_name": "EECS 280",
+		"full_name":  "Programming and Introductory Data Structures",
+		"time_zone":  "UTC",
+	}, &course)
+	path := "/courses/" + course.ID.String()
+	ts.must(testAdmin, "PUT", path, map[string]string{
+		"short_name": "EECS 280",
+		"full_name":  "Programming and Introductory Data Structures",
+		"time_zone":  "America/Detroit",
+	}, nil)
+	ts.must(testAdmin, "DELETE", path, nil, nil)
+
+	// The course's log outlives it, but not its routes.
+	tx, err := ts.store.BeginTx()
+	if err != nil {
+		t.Fatalf("failed to begin transaction: %v", err)
+	}
+	log, err := ts.store.GetAuditLog(context.WithValue(context.Background(), api.TransactionContextKey, tx), &api.AuditLogFilter{Course: course.ID, Limit: 10})
+	tx.Rollback()
+	if err != nil {
+		t.Fatalf("failed to get audit log: %v", err)
+	}
+
+	var actions []string
+	for _, e := range log {
+		actions = append(actions, e.Action)
+
+		if e.Action == api.AuditCourseUpdate {
+			var before, after api.Course
+			json.Unmarshal(e.Before, &before)
+			json.Unmarshal(e.After, &after)
+			if before.TimeZone != "UTC" || after.TimeZone != "America/Detroit" {
+				t.Errorf("course update went from time zone %q to %q, want UTC to America/Detroit", before.TimeZone, after.TimeZone)
+			}
+		}
+	}
+
+	// Newest first.
+	if len(actions) != 2 || actions[0] != api.AuditCourseRemove || actions[1] != api.AuditCourseUpdate {
+		t.Errorf("got course audit log %v, want [%s %s]", actions, api.AuditCourseRemove, api.AuditCourseUpdate)
+	}
+}
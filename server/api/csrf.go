@@ -0,0 +1,77 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// safeMethod is whether requests with method can't change anything, and
+// so don't need to be checked for forgery.
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// sameOrigin is whether r was made by a page on the queue itself. Browsers
+// tell us outright with Sec-Fetch-Site; ones that don't still send Origin
+// on anything but a GET, and Referer as a last resort. A request with
+// none of them didn't come from a browser we can trust with a cookie.
+func (s *Server) sameOrigin(r *http.Request) bool {
+	if site := r.Header.Get("Sec-Fetch-Site"); site != "" {
+		return site == "same-origin"
+	}
+
+	source := r.Header.Get("Origin")
+	if source == "" || source == "null" {
+		source = r.Header.Get("Referer")
+	}
+	if source == "" {
+		return false
+	}
+
+	u, err := url.Parse(source)
+	if err != nil || u.Host == "" {
+		return false
+	}
+
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+
+	// The base URL is usually just a path, but it's the queue's real
+	// address when it isn't, whatever the Host header says.
+	base, err := url.Parse(s.baseURL)
+	return err == nil && base.Host != "" && strings.EqualFold(u.Host, base.Host)
+}
+
+// CSRFMiddleware refuses requests that could change something and that
+// came from another site with the user's session cookie in tow. Requests
+// made with an API token have no cookie to ride on, so they're let
+// through; other Authorization headers (like Basic auth) can be sent by
+// the browser on its own, so they aren't.
+func (s *Server) CSRFMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if safeMethod(r.Method) || hasAPIToken(r) || s.sameOrigin(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		s.logger.Warnw("rejected cross-site request",
+			RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+			"method", r.Method,
+			"path", r.URL.Path,
+			"origin", r.Header.Get("Origin"),
+			"referer", r.Header.Get("Referer"),
+			"sec_fetch_site", r.Header.Get("Sec-Fetch-Site"),
+		)
+		s.errorMessage(
+			http.StatusForbidden,
+			"That request didn't come from the queue, so I'm not going to do it.",
+			w, r,
+		)
+	})
+}
@@ -0,0 +1,189 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/segmentio/ksuid"
+)
+
+// Why a user can't sign up for a queue right now.
+const (
+	IneligibleAlreadyInQueue  = "already_in_queue"
+	IneligibleClosed          = "closed"
+	IneligibleNotInRoster     = "not_in_roster"
+	IneligibleTeammateInQueue = "teammate_in_queue"
+	IneligibleCooldown        = "cooldown"
+)
+
+// IneligibilityReason is one thing stopping a user from signing up.
+// Message reads as the end of a sentence ("the queue is closed").
+type IneligibilityReason struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// SignupEligibility is whether a user can sign up for a queue right now,
+// and everything that went into deciding it. Staff can sign up whenever
+// they aren't already on the queue; everyone else is held to the queue's
+// configuration. Reasons lists everything stopping them, not just the
+// first thing.
+type SignupEligibility struct {
+	Eligible bool `json:"eligible"`
+	Staff    bool `json:"staff"`
+	Open     bool `json:"open"`
+
+	AlreadyInQueue  bool `json:"already_in_queue"`
+	RosterRequired  bool `json:"roster_required"`
+	InRoster        bool `json:"in_roster"`
+	TeammateInQueue bool `json:"teammate_in_queue"`
+
+	// How many seconds until the user's cooldown since they were last
+	// helped runs out.
+	CooldownRemaining int `json:"cooldown_remaining"`
+
+	// The priority the user's entry would get.
+	Priority int `json:"priority"`
+
+	Reasons []*IneligibilityReason `json:"reasons"`
+}
+
+func (e *SignupEligibility) block(code, message string) {
+	e.Eligible = false
+	e.Reasons = append(e.Reasons, &IneligibilityReason{code, message})
+}
+
+type getSignupEligibility interface {
+	courseRole
+	getQueueConfiguration
+	getCurrentDaySchedule
+	getActiveQueueEntriesForUser
+	UserInQueueRoster(ctx context.Context, queue ksuid.KSUID, email string) (bool, error)
+	TeammateInQueue(ctx context.Context, queue ksuid.KSUID, email string) (bool, error)
+	LastHelpedTime(ctx context.Context, queue ksuid.KSUID, email string) (sql.NullTime, error)
+	GetEntryPriority(ctx context.Context, queue ksuid.KSUID, email string) (int, error)
+}
+
+// signupEligibility works out whether email can sign up for q.
+func (s *Server) signupEligibility(ctx context.Context, ge getSignupEligibility, q *Queue, email string) (*SignupEligibility, error) {
+	e := &SignupEligibility{
+		Eligible: true,
+		Reasons:  make([]*IneligibilityReason, 0),
+	}
+
+	role, err := ge.CourseRole(ctx, q.Course, email)
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine role in course: %w", err)
+	}
+	e.Staff = role.AtLeast(RoleTA)
+
+	config, err := ge.GetQueueConfiguration(ctx, q.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get queue configuration: %w", err)
+	}
+
+	if config.Scheduled {
+		schedule, err := ge.GetCurrentDaySchedule(ctx, q.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get queue schedule: %w", err)
+		}
+		e.Open = schedule.At(CurrentMinute(q.Zone())) != 'c'
+	} else {
+		e.Open = config.ManualOpen
+	}
+
+	entries, err := ge.GetActiveQueueEntriesForUser(ctx, q.ID, email)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current queue entries: %w", err)
+	}
+	e.AlreadyInQueue = len(entries) > 0
+
+	e.RosterRequired = config.PreventUnregistered
+	e.InRoster, err = ge.UserInQueueRoster(ctx, q.ID, email)
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine roster status in queue: %w", err)
+	}
+
+	if config.PreventGroups {
+		e.TeammateInQueue, err = ge.TeammateInQueue(ctx, q.ID, email)
+		if err != nil {
+			return nil, fmt.Errorf("failed to determine teammate status in queue: %w", err)
+		}
+	}
+
+	last, err := ge.LastHelpedTime(ctx, q.ID, email)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get last helped time: %w", err)
+	}
+	if last.Valid {
+		wait := time.Until(last.Time.Add(time.Second * time.Duration(config.Cooldown)))
+		if wait > 0 {
+			// Round up, or the last part of a second would be no cooldown
+			// at all.
+			e.CooldownRemaining = int(math.Ceil(wait.Seconds()))
+		}
+	}
+
+	e.Priority, err = ge.GetEntryPriority(ctx, q.ID, email)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get entry priority: %w", err)
+	}
+
+	if e.AlreadyInQueue {
+		e.block(IneligibleAlreadyInQueue, "you're already on the queue")
+	}
+
+	if e.Staff {
+		return e, nil
+	}
+
+	if !e.Open {
+		e.block(IneligibleClosed, "the queue is closed")
+	}
+	if e.RosterRequired && !e.InRoster {
+		e.block(IneligibleNotInRoster, "you are not in the course roster")
+	}
+	if e.TeammateInQueue {
+		e.block(IneligibleTeammateInQueue, "your teammate is in the queue")
+	}
+	if e.CooldownRemaining > 0 {
+		msg := "you are attempting to sign up too soon after you were last helped. Try again in "
+		switch minutes := e.CooldownRemaining / 60; minutes {
+		case 0:
+			msg += fmt.Sprintf("%d seconds", e.CooldownRemaining)
+		case 1:
+			msg += "a minute"
+		default:
+			msg += fmt.Sprintf("%d minutes", minutes)
+		}
+		e.block(IneligibleCooldown, msg)
+	}
+
+	return e, nil
+}
+
+// GetSignupEligibility tells the user whether they can sign up for the
+// queue right now, before they go to the trouble of filling out an entry.
+func (s *Server) GetSignupEligibility(ge getSignupEligibility) E {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		q := r.Context().Value(queueContextKey).(*Queue)
+		email := r.Context().Value(emailContextKey).(string)
+
+		eligibility, err := s.signupEligibility(r.Context(), ge, q, email)
+		if err != nil {
+			s.logger.Errorw("failed to determine sign up eligibility",
+				RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+				"queue_id", q.ID,
+				"email", email,
+				"err", err,
+			)
+			return err
+		}
+
+		return s.sendResponse(http.StatusOK, eligibility, w, r)
+	}
+}
@@ -0,0 +1,404 @@
+package api
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/segmentio/ksuid"
+)
+
+// How many records are written between flushes to the client.
+const exportFlushInterval = 100
+
+type exportRecord interface {
+	csvRecord() []string
+}
+
+// exporter streams records to the client as either CSV or JSON lines,
+// depending on the request's format query parameter. Nothing is sent
+// until the first record (or finish), so that errors before then can
+// still get a proper response.
+type exporter struct {
+	w        http.ResponseWriter
+	filename string
+	header   []string
+
+	csv     *csv.Writer
+	json    *json.Encoder
+	started bool
+	written int
+}
+
+func newExporter(w http.ResponseWriter, r *http.Request, name string, header []string) (*exporter, error) {
+	e := &exporter{w: w, header: header}
+	switch r.URL.Query().Get("format") {
+	case "", "csv":
+		e.filename = name + ".csv"
+		e.csv = csv.NewWriter(w)
+	case "jsonl":
+		e.filename = name + ".jsonl"
+		e.json = json.NewEncoder(w)
+	default:
+		return nil, StatusError{
+			http.StatusBadRequest,
+			"I can only export as `csv` or `jsonl`.",
+		}
+	}
+	return e, nil
+}
+
+func (e *exporter) start() error {
+	if e.started {
+		return nil
+	}
+	e.started = true
+
+	if e.csv != nil {
+		e.w.Header().Set("Content-Type", "text/csv")
+	} else {
+		e.w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	e.w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, e.filename))
+	e.w.WriteHeader(http.StatusOK)
+
+	if e.csv != nil {
+		return e.csv.Write(e.header)
+	}
+	return nil
+}
+
+func (e *exporter) write(record exportRecord) error {
+	err := e.start()
+	if err != nil {
+		return err
+	}
+
+	if e.csv != nil {
+		err = e.csv.Write(record.csvRecord())
+	} else {
+		err = e.json.Encode(record)
+	}
+	if err != nil {
+		return err
+	}
+
+	e.written++
+	if e.written%exportFlushInterval == 0 {
+		return e.flush()
+	}
+	return nil
+}
+
+func (e *exporter) flush() error {
+	if e.csv != nil {
+		e.csv.Flush()
+		if err := e.csv.Error(); err != nil {
+			return err
+		}
+	}
+	if f, ok := e.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+func (e *exporter) finish() error {
+	err := e.start()
+	if err != nil {
+		return err
+	}
+	return e.flush()
+}
+
+// exportTime formats t for exports, or leaves it blank if it's nil.
+func exportTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// csvCell keeps s from being taken as a formula when the export is
+// opened in a spreadsheet, by putting a ' in front of anything starting
+// with a character that would make it one. Only CSV needs this; JSON
+// lines get the text as it is.
+func csvCell(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+type entryExport struct {
+	Queue        ksuid.KSUID `json:"queue"`
+	ID           ksuid.KSUID `json:"id"`
+	Email        string      `json:"email"`
+	Name         string      `json:"name"`
+	Description  string      `json:"description"`
+	Location     string      `json:"location"`
+	CreatedAt    time.Time   `json:"created_at"`
+	RemovedAt    *time.Time  `json:"removed_at"`
+	RemovedBy    *string     `json:"removed_by"`
+	Helped       bool        `json:"helped"`
+	HelpingBy    *string     `json:"helping_by"`
+	HelpingSince *time.Time  `json:"helping_since"`
+}
+
+var entryExportHeader = []string{
+	"queue", "id", "email", "name", "description", "location",
+	"created_at", "removed_at", "removed_by", "helped", "helping_by", "helping_since",
+}
+
+// newEntryExport gets e ready to export, with its times in loc.
+func newEntryExport(e *QueueEntry, loc *time.Location) *entryExport {
+	x := &entryExport{
+		Queue:        e.Queue,
+		ID:           e.ID,
+		Email:        e.Email,
+		Name:         e.Name,
+		Description:  e.Description,
+		Location:     e.Location,
+		CreatedAt:    e.ID.Time().In(loc),
+		HelpingBy:    e.HelpingBy,
+		HelpingSince: e.HelpingSince,
+	}
+
+	// Entries that are still on the queue haven't been helped yet,
+	// whatever the column's default says.
+	if e.RemovedAt.Valid {
+		removedAt := e.RemovedAt.Time.In(loc)
+		x.RemovedAt = &removedAt
+		x.RemovedBy = &e.RemovedBy.String
+		x.Helped = e.Helped
+	}
+	if x.HelpingSince != nil {
+		helpingSince := x.HelpingSince.In(loc)
+		x.HelpingSince = &helpingSince
+	}
+
+	return x
+}
+
+func (x *entryExport) csvRecord() []string {
+	var removedBy, helpingBy string
+	if x.RemovedBy != nil {
+		removedBy = *x.RemovedBy
+	}
+	if x.HelpingBy != nil {
+		helpingBy = *x.HelpingBy
+	}
+
+	return []string{
+		x.Queue.String(),
+		x.ID.String(),
+		csvCell(x.Email),
+		csvCell(x.Name),
+		csvCell(x.Description),
+		csvCell(x.Location),
+		exportTime(&x.CreatedAt),
+		exportTime(x.RemovedAt),
+		csvCell(removedBy),
+		strconv.FormatBool(x.Helped),
+		csvCell(helpingBy),
+		exportTime(x.HelpingSince),
+	}
+}
+
+type appointmentExport struct {
+	Queue         ksuid.KSUID `json:"queue"`
+	ID            ksuid.KSUID `json:"id"`
+	ScheduledTime time.Time   `json:"scheduled_time"`
+	Duration      int         `json:"duration"`
+	StaffEmail    *string     `json:"staff_email"`
+	StudentEmail  *string     `json:"student_email"`
+	Name          *string     `json:"name"`
+	Description   *string     `json:"description"`
+	Location      *string     `json:"location"`
+}
+
+var appointmentExportHeader = []string{
+	"queue", "id", "scheduled_time", "duration",
+	"staff_email", "student_email", "name", "description", "location",
+}
+
+// newAppointmentExport gets a ready to export, with its time in loc.
+func newAppointmentExport(a *AppointmentSlot, loc *time.Location) *appointmentExport {
+	return &appointmentExport{
+		Queue:         a.Queue,
+		ID:            a.ID,
+		ScheduledTime: a.ScheduledTime.In(loc),
+		Duration:      a.Duration,
+		StaffEmail:    a.StaffEmail,
+		StudentEmail:  a.StudentEmail,
+		Name:          a.Name,
+		Description:   a.Description,
+		Location:      a.Location,
+	}
+}
+
+func (x *appointmentExport) csvRecord() []string {
+	str := func(s *string) string {
+		if s == nil {
+			return ""
+		}
+		return csvCell(*s)
+	}
+
+	return []string{
+		x.Queue.String(),
+		x.ID.String(),
+		exportTime(&x.ScheduledTime),
+		strconv.Itoa(x.Duration),
+		str(x.StaffEmail),
+		str(x.StudentEmail),
+		str(x.Name),
+		str(x.Description),
+		str(x.Location),
+	}
+}
+
+// exportQueues returns the queues an export request covers: the queue in
+// the URL, or all of the course's queues.
+func exportQueues(ctx context.Context, gq getQueues) ([]*Queue, string, error) {
+	if c, ok := ctx.Value(courseContextKey).(*Course); ok {
+		queues, err := gq.GetQueues(ctx, c.ID)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to get queues from course: %w", err)
+		}
+		return queues, "course-" + c.ID.String(), nil
+	}
+
+	q := ctx.Value(queueContextKey).(*Queue)
+	return []*Queue{q}, "queue-" + q.ID.String(), nil
+}
+
+type exportQueueEntries interface {
+	getQueues
+	ExportQueueEntries(ctx context.Context, queue ksuid.KSUID, from, to time.Time, f func(*QueueEntry) error) error
+}
+
+// ExportQueueEntries streams every entry that joined the queue (or any of
+// the course's queues) in the requested time range.
+func (s *Server) ExportQueueEntries(ee exportQueueEntries) E {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		email := r.Context().Value(emailContextKey).(string)
+		l := s.logger.With(
+			RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+			"email", email,
+		)
+
+		from, to, err := timeRange(r, 0, contextLocation(r.Context()))
+		if err != nil {
+			l.Warnw("failed to read time range", "err", err)
+			return err
+		}
+
+		queues, name, err := exportQueues(r.Context(), ee)
+		if err != nil {
+			l.Errorw("failed to get queues to export", "err", err)
+			return err
+		}
+
+		e, err := newExporter(w, r, name+"-entries", entryExportHeader)
+		if err != nil {
+			l.Warnw("unknown export format", "format", r.URL.Query().Get("format"))
+			return err
+		}
+
+		for _, q := range queues {
+			err = ee.ExportQueueEntries(r.Context(), q.ID, from, to, func(entry *QueueEntry) error {
+				return e.write(newEntryExport(entry, q.Zone()))
+			})
+			if err != nil {
+				l.Errorw("failed to export queue entries", "queue_id", q.ID, "err", err)
+				if e.started {
+					// Too late to tell the client anything useful.
+					return nil
+				}
+				return err
+			}
+		}
+
+		err = e.finish()
+		if err != nil {
+			l.Warnw("failed to finish export", "err", err)
+			return nil
+		}
+
+		l.Infow("exported queue entries", "export", name, "from", from, "to", to, "entries", e.written)
+		return nil
+	}
+}
+
+type exportAppointments interface {
+	getQueues
+	getAppointmentsInTimeFrame
+}
+
+// ExportAppointments streams every appointment slot scheduled on the
+// queue (or any of the course's queues) in the requested time range.
+func (s *Server) ExportAppointments(ea exportAppointments) E {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		email := r.Context().Value(emailContextKey).(string)
+		l := s.logger.With(
+			RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+			"email", email,
+		)
+
+		from, to, err := timeRange(r, 0, contextLocation(r.Context()))
+		if err != nil {
+			l.Warnw("failed to read time range", "err", err)
+			return err
+		}
+
+		queues, name, err := exportQueues(r.Context(), ea)
+		if err != nil {
+			l.Errorw("failed to get queues to export", "err", err)
+			return err
+		}
+
+		e, err := newExporter(w, r, name+"-appointments", appointmentExportHeader)
+		if err != nil {
+			l.Warnw("unknown export format", "format", r.URL.Query().Get("format"))
+			return err
+		}
+
+		for _, q := range queues {
+			if q.Type != Appointments {
+				continue
+			}
+
+			appointments, err := ea.GetAppointments(r.Context(), q.ID, from, to)
+			if err != nil {
+				l.Errorw("failed to get appointments", "queue_id", q.ID, "err", err)
+				if e.started {
+					return nil
+				}
+				return err
+			}
+
+			for _, a := range appointments {
+				err = e.write(newAppointmentExport(a, q.Zone()))
+				if err != nil {
+					l.Warnw("failed to write appointment", "err", err)
+					return nil
+				}
+			}
+		}
+
+		err = e.finish()
+		if err != nil {
+			l.Warnw("failed to finish export", "err", err)
+			return nil
+		}
+
+		l.Infow("exported appointments", "export", name, "from", from, "to", to, "appointments", e.written)
+		return nil
+	}
+}
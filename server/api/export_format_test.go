@@ -0,0 +1,48 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestExportFormulas(t *testing.T) {
+	ts := newTestServer(t)
+	q := ts.addQueue("ordered")
+	ts.openQueue(q, map[string]interface{}{})
+
+	const formula = `=HYPERLINK("https://example.com","help")`
+	ts.must("student@example.edu", "POST", "/queues/"+q+"/entries", map[string]string{
+		"description": formula,
+		"location":    "-1 floor",
+	}, nil)
+
+	b := ts.expect(http.StatusOK, testAdmin, "GET", "/queues/"+q+"/export/entries", nil)
+	records, err := csv.NewReader(bytes.NewReader(b)).ReadAll()
+	if err != nil {
+		t.Fatalf("failed to read CSV export: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("got %d CSV records, want a header and an entry", len(records))
+	}
+	if got := records[1][4]; got != "'"+formula {
+		t.Errorf("description exported to CSV as %q, want it escaped", got)
+	}
+	if got := records[1][5]; got != "'-1 floor" {
+		t.Errorf("location exported to CSV as %q, want it escaped", got)
+	}
+
+	b = ts.expect(http.StatusOK, testAdmin, "GET", "/queues/"+q+"/export/entries?format=jsonl", nil)
+	var entry struct {
+		Description string `json:"description"`
+	}
+	err = json.Unmarshal(b, &entry)
+	if err != nil {
+		t.Fatalf("failed to read JSON lines export: %v", err)
+	}
+	if entry.Description != formula {
+		t.Errorf("description exported to JSON lines as %q, want it as it was", entry.Description)
+	}
+}
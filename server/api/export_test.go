@@ -0,0 +1,10 @@
+package api
+
+import "context"
+
+// EndSession ends q's session the way the scheduler does when q closes.
+func (s *Server) EndSession(ws watchSchedules, q *Queue) error {
+	return s.inTransaction(ws, func(ctx context.Context) error {
+		return s.endSession(ctx, ws, q)
+	})
+}
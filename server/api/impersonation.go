@@ -0,0 +1,130 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// impersonatorContextKey holds the site admin behind a request made while
+// they're impersonating someone; the email and name context keys hold the
+// user they're impersonating.
+const impersonatorContextKey = "impersonator"
+
+// How long an impersonation session lasts before the site admin is back
+// to being themselves.
+const impersonationLifetime = time.Hour
+
+// ImpersonationHeader is set on every response to a request made while
+// impersonating, to the impersonated user's email.
+const ImpersonationHeader = "X-Impersonating"
+
+// impersonating returns who the session is impersonating, if anyone.
+func impersonating(values map[interface{}]interface{}) (string, bool) {
+	email, ok := values["impersonating"].(string)
+	if !ok || email == "" {
+		return "", false
+	}
+	until, ok := values["impersonating_until"].(int64)
+	if !ok || time.Now().Unix() >= until {
+		return "", false
+	}
+	return email, true
+}
+
+// StartImpersonation lets a site admin see the queue as someone else: their
+// session's read-only requests are made as that user until they stop (or
+// an hour passes). Anything that would change something is refused in the
+// meantime (see ValidLoginMiddleware).
+func (s *Server) StartImpersonation(al addAuditLogEntry) E {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		email := r.Context().Value(emailContextKey).(string)
+		l := s.logger.With(
+			RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+			"email", email,
+		)
+
+		var body struct {
+			Email string `json:"email"`
+		}
+		err := json.NewDecoder(r.Body).Decode(&body)
+		if err != nil {
+			l.Warnw("failed to decode impersonation from body", "err", err)
+			return StatusError{
+				http.StatusBadRequest,
+				"We couldn't read who to impersonate from the request body.",
+			}
+		}
+
+		target := strings.TrimSpace(body.Email)
+		if target == "" || target == email {
+			l.Warnw("got invalid impersonation target", "target", target)
+			return StatusError{
+				http.StatusBadRequest,
+				"Give me the email of someone other than yourself to impersonate.",
+			}
+		}
+
+		session, err := s.sessions.Get(r, "session")
+		if err != nil {
+			l.Errorw("failed to get session", "err", err)
+			return err
+		}
+
+		until := time.Now().Add(impersonationLifetime)
+		session.Values["impersonating"] = target
+		session.Values["impersonating_until"] = until.Unix()
+		err = s.sessions.Save(r, w, session)
+		if err != nil {
+			l.Errorw("failed to save session", "err", err)
+			return err
+		}
+
+		err = s.auditSite(r.Context(), al, AuditImpersonationStart, target, nil, nil)
+		if err != nil {
+			l.Errorw("failed to audit impersonation start", "err", err)
+			return err
+		}
+
+		l.Infow("started impersonation", "target", target, "until", until)
+		return s.sendResponse(http.StatusNoContent, nil, w, r)
+	}
+}
+
+// StopImpersonation ends the session's impersonation, if it has one. It
+// doesn't need a valid login, since all it can do is give the site admin
+// their own identity back.
+func (s *Server) StopImpersonation(al addAuditLogEntry) E {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		l := s.logger.With(RequestIDContextKey, r.Context().Value(RequestIDContextKey))
+
+		session, err := s.sessions.Get(r, "session")
+		if err != nil {
+			l.Warnw("got invalid session", "err", err)
+			return s.sendResponse(http.StatusNoContent, nil, w, r)
+		}
+
+		target, ok := session.Values["impersonating"].(string)
+		if !ok {
+			return s.sendResponse(http.StatusNoContent, nil, w, r)
+		}
+
+		delete(session.Values, "impersonating")
+		delete(session.Values, "impersonating_until")
+		err = s.sessions.Save(r, w, session)
+		if err != nil {
+			l.Errorw("failed to save session", "err", err)
+			return err
+		}
+
+		err = s.auditSite(r.Context(), al, AuditImpersonationStop, target, nil, nil)
+		if err != nil {
+			l.Errorw("failed to audit impersonation stop", "err", err)
+			return err
+		}
+
+		l.Infow("stopped impersonation", "email", session.Values["email"], "target", target)
+		return s.sendResponse(http.StatusNoContent, nil, w, r)
+	}
+}
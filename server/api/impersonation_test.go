@@ -0,0 +1,81 @@
+package api_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CarsonHoffman/office-hours-queue/server/api"
+	"github.com/segmentio/ksuid"
+)
+
+// impersonate logs testAdmin in as target, returning the session cookie.
+func (ts *testServer) impersonate(target string) *http.Cookie {
+	ts.t.Helper()
+	r, _ := http.NewRequest("POST", ts.srv.URL+"/users/@me/impersonation", strings.NewReader(`{"email":"`+target+`"}`))
+	r.Header.Set("Origin", ts.srv.URL)
+	r.AddCookie(ts.cookie(testAdmin))
+	resp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		ts.t.Fatalf("failed to start impersonation: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent || len(resp.Cookies()) != 1 {
+		ts.t.Fatalf("starting impersonation got %d with %d cookies", resp.StatusCode, len(resp.Cookies()))
+	}
+	return resp.Cookies()[0]
+}
+
+func TestImpersonatedStreamIsNotPresence(t *testing.T) {
+	ts := newTestServer(t)
+	q := ts.addQueue("ordered")
+	ts.openQueue(q, map[string]interface{}{})
+	const alice = "alice@example.edu"
+	ts.must(alice, "POST", "/queues/"+q+"/entries", testEntry, nil)
+	cookie := ts.impersonate(testTA)
+
+	// Neither staff nor students waiting for their positions hear about
+	// someone who isn't really there.
+	id, _ := ksuid.Parse(q)
+	watching := ts.broker.Subscribe(api.QueueTopicAdmin(id), api.QueueTopicEmail(id, alice))
+	defer func() {
+		go func() {
+			for range watching {
+			}
+		}()
+		ts.broker.Unsubscribe(watching)
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r, _ := http.NewRequestWithContext(ctx, "GET", ts.srv.URL+"/queues/"+q+"/events", nil)
+	r.AddCookie(cookie)
+	resp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatalf("failed to open event stream: %v", err)
+	}
+
+	// Something only the stream hears about shows it's connected.
+	ts.must(testAdmin, "PUT", "/queues/"+q+"/schedule/intervals", make([][]api.ScheduleInterval, 7), nil)
+	stream := bufio.NewReader(resp.Body)
+	for {
+		line, err := stream.ReadBytes('\n')
+		if err != nil {
+			t.Fatalf("failed to read event stream: %v", err)
+		}
+		if bytes.Contains(line, []byte(`"e":"REFRESH"`)) {
+			break
+		}
+	}
+
+	cancel()
+	resp.Body.Close()
+	select {
+	case e := <-watching:
+		t.Errorf("impersonated stream sent %s", e.(*api.WSMessage).Event)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -3,6 +3,7 @@ package api
 import (
 	"bufio"
 	"errors"
+	"fmt"
 	"net"
 	"net/http"
 	"strconv"
@@ -13,13 +14,91 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-var requestsCounter = prometheus.NewCounterVec(
-	prometheus.CounterOpts{
-		Name: "requests_count",
-		Help: "The number of requests by endpoint and response code.",
-	},
-	[]string{"method", "path", "code"},
-)
+// metrics are the server's own Prometheus metrics. Each server has its
+// own set, registered with the registry it was given, so that more than
+// one server can be set up in the same process.
+type metrics struct {
+	registry Registry
+
+	requestsCounter       *prometheus.CounterVec
+	rateLimitedCounter    *prometheus.CounterVec
+	requestsTimer         *prometheus.HistogramVec
+	requestsSize          *prometheus.HistogramVec
+	websocketCounter      *prometheus.GaugeVec
+	websocketEventCounter *prometheus.GaugeVec
+}
+
+// Registry is where a server registers its metrics, and what it serves
+// at /metrics. A *prometheus.Registry is one.
+type Registry interface {
+	prometheus.Registerer
+	prometheus.Gatherer
+}
+
+func newMetrics(registry Registry) (*metrics, error) {
+	m := &metrics{
+		registry: registry,
+		requestsCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "requests_count",
+				Help: "The number of requests by endpoint and response code.",
+			},
+			[]string{"method", "path", "code"},
+		),
+		rateLimitedCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "rate_limited_count",
+				Help: "The number of requests refused by rate limit and what they were counted against (email or IP).",
+			},
+			[]string{"limit", "by"},
+		),
+		requestsTimer: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name: "requests_time",
+				Help: "The duration of requests by endpoint and response code.",
+			},
+			[]string{"method", "path", "code"},
+		),
+		requestsSize: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "requests_size",
+				Help:    "The size of response bodies by endpoint and response code.",
+				Buckets: []float64{1, 10, 100, 200, 500, 1000, 2000, 5000, 10000, 100000, 1000000, 10000000, 100000000},
+			},
+			[]string{"method", "path", "code"},
+		),
+		websocketCounter: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "websocket_count",
+				Help: "The number of connected WebSocket clients per queue.",
+			},
+			[]string{"queue"},
+		),
+		websocketEventCounter: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "websocket_event_count",
+				Help: "The number and type of WebSocket events sent (in total, to all clients) per queue.",
+			},
+			[]string{"queue", "event"},
+		),
+	}
+
+	for _, c := range []prometheus.Collector{
+		m.requestsCounter,
+		m.rateLimitedCounter,
+		m.requestsTimer,
+		m.requestsSize,
+		m.websocketCounter,
+		m.websocketEventCounter,
+	} {
+		err := registry.Register(c)
+		if err != nil {
+			return nil, fmt.Errorf("failed to register metric: %w", err)
+		}
+	}
+
+	return m, nil
+}
 
 type StatusRecorder struct {
 	http.ResponseWriter
@@ -39,24 +118,13 @@ func (r *StatusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	return h.Hijack()
 }
 
-var requestsTimer = prometheus.NewHistogramVec(
-	prometheus.HistogramOpts{
-		Name: "requests_time",
-		Help: "The duration of requests by endpoint and response code.",
-	},
-	[]string{"method", "path", "code"},
-)
-
-var requestsSize = prometheus.NewHistogramVec(
-	prometheus.HistogramOpts{
-		Name:    "requests_size",
-		Help:    "The size of response bodies by endpoint and response code.",
-		Buckets: []float64{1, 10, 100, 200, 500, 1000, 2000, 5000, 10000, 100000, 1000000, 10000000, 100000000},
-	},
-	[]string{"method", "path", "code"},
-)
+func (r *StatusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
 
-func instrumenter(next http.Handler) http.Handler {
+func (s *Server) instrumenter(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		recorder := &StatusRecorder{
 			ResponseWriter: w,
@@ -73,22 +141,18 @@ func instrumenter(next http.Handler) http.Handler {
 			"code":   strconv.Itoa(recorder.Status),
 		}
 
-		requestsCounter.With(requestLabels).Inc()
-		requestsTimer.With(requestLabels).Observe(duration.Seconds())
+		s.metrics.requestsCounter.With(requestLabels).Inc()
+		s.metrics.requestsTimer.With(requestLabels).Observe(duration.Seconds())
 
 		// If err != nil, assume Content-Length wasn't included, which means
 		// we want 0 anyways! Yay zero values!
 		responseSize, _ := strconv.Atoi(recorder.Header().Get("Content-Length"))
-		requestsSize.With(requestLabels).Observe(float64(responseSize))
+		s.metrics.requestsSize.With(requestLabels).Observe(float64(responseSize))
 	})
 }
 
-func init() {
-	prometheus.MustRegister(requestsCounter, requestsTimer, requestsSize)
-}
-
 func (s *Server) MetricsHandler() E {
-	handler := promhttp.Handler()
+	handler := promhttp.HandlerFor(s.metrics.registry, promhttp.HandlerOpts{})
 	return func(w http.ResponseWriter, r *http.Request) error {
 		_, pass, ok := r.BasicAuth()
 		if !ok || pass != s.metricsPassword {
@@ -103,8 +167,8 @@ func (s *Server) MetricsHandler() E {
 	}
 }
 
-func (s *Server) RegisterQueueStats(q queueStats) {
-	prometheus.MustRegister(&queueStatsCollector{s: s, q: q})
+func (s *Server) registerQueueStats(q queueStats) error {
+	return s.metrics.registry.Register(&queueStatsCollector{s: s, q: q})
 }
 
 type QueueStats struct {
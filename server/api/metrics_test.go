@@ -0,0 +1,49 @@
+package api_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	ts := newTestServer(t)
+	q := ts.addQueue("ordered")
+	ts.openQueue(q, map[string]interface{}{})
+	ts.must("student@example.edu", "POST", "/queues/"+q+"/entries", testEntry, nil)
+
+	r, _ := http.NewRequest("GET", ts.srv.URL+"/metrics", nil)
+	r.SetBasicAuth("prometheus", "metrics")
+
+	// Collecting queue stats used to wait on the request's own
+	// transaction forever.
+	client := http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(r)
+	if err != nil {
+		t.Fatalf("failed to scrape metrics: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got %d scraping metrics, want 200", resp.StatusCode)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to read metrics: %v", err)
+	}
+	if want := `queue_students{course=`; !strings.Contains(string(b), want) {
+		t.Errorf("metrics don't have %s", want)
+	}
+
+	r.SetBasicAuth("prometheus", "wrong")
+	resp, err = client.Do(r)
+	if err != nil {
+		t.Fatalf("failed to scrape metrics: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("got %d scraping metrics with the wrong password, want 401", resp.StatusCode)
+	}
+}
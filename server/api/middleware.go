@@ -2,9 +2,11 @@ package api
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"net/http"
+	"time"
 
-	"github.com/jmoiron/sqlx"
 	"github.com/segmentio/ksuid"
 )
 
@@ -19,21 +21,37 @@ func ksuidInserter(next http.Handler) http.Handler {
 	})
 }
 
+// Tx is the transaction opened for each request. It's committed once
+// the handler finishes successfully, and rolled back otherwise.
+type Tx interface {
+	Commit() error
+	Rollback() error
+}
+
 type transactioner interface {
-	BeginTx() (*sqlx.Tx, error)
+	BeginTx() (Tx, error)
 }
 
 const (
-	RequestErrorContextKey = "request_error"
-	TransactionContextKey  = "transaction"
+	RequestErrorContextKey      = "request_error"
+	TransactionContextKey       = "transaction"
+	outboxContextKey            = "outbox"
+	finishTransactionContextKey = "finish_transaction"
 )
 
-// This function does tie the API package to sqlx to an extent, but it
-// doesn't need to be used in tests (individual handlers can still be
-// unit tested without this middleware, since the transaction is passed
-// through transparently in the context). I'm not advocating that this is
-// the cleanest pattern, but we definitely need to get transactions into
-// each request.
+// finishTransaction commits the request's transaction before the handler
+// returns, for handlers that keep going long after they're done with the
+// store (like event streams). The context's transaction mustn't be used
+// afterwards.
+func finishTransaction(r *http.Request) error {
+	return r.Context().Value(finishTransactionContextKey).(func() error)()
+}
+
+// The transaction is opaque to this package; the backing store puts
+// whatever it needs in the context and pulls it back out in its own
+// methods (see getTransaction in the db and memstore packages). I'm not
+// advocating that this is the cleanest pattern, but we definitely need
+// to get transactions into each request.
 func (s *Server) transaction(tr transactioner) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -50,9 +68,32 @@ func (s *Server) transaction(tr transactioner) func(http.Handler) http.Handler {
 			// other place (E.ServeHTTP).
 			ctx := context.WithValue(r.Context(), RequestErrorContextKey, &err)
 			ctx = context.WithValue(ctx, TransactionContextKey, tx)
+
+			// Events published by the handler wait here until we know
+			// whether what they describe actually happened.
+			var events outbox
+			ctx = context.WithValue(ctx, outboxContextKey, &events)
+
+			finished := false
+			finish := func() error {
+				finished = true
+				err := tx.Commit()
+				if err != nil {
+					return err
+				}
+				events.flush(s.broker)
+				return nil
+			}
+			ctx = context.WithValue(ctx, finishTransactionContextKey, finish)
+
 			r = r.WithContext(ctx)
 			next.ServeHTTP(w, r)
 
+			// The handler took care of it (see finishTransaction).
+			if finished {
+				return
+			}
+
 			// err might have been mutated by the handler since we passed the
 			// context a pointer to it.
 			if err != nil {
@@ -76,51 +117,176 @@ func (s *Server) transaction(tr transactioner) func(http.Handler) http.Handler {
 					RequestIDContextKey, r.Context().Value(RequestIDContextKey),
 					"err", err,
 				)
+				return
 			}
+
+			events.flush(s.broker)
 		})
 	}
 }
 
-func (s *Server) sessionRetriever(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		session, err := s.sessions.Get(r, "session")
-		if err != nil {
-			next.ServeHTTP(w, r)
-			return
-		}
+type retrieveSession interface {
+	useAPIToken
+	useUserSession
+	AddUserSession(ctx context.Context, session *UserSession) (*UserSession, error)
+}
 
-		email, ok := session.Values["email"].(string)
-		if !ok {
-			next.ServeHTTP(w, r)
-			return
-		}
+// sessionRetriever puts the user from the request's session, or its API
+// token if it has one, into the context.
+func (s *Server) sessionRetriever(rs retrieveSession) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if hasAPIToken(r) {
+				s.apiTokenRetriever(rs, next, w, r)
+				return
+			}
+			s.cookieSessionRetriever(rs, next, w, r)
+		})
+	}
+}
 
-		profilePicture, ok := session.Values["profile_pic"].(string)
-		if !ok {
-			next.ServeHTTP(w, r)
+func (s *Server) apiTokenRetriever(ua useAPIToken, next http.Handler, w http.ResponseWriter, r *http.Request) {
+	token, err := s.apiTokenLogin(ua, r)
+	if err != nil {
+		var serr StatusError
+		if !errors.As(err, &serr) {
+			s.logger.Errorw("failed to look up API token",
+				RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+				"err", err,
+			)
+			s.internalServerError(w, r)
 			return
 		}
 
-		name, ok := session.Values["name"].(string)
-		if !ok {
-			next.ServeHTTP(w, r)
+		s.logger.Warnw("rejected API token",
+			RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+			"reason", serr.message,
+		)
+		s.errorMessage(serr.status, serr.message, w, r)
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), emailContextKey, token.Email)
+	ctx = context.WithValue(ctx, nameContextKey, token.OwnerName)
+	ctx = context.WithValue(ctx, firstNameContextKey, token.OwnerFirstName)
+	ctx = context.WithValue(ctx, apiTokenContextKey, token)
+
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+func (s *Server) cookieSessionRetriever(rs retrieveSession, next http.Handler, w http.ResponseWriter, r *http.Request) {
+	session, err := s.sessions.Get(r, "session")
+	if err != nil {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	email, ok := session.Values["email"].(string)
+	if !ok {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	profilePicture, ok := session.Values["profile_pic"].(string)
+	if !ok {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	name, ok := session.Values["name"].(string)
+	if !ok {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	firstName, ok := session.Values["first_name"].(string)
+	if !ok {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	// Sessions from before they were tracked start being tracked the
+	// first time they're seen, rather than everyone being logged out when
+	// tracking was deployed. With sessions kept in Postgres every copy of
+	// the cookie is the same session, so this only happens once; with
+	// them kept in the cookie, a copy that hasn't been seen yet is tracked
+	// anew even after its user is logged out everywhere, until it expires.
+	sessionID, tracked := session.Values["session_id"].(string)
+	if !tracked {
+		now := time.Now()
+		us, err := rs.AddUserSession(r.Context(), &UserSession{
+			Email:     email,
+			UserAgent: r.UserAgent(),
+			CreatedAt: now,
+			ExpiresAt: now.Add(sessionLifetime),
+		})
+		if err != nil {
+			s.logger.Errorw("failed to track untracked session",
+				RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+				"email", email,
+				"err", err,
+			)
+			s.internalServerError(w, r)
 			return
 		}
 
-		firstName, ok := session.Values["first_name"].(string)
-		if !ok {
-			next.ServeHTTP(w, r)
+		sessionID = us.ID.String()
+		session.Values["session_id"] = sessionID
+		err = s.sessions.Save(r, w, session)
+		if err != nil {
+			s.logger.Errorw("failed to save tracked session",
+				RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+				"email", email,
+				"err", err,
+			)
+			s.internalServerError(w, r)
 			return
 		}
+	}
 
-		ctx := context.WithValue(r.Context(), emailContextKey, email)
-		ctx = context.WithValue(ctx, profilePictureContextKey, profilePicture)
-		ctx = context.WithValue(ctx, nameContextKey, name)
-		ctx = context.WithValue(ctx, firstNameContextKey, firstName)
-		ctx = context.WithValue(ctx, sessionContextKey, session.Values)
+	// Sessions that have since been revoked don't count as logged in.
+	id, err := ksuid.Parse(sessionID)
+	if err != nil {
+		next.ServeHTTP(w, r)
+		return
+	}
+	_, err = rs.UseUserSession(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		next.ServeHTTP(w, r)
+		return
+	} else if err != nil {
+		s.logger.Errorw("failed to look up session",
+			RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+			"session_id", id,
+			"err", err,
+		)
+		s.internalServerError(w, r)
+		return
+	}
 
-		next.ServeHTTP(w, r.WithContext(ctx))
-	})
+	// Everything after this sees a site admin who's impersonating someone
+	// as the user they're impersonating (see StartImpersonation).
+	if target, ok := impersonating(session.Values); ok {
+		s.logger.Infow("impersonated request",
+			RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+			"impersonator", email,
+			"email", target,
+			"method", r.Method,
+			"path", r.URL.Path,
+		)
+		w.Header().Set(ImpersonationHeader, target)
+		r = r.WithContext(context.WithValue(r.Context(), impersonatorContextKey, email))
+		email, profilePicture, name, firstName = target, "", target, target
+	}
+
+	ctx := context.WithValue(r.Context(), emailContextKey, email)
+	ctx = context.WithValue(ctx, profilePictureContextKey, profilePicture)
+	ctx = context.WithValue(ctx, nameContextKey, name)
+	ctx = context.WithValue(ctx, firstNameContextKey, firstName)
+	ctx = context.WithValue(ctx, sessionContextKey, session.Values)
+	ctx = context.WithValue(ctx, sessionIDContextKey, id)
+
+	next.ServeHTTP(w, r.WithContext(ctx))
 }
 
 func (s *Server) recoverMiddleware(next http.Handler) http.Handler {
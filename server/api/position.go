@@ -0,0 +1,158 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/segmentio/ksuid"
+)
+
+const (
+	// How far back to look at help given when estimating wait times.
+	throughputWindow = time.Hour
+
+	// The shortest span help rates are computed over, so that the first
+	// couple of students helped after the queue opens don't make the
+	// rate look much higher than it really is.
+	minThroughputSpan = 10 * time.Minute
+)
+
+type getHelpThroughput interface {
+	GetHelpThroughput(ctx context.Context, queue ksuid.KSUID, since time.Time) (*HelpThroughput, error)
+}
+
+type getQueuePositions interface {
+	getQueueEntries
+	getHelpThroughput
+	getCourseAdmins
+}
+
+type queuePresence interface {
+	transactioner
+	getQueuePositions
+}
+
+// QueuePosition is where an entry is on the queue. Each student gets their
+// own entry's as ENTRY_POSITION whenever it might have changed.
+type QueuePosition struct {
+	ID       ksuid.KSUID `json:"id"`
+	Position int         `json:"position"`
+
+	// In seconds; nil if there isn't enough recent help to go on, or no
+	// staff are around.
+	EstimatedWait *int `json:"estimated_wait"`
+}
+
+// secondsPerEntry estimates how long it'll take for the queue to move up
+// by one entry, from how quickly each staff member has been helping
+// students recently and how many of them are online now.
+func secondsPerEntry(t *HelpThroughput, staffOnline int, now time.Time) (float64, bool) {
+	if t.Helped == 0 || t.Helpers == 0 || staffOnline == 0 || !t.First.Valid {
+		return 0, false
+	}
+
+	span := now.Sub(t.First.Time)
+	if span < minThroughputSpan {
+		span = minThroughputSpan
+	}
+
+	perStaff := float64(t.Helped) / float64(t.Helpers) / span.Seconds()
+	return 1 / (perStaff * float64(staffOnline)), true
+}
+
+// queuePositions returns the active entries on q in order, each with
+// its position and estimated wait filled in.
+func (s *Server) queuePositions(ctx context.Context, gp getQueuePositions, q *Queue) ([]*QueueEntry, error) {
+	entries, err := gp.GetQueueEntries(ctx, q.ID, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get queue entries: %w", err)
+	}
+
+	now := time.Now()
+	throughput, err := gp.GetHelpThroughput(ctx, q.ID, now.Add(-throughputWindow))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get help throughput: %w", err)
+	}
+
+	admins, err := gp.GetCourseAdmins(ctx, q.Course)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get course admins: %w", err)
+	}
+
+	online, err := s.broker.Online(ctx, q.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get online users: %w", err)
+	}
+
+	// Observers don't help anyone, so they don't speed the queue up.
+	staff := make(map[string]bool, len(admins))
+	for _, a := range admins {
+		staff[a.Email] = a.Role.AtLeast(RoleTA)
+	}
+	var staffOnline int
+	for _, o := range online {
+		if staff[o] {
+			staffOnline++
+		}
+	}
+
+	rate, ok := secondsPerEntry(throughput, staffOnline, now)
+
+	// Students already being helped are about to be off the queue, so
+	// they don't count against the people behind them.
+	var ahead int
+	for i, e := range entries {
+		e.Position = i + 1
+		if ok {
+			wait := 0
+			if !e.Helping {
+				wait = int(float64(ahead) * rate)
+			}
+			e.EstimatedWait = &wait
+		}
+		if !e.Helping {
+			ahead++
+		}
+	}
+
+	return entries, nil
+}
+
+// publishPositions sends each student on q their entry's position and
+// estimated wait. It's called whenever the order of the queue, or how
+// quickly it's moving, might have changed.
+func (s *Server) publishPositions(ctx context.Context, gp getQueuePositions, q *Queue) error {
+	entries, err := s.queuePositions(ctx, gp, q)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		s.publish(ctx, q.ID, WS("ENTRY_POSITION", QueuePosition{
+			ID:            e.ID,
+			Position:      e.Position,
+			EstimatedWait: e.EstimatedWait,
+		}), QueueTopicEmail(q.ID, e.Email))
+	}
+
+	return nil
+}
+
+// refreshPositions publishes q's positions outside of any request, for
+// when staff come or go and the estimated waits change with them.
+func (s *Server) refreshPositions(qp queuePresence, q *Queue) {
+	if q.Type != Ordered {
+		return
+	}
+
+	err := s.inTransaction(qp, func(ctx context.Context) error {
+		return s.publishPositions(ctx, qp, q)
+	})
+	if err != nil {
+		s.logger.Errorw("failed to refresh queue positions",
+			"queue_id", q.ID,
+			"err", err,
+		)
+	}
+}
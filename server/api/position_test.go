@@ -0,0 +1,150 @@
+package api_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/CarsonHoffman/office-hours-queue/server/api"
+	"github.com/segmentio/ksuid"
+)
+
+// events listens for events sent to topics, returning a function that
+// gets the next one that's one of names, or nil if there isn't one.
+func (ts *testServer) events(topics ...string) func(names ...string) *api.WSMessage {
+	events := ts.broker.Subscribe(topics...)
+	ts.t.Cleanup(func() {
+		go func() {
+			for range events {
+			}
+		}()
+		ts.broker.Unsubscribe(events)
+	})
+
+	return func(names ...string) *api.WSMessage {
+		timeout := time.After(time.Second)
+		for {
+			select {
+			case e := <-events:
+				msg := e.(*api.WSMessage)
+				for _, name := range names {
+					if msg.Event == name {
+						return msg
+					}
+				}
+			case <-timeout:
+				return nil
+			}
+		}
+	}
+}
+
+// queueEvents listens for events sent to everyone on q and to its staff.
+func (ts *testServer) queueEvents(q string) func(names ...string) *api.WSMessage {
+	id, _ := ksuid.Parse(q)
+	return ts.events(api.QueueTopicGeneric(id), api.QueueTopicAdmin(id))
+}
+
+// studentEvents listens for events sent only to email on q.
+func (ts *testServer) studentEvents(q, email string) func(names ...string) *api.WSMessage {
+	id, _ := ksuid.Parse(q)
+	return ts.events(api.QueueTopicEmail(id, email))
+}
+
+// position gets the position in an ENTRY_POSITION event, or -1 if it's
+// something else.
+func position(msg *api.WSMessage) int {
+	if msg == nil || msg.Event != "ENTRY_POSITION" {
+		return -1
+	}
+	return msg.Data.(api.QueuePosition).Position
+}
+
+func TestPublishPositions(t *testing.T) {
+	ts := newTestServer(t)
+	q := ts.addQueue("ordered")
+	ts.openQueue(q, map[string]interface{}{})
+	const (
+		alice = "alice@example.edu"
+		bob   = "bob@example.edu"
+	)
+	everyone := ts.queueEvents(q)
+	aliceNext := ts.studentEvents(q, alice)
+	bobNext := ts.studentEvents(q, bob)
+
+	var aliceEntry, bobEntry api.QueueEntry
+	ts.must(alice, "POST", "/queues/"+q+"/entries", testEntry, &aliceEntry)
+	if p := position(aliceNext("ENTRY_POSITION")); p != 1 {
+		t.Errorf("after signing up first, alice got position %d, want 1", p)
+	}
+
+	// Each student only hears about their own entry.
+	ts.must(bob, "POST", "/queues/"+q+"/entries", testEntry, &bobEntry)
+	if msg := bobNext("ENTRY_POSITION"); position(msg) != 2 || msg.Data.(api.QueuePosition).ID != bobEntry.ID {
+		t.Errorf("after signing up second, bob got %+v, want position 2 of his entry", msg)
+	}
+	if msg := aliceNext("ENTRY_POSITION"); position(msg) != 1 || msg.Data.(api.QueuePosition).ID != aliceEntry.ID {
+		t.Errorf("after bob signed up, alice got %+v, want position 1 of her entry", msg)
+	}
+
+	ts.must(testTA, "DELETE", "/queues/"+q+"/entries/"+aliceEntry.ID.String(), nil, nil)
+	if p := position(bobNext("ENTRY_POSITION")); p != 1 {
+		t.Errorf("after alice was helped, bob got position %d, want 1", p)
+	}
+
+	// Nobody else gets to see anyone's position.
+	if msg := everyone("ENTRY_POSITION"); msg != nil {
+		t.Errorf("position of %+v was sent to everyone on the queue", msg.Data)
+	}
+}
+
+func TestStaffPresenceRefreshesPositions(t *testing.T) {
+	ts := newTestServer(t)
+	q := ts.addQueue("ordered")
+	ts.openQueue(q, map[string]interface{}{})
+	ts.must("alice@example.edu", "POST", "/queues/"+q+"/entries", testEntry, nil)
+	next := ts.queueEvents(q)
+	aliceNext := ts.studentEvents(q, "alice@example.edu")
+
+	// stream opens an event stream as email, returning what closes it.
+	stream := func(email string) context.CancelFunc {
+		ctx, cancel := context.WithCancel(context.Background())
+		r, _ := http.NewRequestWithContext(ctx, "GET", ts.srv.URL+"/queues/"+q+"/events", nil)
+		r.AddCookie(ts.cookie(email))
+		resp, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatalf("failed to open event stream: %v", err)
+		}
+		return func() {
+			cancel()
+			resp.Body.Close()
+		}
+	}
+
+	// Students coming and going doesn't change how fast the queue moves.
+	closeStudent := stream("bob@example.edu")
+	defer closeStudent()
+	if msg := next("QUEUE_CONNECTIONS_UPDATE"); msg == nil {
+		t.Fatalf("got no connection count when a student connected")
+	}
+	if msg := aliceNext("ENTRY_POSITION"); msg != nil {
+		t.Errorf("a student connecting sent alice her position")
+	}
+
+	closeTA := stream(testTA)
+	if msg := next("QUEUE_CONNECTIONS_UPDATE"); msg == nil {
+		t.Fatalf("got no connection count when staff connected")
+	}
+	if p := position(aliceNext("ENTRY_POSITION")); p != 1 {
+		t.Errorf("staff connecting sent alice position %d, want 1", p)
+	}
+
+	closeTA()
+	if msg := next("QUEUE_CONNECTIONS_UPDATE"); msg == nil {
+		t.Fatalf("got no connection count when staff disconnected")
+	}
+	if p := position(aliceNext("ENTRY_POSITION")); p != 1 {
+		t.Errorf("staff disconnecting sent alice position %d, want 1", p)
+	}
+}
@@ -7,20 +7,16 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/gorilla/websocket"
 	"github.com/lib/pq"
-	"github.com/olivere/elastic/v7"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/segmentio/ksuid"
 )
 
-func init() {
-	prometheus.MustRegister(websocketCounter, websocketEventCounter)
-}
-
 type getQueue interface {
 	GetQueue(context.Context, ksuid.KSUID) (*Queue, error)
 }
@@ -94,7 +90,7 @@ type getQueueStack interface {
 }
 
 type getCurrentDaySchedule interface {
-	GetCurrentDaySchedule(ctx context.Context, queue ksuid.KSUID) (string, error)
+	GetCurrentDaySchedule(ctx context.Context, queue ksuid.KSUID) (DaySchedule, error)
 }
 
 type viewMessage interface {
@@ -110,6 +106,7 @@ type getQueueDetails interface {
 	getCurrentDaySchedule
 	viewMessage
 	getQueueConfiguration
+	getQueuePositions
 }
 
 func (s *Server) GetQueue(gd getQueueDetails) E {
@@ -146,10 +143,28 @@ func (s *Server) GetQueue(gd getQueueDetails) E {
 				return err
 			}
 
+			if len(userEntries) > 0 {
+				positions, err := s.queuePositions(r.Context(), gd, q)
+				if err != nil {
+					l.Errorw("failed to get queue positions", "err", err)
+					return err
+				}
+
+				for _, userEntry := range userEntries {
+					for _, p := range positions {
+						if userEntry.ID == p.ID {
+							userEntry.Position = p.Position
+							userEntry.EstimatedWait = p.EstimatedWait
+							break
+						}
+					}
+				}
+			}
+
 			for _, userEntry := range userEntries {
 				for i, e := range entries {
 					if userEntry.ID == e.ID {
-						entries[i] = userEntry
+						entries[i] = userEntry.NoHelperEmail()
 						break
 					}
 				}
@@ -165,13 +180,12 @@ func (s *Server) GetQueue(gd getQueueDetails) E {
 			}
 			response["stack"] = stack
 
-			s.websocketCountLock.Lock()
-			m := make([]string, 0, len(s.websocketCountByEmail[q.ID]))
-			for e := range s.websocketCountByEmail[q.ID] {
-				m = append(m, e)
+			online, err := s.broker.Online(r.Context(), q.ID)
+			if err != nil {
+				l.Errorw("failed to get online users", "err", err)
+				return err
 			}
-			s.websocketCountLock.Unlock()
-			response["online"] = m
+			response["online"] = online
 		}
 
 		config, err := gd.GetQueueConfiguration(r.Context(), q.ID)
@@ -186,12 +200,12 @@ func (s *Server) GetQueue(gd getQueueDetails) E {
 			l.Errorw("failed to get queue schedule", "err", err)
 			return err
 		}
-		response["schedule"] = schedule
+		response["schedule"] = schedule.HalfHours()
+		response["intervals"] = schedule
 
-		halfHour := CurrentHalfHour()
-		response["half_hour"] = halfHour
+		response["half_hour"] = CurrentHalfHour(q.Zone())
 		if config.Scheduled {
-			response["open"] = schedule[halfHour] == 'o' || schedule[halfHour] == 'p'
+			response["open"] = schedule.At(CurrentMinute(q.Zone())) != 'c'
 		} else {
 			response["open"] = config.ManualOpen
 		}
@@ -218,49 +232,159 @@ func (s *Server) GetQueue(gd getQueueDetails) E {
 	}
 }
 
-var websocketCounter = prometheus.NewGaugeVec(
-	prometheus.GaugeOpts{
-		Name: "websocket_count",
-		Help: "The number of connected WebSocket clients per queue.",
-	},
-	[]string{"queue"},
-)
-
-var websocketEventCounter = prometheus.NewGaugeVec(
-	prometheus.GaugeOpts{
-		Name: "websocket_event_count",
-		Help: "The number and type of WebSocket events sent (in total, to all clients) per queue.",
-	},
-	[]string{"queue", "event"},
-)
-
 var upgrader = &websocket.Upgrader{
 	HandshakeTimeout: 30 * time.Second,
 }
 
-func (s *Server) QueueWebsocket() E {
-	type update struct {
-		Email  string `json:"email"`
-		Status string `json:"status"`
+// eventTopics returns the topics a client of the request's queue should
+// get events from, based on who they are.
+func eventTopics(r *http.Request) []string {
+	var topics []string
+
+	q := r.Context().Value(queueContextKey).(*Queue)
+	topics = append(topics, QueueTopicGeneric(q.ID))
+
+	admin := r.Context().Value(courseAdminContextKey).(bool)
+	if admin {
+		topics = append(topics, QueueTopicAdmin(q.ID))
+	} else {
+		topics = append(topics, QueueTopicNonPrivileged(q.ID))
 	}
 
-	return func(w http.ResponseWriter, r *http.Request) error {
-		var topics []string
+	// Yes, this is okay---see above
+	email, _ := r.Context().Value(emailContextKey).(string)
+	if email != "" {
+		topics = append(topics, QueueTopicEmail(q.ID, email))
+	}
 
-		q := r.Context().Value(queueContextKey).(*Queue)
-		topics = append(topics, QueueTopicGeneric(q.ID))
+	return topics
+}
 
-		admin := r.Context().Value(courseAdminContextKey).(bool)
-		if admin {
-			topics = append(topics, QueueTopicAdmin(q.ID))
-		} else {
-			topics = append(topics, QueueTopicNonPrivileged(q.ID))
+// parseSince reads the sequence number of the last event a reconnecting
+// client saw. Zero means the client isn't resuming.
+func parseSince(v string) (uint64, error) {
+	if v == "" {
+		return 0, nil
+	}
+
+	since, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return 0, StatusError{
+			http.StatusBadRequest,
+			"That's not a valid event sequence number.",
+		}
+	}
+	return since, nil
+}
+
+// replayEvents gets the events a reconnecting client missed. If they
+// can't all be had, caughtUp is false and the client should be told to
+// refresh. It should be called after subscribing, so nothing falls
+// between the replay and the live events; anything in both is skipped
+// by sequence number.
+func (s *Server) replayEvents(q ksuid.KSUID, email string, since uint64, topics []string) (replay []*WSMessage, caughtUp bool) {
+	if since == 0 {
+		return nil, true
+	}
+
+	replay, caughtUp, err := s.broker.Replay(context.Background(), q, since, topics...)
+	if err != nil {
+		s.logger.Errorw("failed to get events for replay",
+			"queue_id", q,
+			"email", email,
+			"since", since,
+			"err", err,
+		)
+		return nil, false
+	}
+	return replay, caughtUp
+}
+
+type userStatusUpdate struct {
+	Email  string `json:"email"`
+	Status string `json:"status"`
+}
+
+// clientConnected records a new event stream (WebSocket or otherwise)
+// to q, and lets staff know. If staff is true, the user is one of them,
+// and the queue moves faster now that they're here. It's called after the
+// request's transaction is done with.
+func (s *Server) clientConnected(qp queuePresence, queue *Queue, email string, staff bool) {
+	q := queue.ID
+
+	// The request's transaction is done with by the time any of this
+	// matters, so presence updates don't use the request's context.
+	ws, first, err := s.broker.Connect(context.Background(), q, email)
+	if err != nil {
+		s.logger.Errorw("failed to record websocket connection",
+			"queue_id", q,
+			"email", email,
+			"err", err,
+		)
+	}
+
+	s.metrics.websocketCounter.With(prometheus.Labels{"queue": q.String()}).Set(float64(ws))
+
+	s.publish(context.Background(), q, WS("QUEUE_CONNECTIONS_UPDATE", ws), QueueTopicAdmin(q))
+	if first {
+		s.publish(context.Background(), q, WS("USER_STATUS_UPDATE", userStatusUpdate{Email: email, Status: "online"}), QueueTopicAdmin(q))
+		if staff {
+			s.refreshPositions(qp, queue)
+		}
+	}
+}
+
+// clientDisconnected is the reverse of clientConnected.
+func (s *Server) clientDisconnected(qp queuePresence, queue *Queue, email string, staff bool) {
+	q := queue.ID
+	ws, last, err := s.broker.Disconnect(context.Background(), q, email)
+	if err != nil {
+		s.logger.Errorw("failed to record websocket disconnection",
+			"queue_id", q,
+			"email", email,
+			"err", err,
+		)
+	}
+
+	s.metrics.websocketCounter.With(prometheus.Labels{"queue": q.String()}).Set(float64(ws))
+
+	s.publish(context.Background(), q, WS("QUEUE_CONNECTIONS_UPDATE", ws), QueueTopicAdmin(q))
+	if last {
+		s.publish(context.Background(), q, WS("USER_STATUS_UPDATE", userStatusUpdate{Email: email, Status: "offline"}), QueueTopicAdmin(q))
+		if staff {
+			s.refreshPositions(qp, queue)
 		}
+	}
+}
 
-		// Yes, this is okay---see above
+// isStaff reports whether the user making r helps students on the queue.
+// Observers don't, like in queuePositions.
+func isStaff(r *http.Request) bool {
+	role, _ := r.Context().Value(courseRoleContextKey).(CourseRole)
+	return role.AtLeast(RoleTA)
+}
+
+// isImpersonated reports whether r comes from a site admin impersonating
+// the user. They're only looking around, so as far as everyone else can
+// tell, the user isn't there.
+func isImpersonated(r *http.Request) bool {
+	_, ok := r.Context().Value(impersonatorContextKey).(string)
+	return ok
+}
+
+func (s *Server) QueueWebsocket(qp queuePresence) E {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		q := r.Context().Value(queueContextKey).(*Queue)
 		email, _ := r.Context().Value(emailContextKey).(string)
-		if email != "" {
-			topics = append(topics, QueueTopicEmail(q.ID, email))
+		staff := isStaff(r)
+		impersonated := isImpersonated(r)
+		topics := eventTopics(r)
+
+		// A client that's reconnecting passes the sequence number of the
+		// last event it saw, and gets everything it missed.
+		since, err := parseSince(r.URL.Query().Get("since"))
+		if err != nil {
+			return err
 		}
 
 		conn, err := upgrader.Upgrade(w, r, nil)
@@ -275,32 +399,22 @@ func (s *Server) QueueWebsocket() E {
 			}
 		}
 
-		events := s.ps.Sub(topics...)
-
-		s.websocketCountLock.Lock()
-
-		ws := s.websocketCount[q.ID]
-		ws++
-		s.websocketCount[q.ID] = ws
-
-		websocketCounter.With(prometheus.Labels{"queue": q.ID.String()}).Set(float64(ws))
-
-		first := false
-		if email != "" {
-			e := s.websocketCountByEmail[q.ID]
-			if e == nil {
-				e = make(map[string]int)
-				s.websocketCountByEmail[q.ID] = e
-			}
-			first = e[email] == 0
-			e[email]++
+		// The connection outlives the request's transaction, and telling
+		// everyone it's here needs one of its own.
+		err = finishTransaction(r)
+		if err != nil {
+			s.logger.Errorw("transaction commit failed",
+				RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+				"err", err,
+			)
+			conn.Close()
+			return nil
 		}
 
-		s.websocketCountLock.Unlock()
-
-		s.ps.Pub(WS("QUEUE_CONNECTIONS_UPDATE", ws), QueueTopicAdmin(q.ID))
-		if first {
-			s.ps.Pub(WS("USER_STATUS_UPDATE", update{Email: email, Status: "online"}), QueueTopicAdmin(q.ID))
+		events := s.broker.Subscribe(topics...)
+		replay, caughtUp := s.replayEvents(q.ID, email, since, topics)
+		if !impersonated {
+			s.clientConnected(qp, q, email, staff)
 		}
 
 		if email != "" {
@@ -322,7 +436,7 @@ func (s *Server) QueueWebsocket() E {
 				conn.SetReadDeadline(time.Now().Add(pingInterval + pingSlack))
 				_, _, err := conn.ReadMessage()
 				if err != nil {
-					s.ps.Unsub(events)
+					s.broker.Unsubscribe(events)
 					conn.WriteControl(
 						websocket.CloseMessage,
 						websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
@@ -330,29 +444,8 @@ func (s *Server) QueueWebsocket() E {
 					)
 					conn.Close()
 
-					s.websocketCountLock.Lock()
-
-					ws := s.websocketCount[q.ID]
-					ws--
-					s.websocketCount[q.ID] = ws
-
-					websocketCounter.With(prometheus.Labels{"queue": q.ID.String()}).Set(float64(s.websocketCount[q.ID]))
-
-					last := false
-					if email != "" {
-						e := s.websocketCountByEmail[q.ID]
-						last = e[email] == 1
-						e[email]--
-						if last {
-							delete(e, email)
-						}
-					}
-
-					s.websocketCountLock.Unlock()
-
-					s.ps.Pub(WS("QUEUE_CONNECTIONS_UPDATE", ws), QueueTopicAdmin(q.ID))
-					if last {
-						s.ps.Pub(WS("USER_STATUS_UPDATE", update{Email: email, Status: "offline"}), QueueTopicAdmin(q.ID))
+					if !impersonated {
+						s.clientDisconnected(qp, q, email, staff)
 					}
 
 					if email != "" {
@@ -369,6 +462,26 @@ func (s *Server) QueueWebsocket() E {
 		go func() {
 			pingTicker := time.NewTicker(pingInterval)
 			defer pingTicker.Stop()
+
+			// The sequence number of the last event sent to this client.
+			last := since
+			if !caughtUp {
+				// Too far behind to catch up from here; the client needs
+				// to start over.
+				last = 0
+				err = conn.WriteJSON(WS("REFRESH", nil))
+				if err != nil {
+					return
+				}
+			}
+			for _, e := range replay {
+				err = conn.WriteJSON(e)
+				if err != nil {
+					return
+				}
+				last = e.Seq
+			}
+
 			for {
 				var eventName string
 				select {
@@ -381,13 +494,19 @@ func (s *Server) QueueWebsocket() E {
 					if !ok {
 						return
 					}
-					err = conn.WriteJSON(event)
 					e, ok := event.(*WSMessage)
 					if ok {
+						if e.Seq != 0 && e.Seq <= last {
+							continue
+						}
+						if e.Seq != 0 {
+							last = e.Seq
+						}
 						eventName = e.Event
 					}
+					err = conn.WriteJSON(event)
 				}
-				websocketEventCounter.With(prometheus.Labels{"queue": q.ID.String(), "event": eventName}).Inc()
+				s.metrics.websocketEventCounter.With(prometheus.Labels{"queue": q.ID.String(), "event": eventName}).Inc()
 
 				// If the write fails, we presume that the read will also
 				// fail, so the read loop will take care of unsubbing and
@@ -404,7 +523,160 @@ func (s *Server) QueueWebsocket() E {
 	}
 }
 
+// QueueEventStream sends the same events as QueueWebsocket as Server-Sent
+// Events, for networks and proxies that don't let WebSockets through.
+// Each event's data is the same JSON the WebSocket would send.
+func (s *Server) QueueEventStream(qp queuePresence) E {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		q := r.Context().Value(queueContextKey).(*Queue)
+		email, _ := r.Context().Value(emailContextKey).(string)
+		staff := isStaff(r)
+		impersonated := isImpersonated(r)
+		topics := eventTopics(r)
+
+		// EventSource sends the ID of the last event it got when it
+		// reconnects by itself; ?since= works too, like the WebSocket.
+		v := r.Header.Get("Last-Event-ID")
+		if v == "" {
+			v = r.URL.Query().Get("since")
+		}
+		since, err := parseSince(v)
+		if err != nil {
+			return err
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			s.logger.Errorw("response writer can't stream events",
+				RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+				"queue_id", q.ID,
+			)
+			return internalServerError(r)
+		}
+
+		// The stream outlives the request's transaction by hours; don't
+		// hold it open that whole time.
+		err = finishTransaction(r)
+		if err != nil {
+			s.logger.Errorw("transaction commit failed",
+				RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+				"err", err,
+			)
+			return err
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		events := s.broker.Subscribe(topics...)
+		defer func() {
+			// Keep the channel drained until it's closed, so that the
+			// broker is never stuck waiting on us.
+			go func() {
+				for range events {
+				}
+			}()
+			s.broker.Unsubscribe(events)
+		}()
+
+		replay, caughtUp := s.replayEvents(q.ID, email, since, topics)
+		if !impersonated {
+			s.clientConnected(qp, q, email, staff)
+			defer s.clientDisconnected(qp, q, email, staff)
+		}
+
+		if email != "" {
+			s.logger.Infow("event stream opened",
+				"queue_id", q.ID,
+				"email", email,
+			)
+			defer s.logger.Infow("event stream closed",
+				"queue_id", q.ID,
+				"email", email,
+			)
+		}
+
+		write := func(e *WSMessage) error {
+			data, err := json.Marshal(e)
+			if err != nil {
+				return err
+			}
+
+			if e.Seq != 0 {
+				_, err = fmt.Fprintf(w, "id: %d\n", e.Seq)
+				if err != nil {
+					return err
+				}
+			}
+			_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+			if err != nil {
+				return err
+			}
+
+			flusher.Flush()
+			s.metrics.websocketEventCounter.With(prometheus.Labels{"queue": q.ID.String(), "event": e.Event}).Inc()
+			return nil
+		}
+
+		// The sequence number of the last event sent to this client.
+		last := since
+		if !caughtUp {
+			last = 0
+			err = write(WS("REFRESH", nil))
+			if err != nil {
+				return nil
+			}
+		}
+		for _, e := range replay {
+			err = write(e)
+			if err != nil {
+				return nil
+			}
+			last = e.Seq
+		}
+
+		// Same interval as the WebSocket's pings; clients can't answer
+		// these, but they can tell the stream is still alive.
+		pingTicker := time.NewTicker(10 * time.Second)
+		defer pingTicker.Stop()
+
+		// Once we've started streaming, the response has been written,
+		// so there's nothing useful to return; write errors just mean the
+		// client is gone.
+		for {
+			select {
+			case <-r.Context().Done():
+				return nil
+			case <-pingTicker.C:
+				err = write(WS("PING", nil))
+			case event, ok := <-events:
+				if !ok {
+					return nil
+				}
+				e, ok := event.(*WSMessage)
+				if !ok {
+					continue
+				}
+				if e.Seq != 0 && e.Seq <= last {
+					continue
+				}
+				if e.Seq != 0 {
+					last = e.Seq
+				}
+				err = write(e)
+			}
+
+			if err != nil {
+				return nil
+			}
+		}
+	}
+}
+
 type updateQueue interface {
+	addAuditLogEntry
 	UpdateQueue(ctx context.Context, queue ksuid.KSUID, values *Queue) error
 }
 
@@ -443,11 +715,22 @@ func (s *Server) UpdateQueue(uq updateQueue) E {
 		}
 
 		l.Infow("updated queue")
+
+		// Only the name and location can be changed.
+		after := *q
+		after.Name = queue.Name
+		after.Location = queue.Location
+		err = s.auditQueue(r.Context(), uq, q, AuditQueueUpdate, "", q, &after)
+		if err != nil {
+			l.Errorw("failed to audit queue update", "err", err)
+			return err
+		}
 		return s.sendResponse(http.StatusNoContent, nil, w, r)
 	}
 }
 
 type removeQueue interface {
+	addAuditLogEntry
 	RemoveQueue(ctx context.Context, queue ksuid.KSUID) error
 }
 
@@ -468,6 +751,12 @@ func (s *Server) RemoveQueue(rq removeQueue) E {
 		}
 
 		l.Infow("removed queue")
+
+		err = s.auditQueue(r.Context(), rq, q, AuditQueueRemove, "", q, nil)
+		if err != nil {
+			l.Errorw("failed to audit queue removal", "err", err)
+			return err
+		}
 		return s.sendResponse(http.StatusNoContent, nil, w, r)
 	}
 }
@@ -497,15 +786,12 @@ func (s *Server) GetQueueStack(gs getQueueStack) E {
 	}
 }
 
-type canAddEntry interface {
-	CanAddEntry(ctx context.Context, queue ksuid.KSUID, email string) (bool, error)
-}
-
 type addQueueEntry interface {
+	addAuditLogEntry
+	getQueuePositions
 	getQueueEntries
-	getActiveQueueEntriesForUser
-	canAddEntry
-	GetEntryPriority(ctx context.Context, queue ksuid.KSUID, email string) (int, error)
+	getSignupEligibility
+	checkAllowedEmail
 	AddQueueEntry(context.Context, *QueueEntry) (*QueueEntry, error)
 }
 
@@ -521,29 +807,38 @@ func (s *Server) AddQueueEntry(ae addQueueEntry) E {
 			"email", email,
 		)
 
-		currentEntries, err := ae.GetActiveQueueEntriesForUser(r.Context(), q.ID, email)
+		err := s.ensureEmailAllowed(r.Context(), ae, &q.Course, email)
 		if err != nil {
-			l.Errorw("failed to fetch current queue entries for user", "err", err)
+			l.Warnw("user not allowed in course attempted queue sign up", "err", err)
 			return err
 		}
 
-		if len(currentEntries) > 0 {
-			l.Warnw("attempted queue sign up with already existing entry",
-				"conflicting_entry", currentEntries[0].ID,
-			)
+		eligibility, err := s.signupEligibility(r.Context(), ae, q, email)
+		if err != nil {
+			l.Errorw("failed to determine sign up eligibility", "err", err)
+			return err
+		}
+
+		if eligibility.AlreadyInQueue {
+			l.Warnw("attempted queue sign up with already existing entry")
 			return StatusError{
 				http.StatusConflict,
 				"Don't get greedy! You can only be on the queue once at a time.",
 			}
 		}
 
-		canSignUp, err := ae.CanAddEntry(r.Context(), q.ID, email)
-		if err != nil || !canSignUp {
-			l.Warnw("user attempting to sign up for queue not allowed to", "err", err, "user-agent", r.UserAgent())
-			return StatusError{
-				http.StatusForbidden,
-				"My records say you aren't allowed to sign up right now: " + err.Error() + ".",
+		if !eligibility.Eligible {
+			l.Warnw("user attempting to sign up for queue not allowed to", "reasons", eligibility.Reasons, "user-agent", r.UserAgent())
+			// The same reasons as the eligibility preview, so the client
+			// can tell what's wrong without picking apart the message.
+			resp := struct {
+				Message string                 `json:"message"`
+				Reasons []*IneligibilityReason `json:"reasons"`
+			}{
+				"My records say you aren't allowed to sign up right now: " + eligibility.Reasons[0].Message + ".",
+				eligibility.Reasons,
 			}
+			return s.sendResponse(http.StatusForbidden, resp, w, r)
 		}
 
 		var entry QueueEntry
@@ -569,12 +864,7 @@ func (s *Server) AddQueueEntry(ae addQueueEntry) E {
 			}
 		}
 
-		priority, err := ae.GetEntryPriority(r.Context(), q.ID, email)
-		if err != nil {
-			l.Errorw("failed to get entry priority", "err", err)
-			return err
-		}
-		entry.Priority = priority
+		entry.Priority = eligibility.Priority
 
 		newEntry, err := ae.AddQueueEntry(r.Context(), &entry)
 		if err != nil {
@@ -592,12 +882,24 @@ func (s *Server) AddQueueEntry(ae addQueueEntry) E {
 
 		l.Infow("created queue entry", "entry_id", newEntry.ID)
 
-		s.ps.Pub(WS("ENTRY_CREATE", newEntry), QueueTopicAdmin(q.ID))
-		s.ps.Pub(WS("ENTRY_CREATE", newEntry.Anonymized()), QueueTopicNonPrivileged(q.ID))
+		err = s.auditQueue(r.Context(), ae, q, AuditEntryAdd, newEntry.ID.String(), nil, newEntry)
+		if err != nil {
+			l.Errorw("failed to audit queue entry creation", "err", err)
+			return err
+		}
+
+		s.publish(r.Context(), q.ID, WS("ENTRY_CREATE", newEntry), QueueTopicAdmin(q.ID))
+		s.publish(r.Context(), q.ID, WS("ENTRY_CREATE", newEntry.Anonymized()), QueueTopicNonPrivileged(q.ID))
 
 		// Send an update with more information to the user who
 		// created the queue entry.
-		s.ps.Pub(WS("ENTRY_UPDATE", newEntry), QueueTopicEmail(q.ID, email))
+		s.publish(r.Context(), q.ID, WS("ENTRY_UPDATE", newEntry), QueueTopicEmail(q.ID, email))
+
+		err = s.publishPositions(r.Context(), ae, q)
+		if err != nil {
+			l.Errorw("failed to publish queue positions", "err", err)
+			return err
+		}
 
 		return s.sendResponse(http.StatusCreated, newEntry, w, r)
 	}
@@ -678,10 +980,13 @@ func (s *Server) UpdateQueueEntry(ue updateQueueEntry) E {
 		newEntry.Email = e.Email
 		newEntry.Pinned = e.Pinned
 		newEntry.Helping = e.Helping
+		newEntry.HelpingBy = e.HelpingBy
+		newEntry.HelpingName = e.HelpingName
+		newEntry.HelpingSince = e.HelpingSince
 		newEntry.Priority = e.Priority
 
-		s.ps.Pub(WS("ENTRY_UPDATE", &newEntry), QueueTopicAdmin(q.ID))
-		s.ps.Pub(WS("ENTRY_UPDATE", &newEntry), QueueTopicEmail(q.ID, email))
+		s.publish(r.Context(), q.ID, WS("ENTRY_UPDATE", &newEntry), QueueTopicAdmin(q.ID))
+		s.publish(r.Context(), q.ID, WS("ENTRY_UPDATE", newEntry.NoHelperEmail()), QueueTopicEmail(q.ID, email))
 
 		return s.sendResponse(http.StatusNoContent, nil, w, r)
 	}
@@ -692,6 +997,8 @@ type canRemoveQueueEntry interface {
 }
 
 type removeQueueEntry interface {
+	addAuditLogEntry
+	getQueuePositions
 	canRemoveQueueEntry
 	RemoveQueueEntry(ctx context.Context, entry ksuid.KSUID, remover string) (*RemovedQueueEntry, error)
 }
@@ -744,14 +1051,28 @@ func (s *Server) RemoveQueueEntry(re removeQueueEntry) E {
 			"time_spent", time.Now().Sub(e.ID.Time()),
 		)
 
-		s.ps.Pub(WS("ENTRY_REMOVE", e), QueueTopicAdmin(q.ID))
-		s.ps.Pub(WS("ENTRY_REMOVE", e.Anonymized()), QueueTopicNonPrivileged(q.ID))
+		err = s.auditQueue(r.Context(), re, q, AuditEntryRemove, e.ID.String(), nil, e)
+		if err != nil {
+			l.Errorw("failed to audit queue entry removal", "err", err)
+			return err
+		}
+
+		s.publish(r.Context(), q.ID, WS("ENTRY_REMOVE", e), QueueTopicAdmin(q.ID))
+		s.publish(r.Context(), q.ID, WS("ENTRY_REMOVE", e.Anonymized()), QueueTopicNonPrivileged(q.ID))
+
+		err = s.publishPositions(r.Context(), re, q)
+		if err != nil {
+			l.Errorw("failed to publish queue positions", "err", err)
+			return err
+		}
 
 		return s.sendResponse(http.StatusNoContent, nil, w, r)
 	}
 }
 
 type pinQueueEntry interface {
+	addAuditLogEntry
+	getQueuePositions
 	getQueueEntry
 	getActiveQueueEntriesForUser
 	PinQueueEntry(ctx context.Context, entry ksuid.KSUID) error
@@ -808,26 +1129,41 @@ func (s *Server) PinQueueEntry(pb pinQueueEntry) E {
 			return err
 		}
 
+		before := *entry
 		entry.Pinned = true
 
 		l.Infow("pinned queue entry")
 
-		s.ps.Pub(WS("STACK_REMOVE", entry), QueueTopicAdmin(q.ID))
-		s.ps.Pub(WS("ENTRY_CREATE", entry), QueueTopicAdmin(q.ID))
-		s.ps.Pub(WS("ENTRY_CREATE", entry.Anonymized()), QueueTopicNonPrivileged(q.ID))
+		err = s.auditQueue(r.Context(), pb, q, AuditEntryPin, entry.ID.String(), &before, entry)
+		if err != nil {
+			l.Errorw("failed to audit queue entry pin", "err", err)
+			return err
+		}
+
+		s.publish(r.Context(), q.ID, WS("STACK_REMOVE", entry), QueueTopicAdmin(q.ID))
+		s.publish(r.Context(), q.ID, WS("ENTRY_CREATE", entry), QueueTopicAdmin(q.ID))
+		s.publish(r.Context(), q.ID, WS("ENTRY_CREATE", entry.Anonymized()), QueueTopicNonPrivileged(q.ID))
 
 		// Send an update with more information to the user who
 		// created the queue entry.
-		s.ps.Pub(WS("ENTRY_UPDATE", entry), QueueTopicEmail(q.ID, email))
-		s.ps.Pub(WS("ENTRY_PINNED", entry), QueueTopicEmail(q.ID, entry.Email))
+		s.publish(r.Context(), q.ID, WS("ENTRY_UPDATE", entry), QueueTopicEmail(q.ID, email))
+		s.publish(r.Context(), q.ID, WS("ENTRY_PINNED", entry.NoHelperEmail()), QueueTopicEmail(q.ID, entry.Email))
+
+		err = s.publishPositions(r.Context(), pb, q)
+		if err != nil {
+			l.Errorw("failed to publish queue positions", "err", err)
+			return err
+		}
 
 		return s.sendResponse(http.StatusNoContent, nil, w, r)
 	}
 }
 
 type setQueueEntryHelping interface {
+	addAuditLogEntry
+	getQueuePositions
 	getQueueEntry
-	SetQueueEntryHelping(ctx context.Context, entry ksuid.KSUID, helping bool) error
+	SetQueueEntryHelping(ctx context.Context, entry ksuid.KSUID, helping bool, helper, helperName string) error
 }
 
 func (s *Server) SetQueueEntryHelping(eh setQueueEntryHelping) E {
@@ -879,24 +1215,63 @@ func (s *Server) SetQueueEntryHelping(eh setQueueEntryHelping) E {
 			}
 		}
 
-		err = eh.SetQueueEntryHelping(r.Context(), entryID, helping)
+		// Two staff members heading to the same student helps no one, so
+		// taking over someone else's student has to be asked for.
+		if helping && entry.Helping && entry.HelpingBy != nil && *entry.HelpingBy != email && r.URL.Query().Get("force") != "true" {
+			l.Infow("entry already being helped", "helping_by", *entry.HelpingBy)
+			helper := *entry.HelpingBy
+			if entry.HelpingName != nil && *entry.HelpingName != "" {
+				helper = *entry.HelpingName
+			}
+			return StatusError{
+				http.StatusConflict,
+				fmt.Sprintf("%s is already helping this student! If you're taking over, try again with `force=true`.", helper),
+			}
+		}
+
+		name, _ := r.Context().Value(firstNameContextKey).(string)
+		if name == "" {
+			name, _ = r.Context().Value(nameContextKey).(string)
+		}
+
+		err = eh.SetQueueEntryHelping(r.Context(), entryID, helping, email, name)
 		if err != nil {
 			l.Errorw("failed to set helping status", "err", err)
 			return err
 		}
 
-		entry.Helping = helping
+		before := entry
+		entry, err = eh.GetQueueEntry(r.Context(), entryID, true)
+		if err != nil {
+			l.Errorw("failed to get updated queue entry", "err", err)
+			return err
+		}
 
 		l.Infow("set helping status", "helping", helping)
 
-		s.ps.Pub(WS("ENTRY_UPDATE", entry.Anonymized()), QueueTopicGeneric(q.ID))
-		s.ps.Pub(WS("ENTRY_HELPING", entry), QueueTopicEmail(q.ID, entry.Email))
+		err = s.auditQueue(r.Context(), eh, q, AuditEntryHelping, entry.ID.String(), before, entry)
+		if err != nil {
+			l.Errorw("failed to audit helping status", "err", err)
+			return err
+		}
+
+		s.publish(r.Context(), q.ID, WS("ENTRY_UPDATE", entry), QueueTopicAdmin(q.ID))
+		s.publish(r.Context(), q.ID, WS("ENTRY_UPDATE", entry.Anonymized()), QueueTopicNonPrivileged(q.ID))
+		s.publish(r.Context(), q.ID, WS("ENTRY_HELPING", entry.NoHelperEmail()), QueueTopicEmail(q.ID, entry.Email))
+
+		err = s.publishPositions(r.Context(), eh, q)
+		if err != nil {
+			l.Errorw("failed to publish queue positions", "err", err)
+			return err
+		}
 
 		return s.sendResponse(http.StatusNoContent, nil, w, r)
 	}
 }
 
 type randomizeQueueEntries interface {
+	addAuditLogEntry
+	getQueuePositions
 	getQueueEntries
 	RandomizeQueueEntries(ctx context.Context, queue ksuid.KSUID) error
 }
@@ -926,11 +1301,37 @@ func (s *Server) RandomizeQueueEntries(re randomizeQueueEntries) E {
 			return err
 		}
 
-		s.ps.Pub(WS("QUEUE_RANDOMIZE", nil), QueueTopicGeneric(q.ID))
+		order := make([]ksuid.KSUID, 0, len(entries))
+		for _, e := range entries {
+			order = append(order, e.ID)
+		}
+		err = s.auditQueue(r.Context(), re, q, AuditQueueRandomize, "", nil, order)
+		if err != nil {
+			s.logger.Errorw("failed to audit queue randomization",
+				RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+				"queue_id", q.ID,
+				"email", email,
+				"err", err,
+			)
+			return err
+		}
+
+		s.publish(r.Context(), q.ID, WS("QUEUE_RANDOMIZE", nil), QueueTopicGeneric(q.ID))
 
 		for _, e := range entries {
-			s.ps.Pub(WS("ENTRY_UPDATE", e), QueueTopicAdmin(q.ID))
-			s.ps.Pub(WS("ENTRY_UPDATE", e.Anonymized()), QueueTopicNonPrivileged(q.ID))
+			s.publish(r.Context(), q.ID, WS("ENTRY_UPDATE", e), QueueTopicAdmin(q.ID))
+			s.publish(r.Context(), q.ID, WS("ENTRY_UPDATE", e.Anonymized()), QueueTopicNonPrivileged(q.ID))
+		}
+
+		err = s.publishPositions(r.Context(), re, q)
+		if err != nil {
+			s.logger.Errorw("failed to publish queue positions",
+				RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+				"queue_id", q.ID,
+				"email", email,
+				"err", err,
+			)
+			return err
 		}
 
 		s.logger.Infow("randomized queue",
@@ -944,6 +1345,8 @@ func (s *Server) RandomizeQueueEntries(re randomizeQueueEntries) E {
 }
 
 type clearQueueEntries interface {
+	addAuditLogEntry
+	getQueueEntries
 	ClearQueueEntries(ctx context.Context, queue ksuid.KSUID, remover string) error
 }
 
@@ -951,7 +1354,19 @@ func (s *Server) ClearQueueEntries(ce clearQueueEntries) E {
 	return func(w http.ResponseWriter, r *http.Request) error {
 		q := r.Context().Value(queueContextKey).(*Queue)
 		email := r.Context().Value(emailContextKey).(string)
-		err := ce.ClearQueueEntries(r.Context(), q.ID, email)
+
+		entries, err := ce.GetQueueEntries(r.Context(), q.ID, true)
+		if err != nil {
+			s.logger.Errorw("failed to get queue entries before clearing",
+				RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+				"queue_id", q.ID,
+				"email", email,
+				"err", err,
+			)
+			return err
+		}
+
+		err = ce.ClearQueueEntries(r.Context(), q.ID, email)
 		if err != nil {
 			s.logger.Errorw("failed to clear queue",
 				RequestIDContextKey, r.Context().Value(RequestIDContextKey),
@@ -968,14 +1383,26 @@ func (s *Server) ClearQueueEntries(ce clearQueueEntries) E {
 			"email", email,
 		)
 
-		s.ps.Pub(WS("QUEUE_CLEAR", email), QueueTopicAdmin(q.ID))
-		s.ps.Pub(WS("QUEUE_CLEAR", nil), QueueTopicNonPrivileged(q.ID))
+		err = s.auditQueue(r.Context(), ce, q, AuditQueueClear, "", entries, nil)
+		if err != nil {
+			s.logger.Errorw("failed to audit queue clear",
+				RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+				"queue_id", q.ID,
+				"email", email,
+				"err", err,
+			)
+			return err
+		}
+
+		s.publish(r.Context(), q.ID, WS("QUEUE_CLEAR", email), QueueTopicAdmin(q.ID))
+		s.publish(r.Context(), q.ID, WS("QUEUE_CLEAR", nil), QueueTopicNonPrivileged(q.ID))
 
 		return s.sendResponse(http.StatusNoContent, nil, w, r)
 	}
 }
 
 type addQueueAnnouncement interface {
+	addAuditLogEntry
 	AddQueueAnnouncement(context.Context, ksuid.KSUID, *Announcement) (*Announcement, error)
 }
 
@@ -1028,13 +1455,24 @@ func (s *Server) AddQueueAnnouncement(aa addQueueAnnouncement) E {
 			"announcement", newAnnouncement,
 		)
 
-		s.ps.Pub(WS("ANNOUNCEMENT_CREATE", newAnnouncement), QueueTopicGeneric(q.ID))
+		err = s.auditQueue(r.Context(), aa, q, AuditAnnouncementAdd, newAnnouncement.ID.String(), nil, newAnnouncement)
+		if err != nil {
+			s.logger.Errorw("failed to audit announcement creation",
+				RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+				"email", email,
+				"err", err,
+			)
+			return err
+		}
+
+		s.publish(r.Context(), q.ID, WS("ANNOUNCEMENT_CREATE", newAnnouncement), QueueTopicGeneric(q.ID))
 
 		return s.sendResponse(http.StatusCreated, newAnnouncement, w, r)
 	}
 }
 
 type removeQueueAnnouncement interface {
+	addAuditLogEntry
 	RemoveQueueAnnouncement(context.Context, ksuid.KSUID) error
 }
 
@@ -1072,87 +1510,17 @@ func (s *Server) RemoveQueueAnnouncement(ra removeQueueAnnouncement) E {
 			"email", r.Context().Value(emailContextKey),
 		)
 
-		s.ps.Pub(WS("ANNOUNCEMENT_DELETE", announcement.String()), QueueTopicGeneric(q.ID))
-
-		return s.sendResponse(http.StatusNoContent, nil, w, r)
-	}
-}
-
-type getQueueSchedule interface {
-	GetQueueSchedule(ctx context.Context, queue ksuid.KSUID) ([]string, error)
-}
-
-func (s *Server) GetQueueSchedule(gs getQueueSchedule) E {
-	return func(w http.ResponseWriter, r *http.Request) error {
-		q := r.Context().Value(queueContextKey).(*Queue)
-		schedules, err := gs.GetQueueSchedule(r.Context(), q.ID)
-		if err != nil {
-			s.logger.Errorw("failed to get queue schedule",
-				RequestIDContextKey, r.Context().Value(RequestIDContextKey),
-				"queue_id", q.ID,
-				"err", err,
-			)
-			return err
-		}
-
-		return s.sendResponse(http.StatusOK, schedules, w, r)
-	}
-}
-
-type updateQueueSchedule interface {
-	UpdateQueueSchedule(ctx context.Context, queue ksuid.KSUID, schedules []string) error
-}
-
-func (s *Server) UpdateQueueSchedule(us updateQueueSchedule) E {
-	return func(w http.ResponseWriter, r *http.Request) error {
-		q := r.Context().Value(queueContextKey).(*Queue)
-
-		var schedules []string
-		err := json.NewDecoder(r.Body).Decode(&schedules)
+		err = s.auditQueue(r.Context(), ra, q, AuditAnnouncementRemove, announcement.String(), nil, nil)
 		if err != nil {
-			s.logger.Warnw("failed to decode schedules",
+			s.logger.Errorw("failed to audit announcement removal",
 				RequestIDContextKey, r.Context().Value(RequestIDContextKey),
-				"queue_id", q.ID,
-				"err", err,
-			)
-			return StatusError{
-				http.StatusBadRequest,
-				"We couldn't read the schedules from the request body.",
-			}
-		}
-
-		for i, schedule := range schedules {
-			if len(schedule) != 48 {
-				s.logger.Warnw("got schedule with length not 48",
-					RequestIDContextKey, r.Context().Value(RequestIDContextKey),
-					"queue_id", q.ID,
-					"len", len(schedule),
-					"day", i,
-					"schedule", schedule,
-				)
-				return StatusError{
-					http.StatusBadRequest,
-					"Make sure your schedule is 48 characters long!",
-				}
-			}
-		}
-
-		err = us.UpdateQueueSchedule(r.Context(), q.ID, schedules)
-		if err != nil {
-			s.logger.Errorw("failed to update schedule",
-				RequestIDContextKey, r.Context().Value(RequestIDContextKey),
-				"queue_id", q.ID,
+				"announcement_id", announcement,
 				"err", err,
 			)
 			return err
 		}
 
-		s.logger.Infow("updated queue schedule",
-			RequestIDContextKey, r.Context().Value(RequestIDContextKey),
-			"queue_id", q.ID,
-		)
-
-		s.ps.Pub(WS("REFRESH", nil), QueueTopicGeneric(q.ID))
+		s.publish(r.Context(), q.ID, WS("ANNOUNCEMENT_DELETE", announcement.String()), QueueTopicGeneric(q.ID))
 
 		return s.sendResponse(http.StatusNoContent, nil, w, r)
 	}
@@ -1181,6 +1549,8 @@ func (s *Server) GetQueueConfiguration(gc getQueueConfiguration) E {
 }
 
 type updateQueueConfiguration interface {
+	addAuditLogEntry
+	getQueueConfiguration
 	UpdateQueueConfiguration(ctx context.Context, queue ksuid.KSUID, configuration *QueueConfiguration) error
 }
 
@@ -1202,6 +1572,33 @@ func (s *Server) UpdateQueueConfiguration(uc updateQueueConfiguration) E {
 			}
 		}
 
+		before, err := uc.GetQueueConfiguration(r.Context(), q.ID)
+		if err != nil {
+			s.logger.Errorw("failed to get queue configuration",
+				RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+				"queue_id", q.ID,
+				"err", err,
+			)
+			return err
+		}
+
+		// Clients from before there was an end-of-session policy don't
+		// send one, and shouldn't change it.
+		if config.EndOfSession == "" {
+			config.EndOfSession = before.EndOfSession
+		}
+		if !validEndOfSession(config.EndOfSession) {
+			s.logger.Warnw("got invalid end of session policy",
+				RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+				"queue_id", q.ID,
+				"end_of_session", config.EndOfSession,
+			)
+			return StatusError{
+				http.StatusBadRequest,
+				"The end of session policy should be keep, clear, or carry_over.",
+			}
+		}
+
 		err = uc.UpdateQueueConfiguration(r.Context(), q.ID, &config)
 		if err != nil {
 			s.logger.Errorw("failed to update queue configuration",
@@ -1217,13 +1614,28 @@ func (s *Server) UpdateQueueConfiguration(uc updateQueueConfiguration) E {
 			"configuration", config,
 		)
 
-		s.ps.Pub(WS("REFRESH", nil), QueueTopicGeneric(q.ID))
+		// The manual open status has its own endpoint, so it doesn't
+		// change here.
+		config.ID = q.ID
+		config.ManualOpen = before.ManualOpen
+		err = s.auditQueue(r.Context(), uc, q, AuditConfigurationUpdate, "", before, &config)
+		if err != nil {
+			s.logger.Errorw("failed to audit configuration update",
+				RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+				"queue_id", q.ID,
+				"err", err,
+			)
+			return err
+		}
+
+		s.publish(r.Context(), q.ID, WS("REFRESH", nil), QueueTopicGeneric(q.ID))
 
 		return s.sendResponse(http.StatusNoContent, nil, w, r)
 	}
 }
 
 type updateQueueOpenStatus interface {
+	addAuditLogEntry
 	UpdateQueueOpenStatus(ctx context.Context, queue ksuid.KSUID, open bool) error
 }
 
@@ -1264,7 +1676,17 @@ func (s *Server) UpdateQueueOpenStatus(uo updateQueueOpenStatus) E {
 			"open", open,
 		)
 
-		s.ps.Pub(WS("QUEUE_OPEN", open), QueueTopicGeneric(q.ID))
+		err = s.auditQueue(r.Context(), uo, q, AuditQueueOpen, "", nil, open)
+		if err != nil {
+			s.logger.Errorw("failed to audit queue open status",
+				RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+				"queue_id", q.ID,
+				"err", err,
+			)
+			return err
+		}
+
+		s.publish(r.Context(), q.ID, WS("QUEUE_OPEN", open), QueueTopicGeneric(q.ID))
 
 		return s.sendResponse(http.StatusNoContent, nil, w, r)
 	}
@@ -1303,7 +1725,7 @@ func (s *Server) SendMessage(sm sendMessage) E {
 		}
 
 		if message.Receiver == "<broadcast>" {
-			s.ps.Pub(WS("MESSAGE_CREATE", message), QueueTopicGeneric(q.ID))
+			s.publish(r.Context(), q.ID, WS("MESSAGE_CREATE", message), QueueTopicGeneric(q.ID))
 			l.Infow("broadcast to queue", "content", message.Content)
 			return s.sendResponse(http.StatusCreated, message, w, r)
 		}
@@ -1314,7 +1736,7 @@ func (s *Server) SendMessage(sm sendMessage) E {
 			return err
 		}
 
-		s.ps.Pub(WS("MESSAGE_CREATE", newMessage), QueueTopicEmail(q.ID, message.Receiver))
+		s.publish(r.Context(), q.ID, WS("MESSAGE_CREATE", newMessage), QueueTopicEmail(q.ID, message.Receiver))
 
 		return s.sendResponse(http.StatusCreated, newMessage, w, r)
 	}
@@ -1365,6 +1787,8 @@ func (s *Server) GetQueueGroups(gg getQueueGroups) E {
 }
 
 type updateQueueGroups interface {
+	addAuditLogEntry
+	getQueueGroups
 	UpdateQueueRoster(ctx context.Context, queue ksuid.KSUID, students []string) error
 	UpdateQueueGroups(ctx context.Context, queue ksuid.KSUID, groups [][]string) error
 }
@@ -1387,6 +1811,16 @@ func (s *Server) UpdateQueueGroups(ug updateQueueGroups) E {
 			}
 		}
 
+		before, err := ug.GetQueueGroups(r.Context(), q.ID)
+		if err != nil {
+			s.logger.Errorw("failed to get groups",
+				RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+				"queue_id", q.ID,
+				"err", err,
+			)
+			return err
+		}
+
 		err = ug.UpdateQueueGroups(r.Context(), q.ID, groups)
 		if err != nil {
 			s.logger.Errorw("failed to update groups",
@@ -1419,49 +1853,22 @@ func (s *Server) UpdateQueueGroups(ug updateQueueGroups) E {
 			"queue_id", q.ID,
 			"email", r.Context().Value(emailContextKey),
 		)
-		return s.sendResponse(http.StatusNoContent, nil, w, r)
-	}
-}
-
-func (s *Server) GetQueueLogs() E {
-	return func(w http.ResponseWriter, r *http.Request) error {
-		q := r.Context().Value(queueContextKey).(*Queue)
-		email := r.Context().Value(emailContextKey).(string)
-		l := s.logger.With(
-			RequestIDContextKey, r.Context().Value(RequestIDContextKey),
-			"queue_id", q.ID,
-			"email", email,
-		)
-
-		es, err := elastic.NewClient(elastic.SetURL("http://elasticsearch:9200"))
-		if err != nil {
-			l.Errorw("couldn't set up elastic connection", "err", err)
-			return err
-		}
-
-		result, err := es.Search().
-			Index("logstash-api-*").
-			Query(elastic.NewTermQuery("queue_id.keyword", q.ID.String())).
-			Sort("@timestamp", false).
-			Size(10000).
-			Do(r.Context())
 
+		err = s.auditQueue(r.Context(), ug, q, AuditRosterUpdate, "", before, groups)
 		if err != nil {
-			l.Errorw("failed to fetch elastic results", "err", err)
+			s.logger.Errorw("failed to audit roster update",
+				RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+				"queue_id", q.ID,
+				"err", err,
+			)
 			return err
 		}
-
-		var output []json.RawMessage
-		for _, hit := range result.Hits.Hits {
-			output = append(output, hit.Source)
-		}
-
-		l.Infow("fetched logs", "num_entries", len(result.Hits.Hits))
-		return s.sendResponse(http.StatusOK, output, w, r)
+		return s.sendResponse(http.StatusNoContent, nil, w, r)
 	}
 }
 
 type setNotHelped interface {
+	addAuditLogEntry
 	getQueueEntry
 	SetHelpedStatus(ctx context.Context, entry ksuid.KSUID, helped bool) error
 }
@@ -1503,12 +1910,19 @@ func (s *Server) SetNotHelped(sh setNotHelped) E {
 			return err
 		}
 
+		before := *entry
 		entry.Helped = false
 
 		l.Infow("set entry to not helped")
 
-		s.ps.Pub(WS("ENTRY_UPDATE", entry.RemovedEntry()), QueueTopicAdmin(q.ID))
-		s.ps.Pub(WS("NOT_HELPED", nil), QueueTopicEmail(q.ID, entry.Email))
+		err = s.auditQueue(r.Context(), sh, q, AuditEntryNotHelped, entry.ID.String(), before.RemovedEntry(), entry.RemovedEntry())
+		if err != nil {
+			l.Errorw("failed to audit not helped status", "err", err)
+			return err
+		}
+
+		s.publish(r.Context(), q.ID, WS("ENTRY_UPDATE", entry.RemovedEntry()), QueueTopicAdmin(q.ID))
+		s.publish(r.Context(), q.ID, WS("NOT_HELPED", nil), QueueTopicEmail(q.ID, entry.Email))
 
 		return s.sendResponse(http.StatusNoContent, nil, w, r)
 	}
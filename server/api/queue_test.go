@@ -0,0 +1,154 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/CarsonHoffman/office-hours-queue/server/api"
+)
+
+var testEntry = map[string]string{
+	"description": "Segfault in project 3",
+	"location":    "Table 4",
+}
+
+// reasons gets the codes of the reasons a sign up was refused.
+func reasons(t *testing.T, b []byte) []string {
+	t.Helper()
+	var resp struct {
+		Reasons []*api.IneligibilityReason `json:"reasons"`
+	}
+	err := json.Unmarshal(b, &resp)
+	if err != nil {
+		t.Fatalf("failed to decode refusal: %v", err)
+	}
+
+	codes := make([]string, len(resp.Reasons))
+	for i, r := range resp.Reasons {
+		codes[i] = r.Code
+	}
+	return codes
+}
+
+func TestOneActiveEntry(t *testing.T) {
+	ts := newTestServer(t)
+	q := ts.addQueue("ordered")
+	ts.openQueue(q, map[string]interface{}{})
+
+	const student = "student@example.edu"
+	var entry api.QueueEntry
+	ts.must(student, "POST", "/queues/"+q+"/entries", testEntry, &entry)
+
+	ts.expect(http.StatusConflict, student, "POST", "/queues/"+q+"/entries", testEntry)
+
+	var eligibility api.SignupEligibility
+	ts.must(student, "GET", "/queues/"+q+"/entries/eligibility", nil, &eligibility)
+	if eligibility.Eligible || !eligibility.AlreadyInQueue {
+		t.Errorf("eligibility with an entry = %+v, want already in queue", eligibility)
+	}
+
+	// Staff are held to it too.
+	ts.must(testTA, "POST", "/queues/"+q+"/entries", testEntry, nil)
+	ts.expect(http.StatusConflict, testTA, "POST", "/queues/"+q+"/entries", testEntry)
+
+	// Once the entry's gone, the student can sign up again.
+	ts.must(testTA, "DELETE", "/queues/"+q+"/entries/"+entry.ID.String(), nil, nil)
+	ts.must(student, "POST", "/queues/"+q+"/entries", testEntry, nil)
+}
+
+func TestTeammateInQueue(t *testing.T) {
+	ts := newTestServer(t)
+	q := ts.addQueue("ordered")
+	ts.openQueue(q, map[string]interface{}{"prevent_groups": true})
+
+	const (
+		alice = "alice@example.edu"
+		bob   = "bob@example.edu"
+		carol = "carol@example.edu"
+	)
+	ts.must(testAdmin, "PUT", "/queues/"+q+"/groups", [][]string{{alice, bob}}, nil)
+
+	var entry api.QueueEntry
+	ts.must(alice, "POST", "/queues/"+q+"/entries", testEntry, &entry)
+
+	b := ts.expect(http.StatusForbidden, bob, "POST", "/queues/"+q+"/entries", testEntry)
+	if r := reasons(t, b); len(r) != 1 || r[0] != api.IneligibleTeammateInQueue {
+		t.Errorf("teammate refused for %v, want [%s]", r, api.IneligibleTeammateInQueue)
+	}
+
+	// Someone outside the group isn't held back.
+	ts.must(carol, "POST", "/queues/"+q+"/entries", testEntry, nil)
+
+	ts.must(testTA, "DELETE", "/queues/"+q+"/entries/"+entry.ID.String(), nil, nil)
+	ts.must(bob, "POST", "/queues/"+q+"/entries", testEntry, nil)
+}
+
+func TestTeammateInQueueAllowed(t *testing.T) {
+	ts := newTestServer(t)
+	q := ts.addQueue("ordered")
+	ts.openQueue(q, map[string]interface{}{"prevent_groups": false})
+
+	const (
+		alice = "alice@example.edu"
+		bob   = "bob@example.edu"
+	)
+	ts.must(testAdmin, "PUT", "/queues/"+q+"/groups", [][]string{{alice, bob}}, nil)
+
+	ts.must(alice, "POST", "/queues/"+q+"/entries", testEntry, nil)
+	ts.must(bob, "POST", "/queues/"+q+"/entries", testEntry, nil)
+}
+
+func TestSetQueueEntryHelping(t *testing.T) {
+	ts := newTestServer(t)
+	q := ts.addQueue("ordered")
+	ts.openQueue(q, map[string]interface{}{})
+
+	const student = "student@example.edu"
+	var entry api.QueueEntry
+	ts.must(student, "POST", "/queues/"+q+"/entries", testEntry, &entry)
+	helping := "/queues/" + q + "/entries/" + entry.ID.String() + "/helping?helping=true"
+	ts.must(testTA, "PUT", helping, nil, nil)
+
+	// The student sees who's coming by name, but not their email.
+	var state struct {
+		Queue []*api.QueueEntry `json:"queue"`
+	}
+	ts.must(student, "GET", "/queues/"+q, nil, &state)
+	if len(state.Queue) != 1 {
+		t.Fatalf("got %d entries, want 1", len(state.Queue))
+	}
+	if e := state.Queue[0]; e.HelpingBy != nil || e.HelpingName == nil || *e.HelpingName != testTA || e.HelpingSince == nil {
+		t.Errorf("student sees helper %v named %v, want only the name %s", e.HelpingBy, e.HelpingName, testTA)
+	}
+
+	// Someone else has to say they're taking over.
+	ts.expect(http.StatusConflict, testAdmin, "PUT", helping, nil)
+	ts.must(testAdmin, "PUT", helping+"&force=true", nil, nil)
+	ts.must(student, "GET", "/queues/"+q, nil, &state)
+	if e := state.Queue[0]; e.HelpingName == nil || *e.HelpingName != testAdmin {
+		t.Errorf("student sees helper named %v after takeover, want %s", e.HelpingName, testAdmin)
+	}
+}
+
+func TestCooldownRoundsUp(t *testing.T) {
+	ts := newTestServer(t)
+	q := ts.addQueue("ordered")
+	ts.openQueue(q, map[string]interface{}{"cooldown": 1})
+
+	const student = "student@example.edu"
+	var entry api.QueueEntry
+	ts.must(student, "POST", "/queues/"+q+"/entries", testEntry, &entry)
+	ts.must(testTA, "DELETE", "/queues/"+q+"/entries/"+entry.ID.String(), nil, nil)
+
+	// Less than a second is left, which is still some cooldown.
+	var eligibility api.SignupEligibility
+	ts.must(student, "GET", "/queues/"+q+"/entries/eligibility", nil, &eligibility)
+	if eligibility.Eligible || eligibility.CooldownRemaining != 1 {
+		t.Errorf("eligibility right after being helped = %+v, want 1 second of cooldown", eligibility)
+	}
+	b := ts.expect(http.StatusForbidden, student, "POST", "/queues/"+q+"/entries", testEntry)
+	if r := reasons(t, b); len(r) != 1 || r[0] != api.IneligibleCooldown {
+		t.Errorf("sign up during cooldown refused for %v, want [%s]", r, api.IneligibleCooldown)
+	}
+}
@@ -0,0 +1,209 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// buckets is a set of token buckets, one per key, that each hold up to
+// burst tokens and refill at rate tokens per second. They're kept in
+// memory, so each instance of the server limits on its own.
+type buckets struct {
+	rate  float64
+	burst float64
+
+	lock      sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// parseBuckets reads a limit like "10/1m" (ten requests a minute, all of
+// which can be made at once). "off" means no limit.
+func parseBuckets(limit string) (*buckets, error) {
+	limit = strings.TrimSpace(limit)
+	if limit == "off" {
+		return nil, nil
+	}
+
+	parts := strings.SplitN(limit, "/", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("rate limit %q isn't of the form requests/period", limit)
+	}
+
+	n, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil || n <= 0 {
+		return nil, fmt.Errorf("rate limit %q doesn't have a positive number of requests", limit)
+	}
+
+	period, err := time.ParseDuration(strings.TrimSpace(parts[1]))
+	if err != nil || period <= 0 {
+		return nil, fmt.Errorf("rate limit %q doesn't have a positive period", limit)
+	}
+
+	return &buckets{
+		rate:    float64(n) / period.Seconds(),
+		burst:   float64(n),
+		buckets: make(map[string]*bucket),
+	}, nil
+}
+
+// take takes a token from key's bucket if it has one. If it doesn't, it
+// returns how long until it will.
+func (b *buckets) take(key string) (bool, time.Duration) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	now := time.Now()
+	b.sweep(now)
+
+	k, ok := b.buckets[key]
+	if !ok {
+		k = &bucket{tokens: b.burst}
+		b.buckets[key] = k
+	} else {
+		k.tokens = math.Min(b.burst, k.tokens+now.Sub(k.last).Seconds()*b.rate)
+	}
+	k.last = now
+
+	if k.tokens < 1 {
+		return false, time.Duration((1 - k.tokens) / b.rate * float64(time.Second))
+	}
+	k.tokens--
+	return true, 0
+}
+
+// sweep drops the buckets that have filled back up, since they're no
+// different from a bucket we haven't made yet. It only bothers once a
+// minute.
+func (b *buckets) sweep(now time.Time) {
+	if now.Sub(b.lastSweep) < time.Minute {
+		return
+	}
+	b.lastSweep = now
+
+	full := time.Duration(b.burst / b.rate * float64(time.Second))
+	for key, k := range b.buckets {
+		if now.Sub(k.last) >= full {
+			delete(b.buckets, key)
+		}
+	}
+}
+
+// rateLimit limits how often a kind of request can be made, both by each
+// user and from each IP address. Either can be nil to not limit by it.
+// Course staff can be let off entirely, for requests they make all the
+// time in the course of running the queue.
+type rateLimit struct {
+	name        string
+	email       *buckets
+	ip          *buckets
+	exemptStaff bool
+}
+
+// newRateLimit sets up the rate limit called name with the given default
+// limits, which can be overridden in limits by name (per user) and
+// name_ip (per IP address).
+func newRateLimit(limits map[string]string, name, emailDefault, ipDefault string, exemptStaff bool) (*rateLimit, error) {
+	if v, ok := limits[name]; ok {
+		emailDefault = v
+	}
+	if v, ok := limits[name+"_ip"]; ok {
+		ipDefault = v
+	}
+
+	email, err := parseBuckets(emailDefault)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s rate limit: %w", name, err)
+	}
+	ip, err := parseBuckets(ipDefault)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s IP rate limit: %w", name, err)
+	}
+
+	return &rateLimit{name, email, ip, exemptStaff}, nil
+}
+
+// clientIP gets the address the request came from. Behind a reverse proxy
+// (QUEUE_BEHIND_PROXY=true), that's the last address in X-Forwarded-For,
+// which is the one the proxy saw; the rest could be made up by anyone.
+func (s *Server) clientIP(r *http.Request) string {
+	if s.behindProxy {
+		forwarded := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+		if ip := strings.TrimSpace(forwarded[len(forwarded)-1]); ip != "" {
+			return ip
+		}
+	}
+
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+// RateLimit refuses requests once the user, or their IP address, has
+// made too many of the kind limited by rl, with a Retry-After telling
+// them when they can try again.
+func (s *Server) RateLimit(rl *rateLimit) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if role, ok := r.Context().Value(courseRoleContextKey).(CourseRole); ok && rl.exemptStaff && role.AtLeast(RoleTA) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			email, _ := r.Context().Value(emailContextKey).(string)
+			ip := s.clientIP(r)
+
+			by, wait := "", time.Duration(0)
+			if rl.email != nil && email != "" {
+				if ok, d := rl.email.take(email); !ok {
+					by, wait = "email", d
+				}
+			}
+			if rl.ip != nil && by == "" {
+				if ok, d := rl.ip.take(ip); !ok {
+					by, wait = "ip", d
+				}
+			}
+
+			if by == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			s.metrics.rateLimitedCounter.With(prometheus.Labels{"limit": rl.name, "by": by}).Inc()
+			s.logger.Warnw("rate limited request",
+				RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+				"email", email,
+				"ip", ip,
+				"limit", rl.name,
+				"by", by,
+			)
+
+			seconds := int(math.Ceil(wait.Seconds()))
+			if seconds < 1 {
+				seconds = 1
+			}
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			s.errorMessage(
+				http.StatusTooManyRequests,
+				fmt.Sprintf("Slow down! Try again in %d seconds.", seconds),
+				w, r,
+			)
+		})
+	}
+}
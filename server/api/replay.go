@@ -0,0 +1,174 @@
+package api
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/segmentio/ksuid"
+)
+
+// How long a queue can go without events before its replay state is
+// dropped. Anyone reconnecting after that gets a REFRESH, which they'd
+// want anyway.
+const replayIdleTimeout = 10 * time.Minute
+
+// ReplayBuffer keeps the most recent events sent to each topic, so a
+// WebSocket that drops and reconnects can pick up where it left off.
+// Brokers add every event they deliver, in sequence order.
+type ReplayBuffer struct {
+	size int
+
+	// floor is called the first time a queue is seen (or seen again after
+	// going idle), and returns the queue's current sequence number; no
+	// events up to and including it are available for replay.
+	floor func(queue ksuid.KSUID) (uint64, error)
+
+	queues map[ksuid.KSUID]*queueReplay
+	lock   sync.Mutex
+}
+
+type queueReplay struct {
+	// Events with sequence numbers at or below floor may have been
+	// missed entirely.
+	floor uint64
+
+	// The latest sequence number we know of.
+	seq uint64
+
+	topics map[string]*topicReplay
+	last   time.Time
+}
+
+type topicReplay struct {
+	events []*WSMessage
+
+	// The sequence number of the last event dropped off the front of
+	// events; anything at or below it can't be replayed for this topic.
+	evicted uint64
+}
+
+func NewReplayBuffer(size int, floor func(queue ksuid.KSUID) (uint64, error)) *ReplayBuffer {
+	b := &ReplayBuffer{
+		size:   size,
+		floor:  floor,
+		queues: make(map[ksuid.KSUID]*queueReplay),
+	}
+	go b.prune()
+	return b
+}
+
+func (b *ReplayBuffer) prune() {
+	ticker := time.NewTicker(replayIdleTimeout)
+	defer ticker.Stop()
+	for range ticker.C {
+		b.lock.Lock()
+		for id, q := range b.queues {
+			if time.Since(q.last) > replayIdleTimeout {
+				delete(b.queues, id)
+			}
+		}
+		b.lock.Unlock()
+	}
+}
+
+// Reset forgets everything, for when the broker knows it's missed
+// events.
+func (b *ReplayBuffer) Reset() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.queues = make(map[ksuid.KSUID]*queueReplay)
+}
+
+// Add records msg, which must already have its sequence number, as
+// having been sent to topics.
+func (b *ReplayBuffer) Add(queue ksuid.KSUID, msg *WSMessage, topics ...string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	q := b.queues[queue]
+	if q == nil {
+		// Everything before this event is unknown to us.
+		q = &queueReplay{floor: msg.Seq - 1, topics: make(map[string]*topicReplay)}
+		b.queues[queue] = q
+	}
+	q.seq = msg.Seq
+	q.last = time.Now()
+
+	for _, topic := range topics {
+		t := q.topics[topic]
+		if t == nil {
+			t = &topicReplay{}
+			q.topics[topic] = t
+		}
+
+		if len(t.events) == b.size {
+			t.evicted = t.events[0].Seq
+			t.events = t.events[1:]
+		}
+		t.events = append(t.events, msg)
+	}
+}
+
+// Since returns the events sent to any of topics after since, in order.
+// If some of them may no longer be available, ok is false, and the
+// client should start over.
+func (b *ReplayBuffer) Since(queue ksuid.KSUID, since uint64, topics ...string) (events []*WSMessage, ok bool, err error) {
+	b.lock.Lock()
+	_, seen := b.queues[queue]
+	b.lock.Unlock()
+
+	// Look up the floor without holding the lock, since it might go to
+	// the database. Events that arrive in the meantime are fine to miss
+	// here: the caller is already subscribed, so it'll get them live.
+	var floor uint64
+	if !seen {
+		floor, err = b.floor(queue)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	q := b.queues[queue]
+	if q == nil {
+		// Pruned while we weren't looking; start over.
+		if seen {
+			return nil, false, nil
+		}
+		q = &queueReplay{floor: floor, seq: floor, topics: make(map[string]*topicReplay), last: time.Now()}
+		b.queues[queue] = q
+	}
+
+	// A since from the future (say, from before a restart, or from an
+	// instance that's a bit ahead of this one) can't be trusted either.
+	if since < q.floor || since > q.seq {
+		return nil, false, nil
+	}
+
+	seqs := make(map[uint64]bool)
+	for _, topic := range topics {
+		t := q.topics[topic]
+		if t == nil {
+			continue
+		}
+		if since < t.evicted {
+			return nil, false, nil
+		}
+
+		for _, e := range t.events {
+			// The same event can be sent to more than one topic.
+			if e.Seq > since && !seqs[e.Seq] {
+				seqs[e.Seq] = true
+				events = append(events, e)
+			}
+		}
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Seq < events[j].Seq
+	})
+	return events, true, nil
+}
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/segmentio/ksuid"
+)
+
+// CourseRole is what a member of a course's staff is allowed to do in it.
+// Each role can do everything the roles below it can.
+type CourseRole string
+
+const (
+	// Can see everything staff can, but can't change anything.
+	RoleObserver CourseRole = "observer"
+	// Can run the queue: help students, remove and pin entries, post
+	// announcements, claim appointments and open or close the queue.
+	RoleTA CourseRole = "ta"
+	// Can also set queues up: create and update queues and their
+	// schedules and configuration, and upload rosters.
+	RoleHeadTA CourseRole = "head_ta"
+	// Can do anything, including removing queues and managing staff.
+	RoleInstructor CourseRole = "instructor"
+)
+
+var courseRoleRanks = map[CourseRole]int{
+	RoleObserver:   1,
+	RoleTA:         2,
+	RoleHeadTA:     3,
+	RoleInstructor: 4,
+}
+
+var courseRoleNames = map[CourseRole]string{
+	RoleObserver:   "an observer",
+	RoleTA:         "a TA",
+	RoleHeadTA:     "a head TA",
+	RoleInstructor: "an instructor",
+}
+
+// Valid reports whether r is one of the known roles.
+func (r CourseRole) Valid() bool {
+	_, ok := courseRoleRanks[r]
+	return ok
+}
+
+// AtLeast reports whether r can do everything min can. The empty role
+// (not on the course's staff at all) can't do anything.
+func (r CourseRole) AtLeast(min CourseRole) bool {
+	return r.Valid() && courseRoleRanks[r] >= courseRoleRanks[min]
+}
+
+// CourseAdmin is a member of a course's staff.
+type CourseAdmin struct {
+	Email string     `json:"email" db:"email"`
+	Role  CourseRole `json:"role" db:"role"`
+}
+
+// UnmarshalJSON accepts either an object or just an email, which leaves
+// the role empty; see resolveCourseAdmins.
+func (a *CourseAdmin) UnmarshalJSON(b []byte) error {
+	var email string
+	if err := json.Unmarshal(b, &email); err == nil {
+		*a = CourseAdmin{Email: email}
+		return nil
+	}
+
+	type courseAdmin CourseAdmin
+	return json.Unmarshal(b, (*courseAdmin)(a))
+}
+
+// resolveCourseAdmins fills in the roles of admins that were given as just
+// an email: they keep the role they already have, or become TAs if they're
+// new, so that a list of emails can still be sent back unchanged.
+func resolveCourseAdmins(admins, existing []*CourseAdmin) error {
+	roles := make(map[string]CourseRole, len(existing))
+	for _, a := range existing {
+		roles[a.Email] = a.Role
+	}
+
+	for _, a := range admins {
+		a.Email = strings.TrimSpace(a.Email)
+		if a.Email == "" {
+			return StatusError{
+				http.StatusBadRequest,
+				"One of the admins is missing an email.",
+			}
+		}
+
+		if a.Role == "" {
+			a.Role = roles[a.Email]
+			if a.Role == "" {
+				a.Role = RoleTA
+			}
+		}
+
+		if !a.Role.Valid() {
+			return StatusError{
+				http.StatusBadRequest,
+				`I haven't seen the role "` + string(a.Role) + `" before. Try observer, ta, head_ta or instructor.`,
+			}
+		}
+	}
+	return nil
+}
+
+const courseRoleContextKey = "course_role"
+
+type courseRole interface {
+	CourseRole(ctx context.Context, course ksuid.KSUID, email string) (CourseRole, error)
+}
+
+// EnsureCourseRole only lets through users with at least min in the course
+// set up by CheckCourseAdmin.
+func (s *Server) EnsureCourseRole(min CourseRole) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var courseID ksuid.KSUID
+			course, ok := r.Context().Value(courseContextKey).(*Course)
+			if ok {
+				courseID = course.ID
+			} else {
+				q := r.Context().Value(queueContextKey).(*Queue)
+				courseID = q.Course
+			}
+
+			email := r.Context().Value(emailContextKey).(string)
+			role := r.Context().Value(courseRoleContextKey).(CourseRole)
+			if !role.AtLeast(min) {
+				s.logger.Warnw("user without required role attempting to access resource",
+					RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+					"course_id", courseID,
+					"email", email,
+					"role", role,
+					"required_role", min,
+				)
+
+				message := "You shouldn't be here. :)"
+				if role.Valid() {
+					message = "You need to be " + courseRoleNames[min] + " or above to do that."
+				}
+				s.errorMessage(http.StatusForbidden, message, w, r)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -2,34 +2,31 @@ package api
 
 import (
 	"database/sql"
-	"io/ioutil"
+	"fmt"
 	"net/http"
-	"os"
-	"sync"
 
 	"github.com/antonlindstrom/pgstore"
-	"github.com/cskr/pubsub"
 	"github.com/go-chi/chi"
 	"github.com/gorilla/sessions"
-	"github.com/segmentio/ksuid"
 	"go.uber.org/zap"
-	"golang.org/x/oauth2"
 )
 
 type Server struct {
 	chi.Router
 
 	logger          *zap.SugaredLogger
-	sessions        *pgstore.PGStore
-	ps              *pubsub.PubSub
-	oauthConfig     oauth2.Config
+	sessions        sessions.Store
+	broker          Broker
+	loginProvider   LoginProvider
+	validDomains    []string
 	baseURL         string
+	behindProxy     bool
 	metricsPassword string
+	metrics         *metrics
 
-	// The number of WebSockets connected to each queue.
-	websocketCount        map[ksuid.KSUID]int
-	websocketCountByEmail map[ksuid.KSUID]map[string]int
-	websocketCountLock    sync.Mutex
+	entriesLimit       *rateLimit
+	messagesLimit      *rateLimit
+	announcementsLimit *rateLimit
 }
 
 // All of the abilities that a complete backing
@@ -38,18 +35,22 @@ type queueStore interface {
 	transactioner
 
 	siteAdmin
-	courseAdmin
+	courseRole
 	getUserInfo
 
 	getCourses
 	getCourse
-	getAdminCourses
+	getCourseRoles
 	addCourse
 	updateCourse
 	deleteCourse
 	getCourseAdmins
 	addCourseAdmins
 	removeCourseAdmins
+	checkAllowedEmail
+	getAllowedEmails
+	addAllowedEmails
+	removeAllowedEmails
 
 	getQueues
 	getQueue
@@ -72,6 +73,12 @@ type queueStore interface {
 	getCurrentDaySchedule
 	getQueueSchedule
 	updateQueueSchedule
+	getScheduleOverrides
+	getScheduledQueues
+	setScheduledOpen
+	endQueueSession
+	updateScheduleOverride
+	removeScheduleOverride
 	getQueueConfiguration
 	updateQueueConfiguration
 	updateQueueOpenStatus
@@ -82,6 +89,24 @@ type queueStore interface {
 	updateQueueGroups
 	setNotHelped
 	queueStats
+	getSignupEligibility
+	getHelpThroughput
+	getRemovedQueueEntries
+	exportQueueEntries
+	addAuditLogEntry
+	getAuditLog
+
+	useUserSession
+	addUserSession
+	getUserSessions
+	revokeUserSession
+	removeUserSessions
+
+	useAPIToken
+	getAPITokens
+	addAPIToken
+	removeAPIToken
+	getCourseAPITokens
 
 	getAppointment
 	getAppointments
@@ -97,56 +122,98 @@ type queueStore interface {
 	removeAppointmentSignup
 }
 
-func New(q queueStore, logger *zap.SugaredLogger, sessionsStore *sql.DB, oauthConfig oauth2.Config) *Server {
+// New sets up a server backed by q. sessionsStore is where sessions are
+// kept, or nil to keep them in the cookie; registry is where the server's
+// metrics go.
+func New(q queueStore, broker Broker, logger *zap.SugaredLogger, sessionsStore *sql.DB, loginProvider LoginProvider, config Config, registry Registry) (*Server, error) {
 	var s Server
-	s.websocketCount = make(map[ksuid.KSUID]int)
-	s.websocketCountByEmail = make(map[ksuid.KSUID]map[string]int)
+	s.broker = broker
 	s.logger = logger
 
-	key, err := ioutil.ReadFile(os.Getenv("QUEUE_SESSIONS_KEY_FILE"))
+	var err error
+	s.metrics, err = newMetrics(registry)
 	if err != nil {
-		logger.Fatalw("couldn't load sessions key", "err", err)
+		return nil, err
 	}
 
-	s.sessions, err = pgstore.NewPGStoreFromPool(sessionsStore, key)
-	if err != nil {
-		logger.Fatalw("couldn't set up session store", "err", err)
-	}
-	s.sessions.Options = &sessions.Options{
+	sessionOptions := &sessions.Options{
 		HttpOnly: true,
-		Secure:   os.Getenv("USE_SECURE_COOKIES") == "true",
-		MaxAge:   60 * 60 * 24 * 30,
+		Secure:   config.SecureCookies,
+		MaxAge:   int(sessionLifetime.Seconds()),
 		Path:     "/",
+		// Lax still sends the cookie when coming back from the login
+		// provider, but not with anything another site submits.
+		SameSite: http.SameSiteLaxMode,
 	}
 
-	metricsPassword, err := ioutil.ReadFile(os.Getenv("METRICS_PASSWORD_FILE"))
-	if err != nil {
-		logger.Fatalw("couldn't load metrics password", "err", err)
+	// Without a database to keep sessions in (e.g. when running against
+	// the in-memory store), fall back to keeping them in the cookie itself.
+	if sessionsStore != nil {
+		pg, err := pgstore.NewPGStoreFromPool(sessionsStore, config.SessionsKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to set up session store: %w", err)
+		}
+		pg.Options = sessionOptions
+		s.sessions = pg
+	} else {
+		cookies := sessions.NewCookieStore(config.SessionsKey)
+		cookies.Options = sessionOptions
+		s.sessions = cookies
+	}
+
+	s.metricsPassword = config.MetricsPassword
+
+	s.loginProvider = loginProvider
+
+	s.validDomains = parseValidDomains(config.ValidDomain)
+	if len(s.validDomains) == 0 {
+		logger.Warnw("no valid domains set; anyone who can log in can use the queue")
 	}
-	s.metricsPassword = string(metricsPassword)
 
-	// TODO: evaluate capacity choice for channel. This assumes that
-	// there isn't likely to be more than 5 events in "quick" succession
-	// to any particular connection, and reduces overall latency between
-	// sending on different connections in that case, but allocates room
-	// for 5 events on every connection. There isn't an empirical basis here.
-	// Just a guess.
-	s.ps = pubsub.New(5)
+	s.baseURL = config.BaseURL
+
+	s.behindProxy = config.BehindProxy
 
-	s.oauthConfig = oauthConfig
+	// Limits on the requests that get sent out to everyone watching the
+	// queue. IP limits are looser, since a whole lab can share an address,
+	// and staff aren't held to the entries limit since they remove entries
+	// all day.
+	s.entriesLimit, err = newRateLimit(config.RateLimits, "entries", "10/1m", "100/1m", true)
+	if err != nil {
+		return nil, err
+	}
+	s.messagesLimit, err = newRateLimit(config.RateLimits, "messages", "30/1m", "120/1m", false)
+	if err != nil {
+		return nil, err
+	}
+	s.announcementsLimit, err = newRateLimit(config.RateLimits, "announcements", "10/1m", "60/1m", false)
+	if err != nil {
+		return nil, err
+	}
 
-	s.baseURL = os.Getenv("QUEUE_BASE_URL")
+	err = s.registerQueueStats(q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register queue stats: %w", err)
+	}
+
+	go s.watchSchedules(q)
 
 	s.Router = chi.NewRouter()
-	s.Router.Use(instrumenter, ksuidInserter, s.recoverMiddleware, s.transaction(q), s.sessionRetriever)
+	s.Router.Use(s.instrumenter, ksuidInserter, s.recoverMiddleware, s.CSRFMiddleware)
+
+	// Metrics are scraped without a transaction, since collecting them
+	// reads the store on its own.
+	s.Method("GET", "/metrics", s.MetricsHandler())
+
+	r := s.With(s.transaction(q), s.sessionRetriever(q))
 
 	// Course endpoints
-	s.Route("/courses", func(r chi.Router) {
+	r.Route("/courses", func(r chi.Router) {
 		// Get all courses
 		r.Method("GET", "/", s.GetCourses(q))
 
 		// Create course (course admin)
-		r.With(s.ValidLoginMiddleware, s.EnsureSiteAdmin(q)).Method("POST", "/", s.AddCourse(q))
+		r.With(s.ValidLoginMiddleware(q), s.EnsureSiteAdmin(q)).Method("POST", "/", s.AddCourse(q))
 
 		// Course by ID endpoints
 		r.Route("/{id:[a-zA-Z0-9]{27}}", func(r chi.Router) {
@@ -158,89 +225,152 @@ func New(q queueStore, logger *zap.SugaredLogger, sessionsStore *sql.DB, oauthCo
 			// Get course's queues
 			r.Method("GET", "/queues", s.GetQueues(q))
 
-			// Update course (course admin)
-			r.With(s.ValidLoginMiddleware, s.CheckCourseAdmin(q), s.EnsureCourseAdmin).Method("PUT", "/", s.UpdateCourse(q))
+			// Update course (instructor)
+			r.With(s.ValidLoginMiddleware(q), s.CheckCourseAdmin(q), s.EnsureCourseRole(RoleInstructor)).Method("PUT", "/", s.UpdateCourse(q))
+
+			// Delete course (instructor)
+			r.With(s.ValidLoginMiddleware(q), s.CheckCourseAdmin(q), s.EnsureCourseRole(RoleInstructor)).Method("DELETE", "/", s.DeleteCourse(q))
+
+			// Create queue on course (head TA)
+			r.With(s.ValidLoginMiddleware(q), s.CheckCourseAdmin(q), s.EnsureCourseRole(RoleHeadTA)).Method("POST", "/queues", s.AddQueue(q))
+
+			// Export entries and appointments of all of the course's queues (head TA)
+			r.Route("/export", func(r chi.Router) {
+				r.Use(s.ValidLoginMiddleware(q), s.CheckCourseAdmin(q), s.EnsureCourseRole(RoleHeadTA))
+
+				r.Method("GET", "/entries", s.ExportQueueEntries(q))
+
+				r.Method("GET", "/appointments", s.ExportAppointments(q))
+			})
+
+			// Get course's audit log, including all of its queues (head TA)
+			r.With(s.ValidLoginMiddleware(q), s.CheckCourseAdmin(q), s.EnsureCourseRole(RoleHeadTA)).Method("GET", "/logs", s.GetAuditLog(q))
+
+			// Course-scoped API tokens (instructor)
+			r.Route("/tokens", func(r chi.Router) {
+				r.Use(s.ValidLoginMiddleware(q), s.RejectAPITokens, s.CheckCourseAdmin(q), s.EnsureCourseRole(RoleInstructor))
+
+				// Get API tokens scoped to course (instructor)
+				r.Method("GET", "/", s.GetCourseAPITokens(q))
+
+				// Revoke API token scoped to course (instructor)
+				r.Method("DELETE", "/{token_id:[a-zA-Z0-9]{27}}", s.RemoveAPIToken(q))
+			})
+
+			// Outside users allowed in the course despite not being in a
+			// valid domain
+			r.Route("/allowed-emails", func(r chi.Router) {
+				r.Use(s.ValidLoginMiddleware(q), s.CheckCourseAdmin(q), s.EnsureCourseAdmin)
+
+				// Get allowed emails (course admin)
+				r.Method("GET", "/", s.GetAllowedEmails(q))
 
-			r.With(s.ValidLoginMiddleware, s.CheckCourseAdmin(q), s.EnsureCourseAdmin).Method("DELETE", "/", s.DeleteCourse(q))
+				// Add allowed emails (instructor)
+				r.With(s.EnsureCourseRole(RoleInstructor)).Method("POST", "/", s.AddAllowedEmails(q))
 
-			// Create queue on course (course admin)
-			r.With(s.ValidLoginMiddleware, s.CheckCourseAdmin(q), s.EnsureCourseAdmin).Method("POST", "/queues", s.AddQueue(q))
+				// Overwrite allowed emails (instructor)
+				r.With(s.EnsureCourseRole(RoleInstructor)).Method("PUT", "/", s.UpdateAllowedEmails(q))
+
+				// Remove allowed emails (instructor)
+				r.With(s.EnsureCourseRole(RoleInstructor)).Method("DELETE", "/", s.RemoveAllowedEmails(q))
+			})
 
-			// Course admin management (course admin)
+			// Course admin management
 			r.Route("/admins", func(r chi.Router) {
-				r.Use(s.ValidLoginMiddleware, s.CheckCourseAdmin(q), s.EnsureCourseAdmin)
+				r.Use(s.ValidLoginMiddleware(q), s.CheckCourseAdmin(q), s.EnsureCourseAdmin)
 
-				// Get course admins (course admin)
+				// Get course admins and their roles (course admin)
 				r.Method("GET", "/", s.GetCourseAdmins(q))
 
-				// Add course admins (course admin)
-				r.Method("POST", "/", s.AddCourseAdmins(q))
+				// Add course admins (instructor)
+				r.With(s.EnsureCourseRole(RoleInstructor)).Method("POST", "/", s.AddCourseAdmins(q))
 
-				// Overwrite course admins (course admin)
-				r.Method("PUT", "/", s.UpdateCourseAdmins(q))
+				// Overwrite course admins (instructor)
+				r.With(s.EnsureCourseRole(RoleInstructor)).Method("PUT", "/", s.UpdateCourseAdmins(q))
 
-				// Remove course admins (course admin)
-				r.Method("DELETE", "/", s.RemoveCourseAdmins(q))
+				// Remove course admins (instructor)
+				r.With(s.EnsureCourseRole(RoleInstructor)).Method("DELETE", "/", s.RemoveCourseAdmins(q))
 			})
 		})
 	})
 
 	// Queue by ID endpoints
-	s.Route("/queues/{id:[a-zA-Z0-9]{27}}", func(r chi.Router) {
+	r.Route("/queues/{id:[a-zA-Z0-9]{27}}", func(r chi.Router) {
 		r.Use(s.QueueIDMiddleware(q), s.CheckCourseAdmin(q))
 
 		// Get queue by ID (more information with queue admin)
 		r.Method("GET", "/", s.GetQueue(q))
 
-		r.Method("GET", "/ws", s.QueueWebsocket())
+		r.Method("GET", "/ws", s.QueueWebsocket(q))
 
-		r.With(s.ValidLoginMiddleware, s.EnsureCourseAdmin).Method("PUT", "/", s.UpdateQueue(q))
+		// The same events as Server-Sent Events, for when WebSockets
+		// can't get through
+		r.Method("GET", "/events", s.QueueEventStream(q))
 
-		r.With(s.ValidLoginMiddleware, s.EnsureCourseAdmin).Method("DELETE", "/", s.RemoveQueue(q))
+		// Update queue (head TA)
+		r.With(s.ValidLoginMiddleware(q), s.EnsureCourseRole(RoleHeadTA)).Method("PUT", "/", s.UpdateQueue(q))
+
+		// Remove queue (instructor)
+		r.With(s.ValidLoginMiddleware(q), s.EnsureCourseRole(RoleInstructor)).Method("DELETE", "/", s.RemoveQueue(q))
 
 		// Get queue's stack (queue admin)
-		r.With(s.ValidLoginMiddleware, s.EnsureCourseAdmin).Method("GET", "/stack", s.GetQueueStack(q))
+		r.With(s.ValidLoginMiddleware(q), s.EnsureCourseAdmin).Method("GET", "/stack", s.GetQueueStack(q))
+
+		// Get wait time, help and throughput analytics (course admin)
+		r.With(s.ValidLoginMiddleware(q), s.EnsureCourseAdmin).Method("GET", "/stats", s.GetQueueAnalytics(q))
+
+		// Export queue's entries and appointments (head TA)
+		r.Route("/export", func(r chi.Router) {
+			r.Use(s.ValidLoginMiddleware(q), s.EnsureCourseRole(RoleHeadTA))
+
+			r.Method("GET", "/entries", s.ExportQueueEntries(q))
 
-		// Get queue logs (course admin)
-		r.With(s.ValidLoginMiddleware, s.EnsureCourseAdmin).Method("GET", "/logs", s.GetQueueLogs())
+			r.Method("GET", "/appointments", s.ExportAppointments(q))
+		})
+
+		// Get queue's audit log (head TA)
+		r.With(s.ValidLoginMiddleware(q), s.EnsureCourseRole(RoleHeadTA)).Method("GET", "/logs", s.GetAuditLog(q))
 
 		// Entry by ID endpoints
 		r.Route("/entries", func(r chi.Router) {
-			r.Use(s.ValidLoginMiddleware)
+			r.Use(s.ValidLoginMiddleware(q))
 
 			// Add queue entry (valid login)
-			r.Method("POST", "/", s.AddQueueEntry(q))
+			r.With(s.RateLimit(s.entriesLimit)).Method("POST", "/", s.AddQueueEntry(q))
+
+			// Check whether the user can sign up right now (valid login)
+			r.Method("GET", "/eligibility", s.GetSignupEligibility(q))
 
 			// Update queue entry (valid login, same user as creator)
 			r.Method("PUT", "/{entry_id:[a-zA-Z0-9]{27}}", s.UpdateQueueEntry(q))
 
 			// Remove queue entry (valid login, same user or queue admin)
-			r.Method("DELETE", "/{entry_id:[a-zA-Z0-9]{27}}", s.RemoveQueueEntry(q))
+			r.With(s.RateLimit(s.entriesLimit)).Method("DELETE", "/{entry_id:[a-zA-Z0-9]{27}}", s.RemoveQueueEntry(q))
 
-			// Pin queue entry (course admin)
-			r.With(s.EnsureCourseAdmin).Method("POST", "/{entry_id:[a-zA-Z0-9]{27}}/pin", s.PinQueueEntry(q))
+			// Pin queue entry (TA)
+			r.With(s.EnsureCourseRole(RoleTA)).Method("POST", "/{entry_id:[a-zA-Z0-9]{27}}/pin", s.PinQueueEntry(q))
 
-			// Set queue entry helped state (course admin)
-			r.With(s.EnsureCourseAdmin).Method("PUT", "/{entry_id:[a-zA-Z0-9]{27}}/helping", s.SetQueueEntryHelping(q))
+			// Set queue entry helped state (TA)
+			r.With(s.EnsureCourseRole(RoleTA)).Method("PUT", "/{entry_id:[a-zA-Z0-9]{27}}/helping", s.SetQueueEntryHelping(q))
 
-			// Set student not helped (queue admin)
-			r.With(s.EnsureCourseAdmin).Method("DELETE", "/{entry_id:[a-zA-Z0-9]{27}}/helped", s.SetNotHelped(q))
+			// Set student not helped (TA)
+			r.With(s.EnsureCourseRole(RoleTA)).Method("DELETE", "/{entry_id:[a-zA-Z0-9]{27}}/helped", s.SetNotHelped(q))
 
-			// Randomize queue (course admin)
-			r.With(s.ValidLoginMiddleware, s.EnsureCourseAdmin).Method("POST", "/randomize", s.RandomizeQueueEntries(q))
+			// Randomize queue (TA)
+			r.With(s.ValidLoginMiddleware(q), s.EnsureCourseRole(RoleTA)).Method("POST", "/randomize", s.RandomizeQueueEntries(q))
 
-			// Clear queue (queue admin)
-			r.With(s.EnsureCourseAdmin).Method("DELETE", "/", s.ClearQueueEntries(q))
+			// Clear queue (TA)
+			r.With(s.EnsureCourseRole(RoleTA)).Method("DELETE", "/", s.ClearQueueEntries(q))
 		})
 
 		// Announcements endpoints
 		r.Route("/announcements", func(r chi.Router) {
-			r.Use(s.ValidLoginMiddleware, s.EnsureCourseAdmin)
+			r.Use(s.ValidLoginMiddleware(q), s.EnsureCourseRole(RoleTA))
 
-			// Create announcement (queue admin)
-			r.Method("POST", "/", s.AddQueueAnnouncement(q))
+			// Create announcement (TA)
+			r.With(s.RateLimit(s.announcementsLimit)).Method("POST", "/", s.AddQueueAnnouncement(q))
 
-			// Remove announcement (queue admin)
+			// Remove announcement (TA)
 			r.Method("DELETE", "/{announcement_id:[a-zA-Z0-9]{27}}", s.RemoveQueueAnnouncement(q))
 		})
 
@@ -249,8 +379,26 @@ func New(q queueStore, logger *zap.SugaredLogger, sessionsStore *sql.DB, oauthCo
 			// Get queue schedule
 			r.Method("GET", "/", s.GetQueueSchedule(q))
 
-			// Update queue schedule (queue admin)
-			r.With(s.ValidLoginMiddleware, s.EnsureCourseAdmin).Method("PUT", "/", s.UpdateQueueSchedule(q))
+			// Update queue schedule (head TA)
+			r.With(s.ValidLoginMiddleware(q), s.EnsureCourseRole(RoleHeadTA)).Method("PUT", "/", s.UpdateQueueSchedule(q))
+
+			// Get queue schedule as intervals
+			r.Method("GET", "/intervals", s.GetQueueIntervals(q))
+
+			// Update queue schedule as intervals (head TA)
+			r.With(s.ValidLoginMiddleware(q), s.EnsureCourseRole(RoleHeadTA)).Method("PUT", "/intervals", s.UpdateQueueIntervals(q))
+
+			// Schedules for specific dates, replacing the weekly schedule
+			r.Route("/overrides", func(r chi.Router) {
+				// Get upcoming overrides
+				r.Method("GET", "/", s.GetScheduleOverrides(q))
+
+				// Set override for date (head TA)
+				r.With(s.ValidLoginMiddleware(q), s.EnsureCourseRole(RoleHeadTA)).Method("PUT", `/{date:\d{4}-\d{2}-\d{2}}`, s.UpdateScheduleOverride(q))
+
+				// Remove override for date (head TA)
+				r.With(s.ValidLoginMiddleware(q), s.EnsureCourseRole(RoleHeadTA)).Method("DELETE", `/{date:\d{4}-\d{2}-\d{2}}`, s.RemoveScheduleOverride(q))
+			})
 		})
 
 		// Queue configuration endpoints
@@ -258,28 +406,28 @@ func New(q queueStore, logger *zap.SugaredLogger, sessionsStore *sql.DB, oauthCo
 			// Get queue configuration
 			r.Method("GET", "/", s.GetQueueConfiguration(q))
 
-			// Update queue configuration (queue admin)
-			r.With(s.ValidLoginMiddleware, s.EnsureCourseAdmin).Method("PUT", "/", s.UpdateQueueConfiguration(q))
+			// Update queue configuration (head TA)
+			r.With(s.ValidLoginMiddleware(q), s.EnsureCourseRole(RoleHeadTA)).Method("PUT", "/", s.UpdateQueueConfiguration(q))
 
-			// Set manual queue open status (queue admin)
-			r.With(s.ValidLoginMiddleware, s.EnsureCourseAdmin).Method("PUT", "/manual-open", s.UpdateQueueOpenStatus(q))
+			// Set manual queue open status (TA)
+			r.With(s.ValidLoginMiddleware(q), s.EnsureCourseRole(RoleTA)).Method("PUT", "/manual-open", s.UpdateQueueOpenStatus(q))
 		})
 
-		// Send message (queue admin)
-		r.With(s.ValidLoginMiddleware, s.EnsureCourseAdmin).Method("POST", "/messages", s.SendMessage(q))
+		// Send message (TA)
+		r.With(s.ValidLoginMiddleware(q), s.EnsureCourseRole(RoleTA), s.RateLimit(s.messagesLimit)).Method("POST", "/messages", s.SendMessage(q))
 
 		// Get queue roster (queue admin)
-		r.With(s.ValidLoginMiddleware, s.EnsureCourseAdmin).Method("GET", "/roster", s.GetQueueRoster(q))
+		r.With(s.ValidLoginMiddleware(q), s.EnsureCourseAdmin).Method("GET", "/roster", s.GetQueueRoster(q))
 
 		// Queue groups endpoints
 		r.Route("/groups", func(r chi.Router) {
-			r.Use(s.ValidLoginMiddleware, s.EnsureCourseAdmin)
+			r.Use(s.ValidLoginMiddleware(q), s.EnsureCourseAdmin)
 
 			// Get queue groups (queue admin)
 			r.Method("GET", "/", s.GetQueueGroups(q))
 
-			// Update queue groups (queue admin)
-			r.Method("PUT", "/", s.UpdateQueueGroups(q))
+			// Update queue groups (head TA)
+			r.With(s.EnsureCourseRole(RoleHeadTA)).Method("PUT", "/", s.UpdateQueueGroups(q))
 		})
 
 		// Appointments endpoints
@@ -292,31 +440,31 @@ func New(q queueStore, logger *zap.SugaredLogger, sessionsStore *sql.DB, oauthCo
 				r.Method("GET", "/", s.GetAppointments(q))
 
 				// Get appointments for current user on day
-				r.With(s.ValidLoginMiddleware).Method("GET", "/@me", s.GetAppointmentsForCurrentUser(q))
+				r.With(s.ValidLoginMiddleware(q)).Method("GET", "/@me", s.GetAppointmentsForCurrentUser(q))
 
 				// Create appointment on day at timeslot
-				r.With(s.ValidLoginMiddleware, s.AppointmentTimeslotMiddleware).Method("POST", `/{timeslot:\d+}`, s.SignupForAppointment(q))
+				r.With(s.ValidLoginMiddleware(q), s.AppointmentTimeslotMiddleware).Method("POST", `/{timeslot:\d+}`, s.SignupForAppointment(q))
 
 				// Appointment claiming (queue admin)
 				r.Route(`/claims/{timeslot:\d+}`, func(r chi.Router) {
-					r.Use(s.ValidLoginMiddleware, s.EnsureCourseAdmin, s.AppointmentTimeslotMiddleware)
+					r.Use(s.ValidLoginMiddleware(q), s.EnsureCourseRole(RoleTA), s.AppointmentTimeslotMiddleware)
 
-					// Claim appointment on day at timeslot (queue admin)
+					// Claim appointment on day at timeslot (TA)
 					r.Method("PUT", "/", s.ClaimTimeslot(q))
 				})
 			})
 
 			// Existing appointment claims by ID (queue admin)
 			r.Route(`/claims/{appointment_id:[a-zA-Z0-9]{27}}`, func(r chi.Router) {
-				r.Use(s.ValidLoginMiddleware, s.EnsureCourseAdmin, s.AppointmentIDMiddleware(q))
+				r.Use(s.ValidLoginMiddleware(q), s.EnsureCourseRole(RoleTA), s.AppointmentIDMiddleware(q))
 
-				// Un-claim appointment (queue admin)
+				// Un-claim appointment (TA)
 				r.Method("DELETE", "/", s.UnclaimAppointment(q))
 			})
 
 			// Appointment by ID endpoints
 			r.Route(`/{appointment_id:[a-zA-Z0-9]{27}}`, func(r chi.Router) {
-				r.Use(s.ValidLoginMiddleware, s.AppointmentIDMiddleware(q))
+				r.Use(s.ValidLoginMiddleware(q), s.AppointmentIDMiddleware(q))
 
 				// Update appointment (valid login, same user as creator)
 				r.Method("PUT", "/", s.UpdateAppointment(q))
@@ -337,31 +485,65 @@ func New(q queueStore, logger *zap.SugaredLogger, sessionsStore *sql.DB, oauthCo
 					// Get appointment schedule for day
 					r.Method("GET", "/", s.GetAppointmentScheduleForDay(q))
 
-					// Update appointment schedule for day (queue admin)
-					r.With(s.ValidLoginMiddleware, s.EnsureCourseAdmin).Method("PUT", "/", s.UpdateAppointmentSchedule(q))
+					// Update appointment schedule for day (head TA)
+					r.With(s.ValidLoginMiddleware(q), s.EnsureCourseRole(RoleHeadTA)).Method("PUT", "/", s.UpdateAppointmentSchedule(q))
 				})
 			})
 		})
 	})
 
-	// Login handler (takes Google idtoken, sets up session)
-	s.Method("POST", "/login", s.Login())
+	// Login handler (takes an ID token from the login provider, sets up session)
+	r.Method("POST", "/login", s.Login(q))
 
-	s.Method("GET", "/oauth2login", s.OAuth2LoginLink())
+	r.Method("GET", "/oauth2login", s.OAuth2LoginLink())
 
-	s.Method("GET", "/oauth2callback", s.OAuth2Callback())
+	r.Method("GET", "/oauth2callback", s.OAuth2Callback(q))
 
-	s.Method("GET", "/logout", s.Logout())
+	r.Method("POST", "/logout", s.Logout(q))
 
-	s.With(s.ValidLoginMiddleware).Method("GET", "/users/@me", s.GetCurrentUserInfo(q))
+	r.With(s.ValidLoginMiddleware(q)).Method("GET", "/users/@me", s.GetCurrentUserInfo(q))
 
-	s.Method("GET", "/metrics", s.MetricsHandler())
+	// The current user's sessions (valid login, not with an API token)
+	r.Route("/users/@me/sessions", func(r chi.Router) {
+		r.Use(s.ValidLoginMiddleware(q), s.RejectAPITokens)
+
+		// Get active sessions
+		r.Method("GET", "/", s.GetUserSessions(q))
+
+		// Log a session out
+		r.Method("DELETE", "/{session_id:[a-zA-Z0-9]{27}}", s.RemoveUserSession(q))
+	})
+
+	// Log a user out everywhere (site admin)
+	r.With(s.ValidLoginMiddleware(q), s.EnsureSiteAdmin(q)).Method("DELETE", "/users/{email}/sessions", s.RemoveUserSessions(q))
+
+	// Impersonate another user for read-only requests (site admin, not with
+	// an API token)
+	r.With(s.ValidLoginMiddleware(q), s.RejectAPITokens, s.EnsureSiteAdmin(q)).Method("POST", "/users/@me/impersonation", s.StartImpersonation(q))
+
+	// Stop impersonating
+	r.Method("DELETE", "/users/@me/impersonation", s.StopImpersonation(q))
+
+	// Get site-wide audit log, like impersonations (site admin)
+	r.With(s.ValidLoginMiddleware(q), s.EnsureSiteAdmin(q)).Method("GET", "/logs", s.GetAuditLog(q))
+
+	// The current user's API tokens (valid login, not with an API token)
+	r.Route("/users/@me/tokens", func(r chi.Router) {
+		r.Use(s.ValidLoginMiddleware(q), s.RejectAPITokens)
+
+		// Get API tokens
+		r.Method("GET", "/", s.GetAPITokens(q))
+
+		// Create API token
+		r.Method("POST", "/", s.AddAPIToken(q))
+
+		// Revoke API token
+		r.Method("DELETE", "/{token_id:[a-zA-Z0-9]{27}}", s.RemoveAPIToken(q))
+	})
 
 	s.NotFound(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusNotFound)
 	})
 
-	s.RegisterQueueStats(q)
-
-	return &s
+	return &s, nil
 }
@@ -0,0 +1,330 @@
+package api
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/segmentio/ksuid"
+)
+
+const (
+	minutesPerDay      = 24 * 60
+	minutesPerHalfHour = 30
+	halfHoursPerDay    = minutesPerDay / minutesPerHalfHour
+)
+
+// ScheduleInterval is a stretch of a day during which a queue is open (o)
+// or open for early sign up (p). Start and End are minutes since midnight
+// in the course's time zone; End isn't included, so the last interval of
+// a day can end at 1440.
+type ScheduleInterval struct {
+	Start  int    `json:"start"`
+	End    int    `json:"end"`
+	Status string `json:"status"`
+}
+
+// DaySchedule is a queue's open intervals for one day, in order and not
+// overlapping. The queue is closed outside of them.
+type DaySchedule []ScheduleInterval
+
+// At is the status of the queue at minute of the day: c, o or p, like the
+// characters of a half-hour schedule string.
+func (d DaySchedule) At(minute int) byte {
+	for _, i := range d {
+		if minute >= i.Start && minute < i.End {
+			return i.Status[0]
+		}
+	}
+	return 'c'
+}
+
+// HalfHours is the schedule as the 48-character string older clients
+// know. A half hour that's open for any of it is shown as open (or open
+// for early sign up, if that's all it has), so a queue that opens at 4:15
+// shows as open from 4:00.
+func (d DaySchedule) HalfHours() string {
+	halfHours := []byte(strings.Repeat("c", halfHoursPerDay))
+	for _, i := range d {
+		for h := i.Start / minutesPerHalfHour; h*minutesPerHalfHour < i.End; h++ {
+			if halfHours[h] != 'o' {
+				halfHours[h] = i.Status[0]
+			}
+		}
+	}
+	return string(halfHours)
+}
+
+// ParseHalfHours turns a 48-character schedule string into intervals. The
+// string should already have passed validSchedule.
+func ParseHalfHours(schedule string) DaySchedule {
+	d := make(DaySchedule, 0)
+	for h := 0; h < len(schedule); h++ {
+		if schedule[h] == 'c' {
+			continue
+		}
+		d = append(d, ScheduleInterval{
+			Start:  h * minutesPerHalfHour,
+			End:    (h + 1) * minutesPerHalfHour,
+			Status: string(schedule[h]),
+		})
+	}
+	return d.merged()
+}
+
+// merged joins intervals that touch and have the same status. d must be in
+// order.
+func (d DaySchedule) merged() DaySchedule {
+	m := make(DaySchedule, 0, len(d))
+	for _, i := range d {
+		if n := len(m); n > 0 && m[n-1].End == i.Start && m[n-1].Status == i.Status {
+			m[n-1].End = i.End
+			continue
+		}
+		m = append(m, i)
+	}
+	return m
+}
+
+// Normalized checks that each interval is within the day, has a status of
+// o or p, and doesn't overlap another, and returns the intervals in order
+// with touching ones joined.
+func (d DaySchedule) Normalized() (DaySchedule, error) {
+	sorted := make(DaySchedule, len(d))
+	copy(sorted, d)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Start < sorted[j].Start
+	})
+
+	for n, i := range sorted {
+		if i.Start < 0 || i.End > minutesPerDay || i.Start >= i.End {
+			return nil, fmt.Errorf("interval %d-%d isn't within the day", i.Start, i.End)
+		}
+		if i.Status != "o" && i.Status != "p" {
+			return nil, fmt.Errorf("interval %d-%d has status %q", i.Start, i.End, i.Status)
+		}
+		if n > 0 && sorted[n-1].End > i.Start {
+			return nil, fmt.Errorf("interval %d-%d overlaps the one before it", i.Start, i.End)
+		}
+	}
+
+	return sorted.merged(), nil
+}
+
+// Value stores the schedule as JSON.
+func (d DaySchedule) Value() (driver.Value, error) {
+	if d == nil {
+		return nil, nil
+	}
+	return json.Marshal(d)
+}
+
+// Scan reads a schedule stored as JSON. Schedules from before intervals
+// are NULL, which leaves d nil for the store to fill in from the
+// half-hour schedule.
+func (d *DaySchedule) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*d = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, d)
+	case string:
+		return json.Unmarshal([]byte(v), d)
+	}
+	return fmt.Errorf("can't scan %T into a schedule", src)
+}
+
+// validSchedule is whether schedule is a day's worth of half hours, each
+// closed (c), open for early sign up (p), or open (o).
+func validSchedule(schedule string) bool {
+	if len(schedule) != halfHoursPerDay {
+		return false
+	}
+	return strings.Trim(schedule, "cop") == ""
+}
+
+// invalidIntervals is what we tell the user when their intervals don't
+// pass Normalized.
+var invalidIntervals = StatusError{
+	http.StatusBadRequest,
+	"Make sure each interval is within the day (0 to 1440 minutes), has a status of o or p, and doesn't overlap another.",
+}
+
+type getQueueSchedule interface {
+	GetQueueSchedule(ctx context.Context, queue ksuid.KSUID) ([]DaySchedule, error)
+}
+
+// GetQueueSchedule gets the queue's weekly schedule as 48-character
+// strings, one per day starting with Sunday.
+func (s *Server) GetQueueSchedule(gs getQueueSchedule) E {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		q := r.Context().Value(queueContextKey).(*Queue)
+		schedules, err := gs.GetQueueSchedule(r.Context(), q.ID)
+		if err != nil {
+			s.logger.Errorw("failed to get queue schedule",
+				RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+				"queue_id", q.ID,
+				"err", err,
+			)
+			return err
+		}
+
+		halfHours := make([]string, len(schedules))
+		for i, schedule := range schedules {
+			halfHours[i] = schedule.HalfHours()
+		}
+
+		return s.sendResponse(http.StatusOK, halfHours, w, r)
+	}
+}
+
+// GetQueueIntervals gets the queue's weekly schedule as intervals, one
+// list per day starting with Sunday.
+func (s *Server) GetQueueIntervals(gs getQueueSchedule) E {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		q := r.Context().Value(queueContextKey).(*Queue)
+		schedules, err := gs.GetQueueSchedule(r.Context(), q.ID)
+		if err != nil {
+			s.logger.Errorw("failed to get queue schedule",
+				RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+				"queue_id", q.ID,
+				"err", err,
+			)
+			return err
+		}
+
+		return s.sendResponse(http.StatusOK, schedules, w, r)
+	}
+}
+
+type updateQueueSchedule interface {
+	addAuditLogEntry
+	getQueueSchedule
+	UpdateQueueSchedule(ctx context.Context, queue ksuid.KSUID, schedules []DaySchedule) error
+}
+
+// UpdateQueueSchedule sets the queue's weekly schedule from 48-character
+// strings.
+func (s *Server) UpdateQueueSchedule(us updateQueueSchedule) E {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		q := r.Context().Value(queueContextKey).(*Queue)
+
+		var halfHours []string
+		err := json.NewDecoder(r.Body).Decode(&halfHours)
+		if err != nil {
+			s.logger.Warnw("failed to decode schedules",
+				RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+				"queue_id", q.ID,
+				"err", err,
+			)
+			return StatusError{
+				http.StatusBadRequest,
+				"We couldn't read the schedules from the request body.",
+			}
+		}
+
+		schedules := make([]DaySchedule, len(halfHours))
+		for i, schedule := range halfHours {
+			if !validSchedule(schedule) {
+				s.logger.Warnw("got invalid schedule",
+					RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+					"queue_id", q.ID,
+					"len", len(schedule),
+					"day", i,
+					"schedule", schedule,
+				)
+				return StatusError{
+					http.StatusBadRequest,
+					"Make sure your schedule is 48 characters long and only has c, o and p in it!",
+				}
+			}
+			schedules[i] = ParseHalfHours(schedule)
+		}
+
+		return s.updateQueueSchedule(us, q, schedules, w, r)
+	}
+}
+
+// UpdateQueueIntervals sets the queue's weekly schedule from intervals.
+func (s *Server) UpdateQueueIntervals(us updateQueueSchedule) E {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		q := r.Context().Value(queueContextKey).(*Queue)
+
+		var schedules []DaySchedule
+		err := json.NewDecoder(r.Body).Decode(&schedules)
+		if err != nil {
+			s.logger.Warnw("failed to decode schedules",
+				RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+				"queue_id", q.ID,
+				"err", err,
+			)
+			return StatusError{
+				http.StatusBadRequest,
+				"We couldn't read the schedules from the request body.",
+			}
+		}
+
+		for i, schedule := range schedules {
+			schedules[i], err = schedule.Normalized()
+			if err != nil {
+				s.logger.Warnw("got invalid schedule intervals",
+					RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+					"queue_id", q.ID,
+					"day", i,
+					"err", err,
+				)
+				return invalidIntervals
+			}
+		}
+
+		return s.updateQueueSchedule(us, q, schedules, w, r)
+	}
+}
+
+// updateQueueSchedule saves schedules, however they were given to us.
+func (s *Server) updateQueueSchedule(us updateQueueSchedule, q *Queue, schedules []DaySchedule, w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	l := s.logger.With(
+		RequestIDContextKey, ctx.Value(RequestIDContextKey),
+		"queue_id", q.ID,
+	)
+
+	// A week that's missing days would leave them without a schedule at
+	// all, and one with extra days would be looked up past its end.
+	if len(schedules) != 7 {
+		l.Warnw("got schedule without seven days", "days", len(schedules))
+		return StatusError{
+			http.StatusBadRequest,
+			"Make sure your schedule has all seven days of the week, starting with Sunday!",
+		}
+	}
+
+	before, err := us.GetQueueSchedule(ctx, q.ID)
+	if err != nil {
+		l.Errorw("failed to get queue schedule", "err", err)
+		return err
+	}
+
+	err = us.UpdateQueueSchedule(ctx, q.ID, schedules)
+	if err != nil {
+		l.Errorw("failed to update schedule", "err", err)
+		return err
+	}
+
+	l.Infow("updated queue schedule")
+
+	err = s.auditQueue(ctx, us, q, AuditScheduleUpdate, "", before, schedules)
+	if err != nil {
+		l.Errorw("failed to audit schedule update", "err", err)
+		return err
+	}
+
+	s.publish(ctx, q.ID, WS("REFRESH", nil), QueueTopicGeneric(q.ID))
+
+	return s.sendResponse(http.StatusNoContent, nil, w, r)
+}
@@ -0,0 +1,213 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/segmentio/ksuid"
+)
+
+// ScheduleOverride replaces a queue's weekly schedule on one date in the
+// course's time zone, for holidays and exam weeks. Schedule is the same
+// day as Intervals, in half hours, for older clients.
+type ScheduleOverride struct {
+	Queue     ksuid.KSUID `json:"queue" db:"queue"`
+	Date      string      `json:"date" db:"date"`
+	Schedule  string      `json:"schedule" db:"schedule"`
+	Intervals DaySchedule `json:"intervals" db:"intervals"`
+	Note      string      `json:"note" db:"note"`
+}
+
+type getScheduleOverrides interface {
+	// GetScheduleOverrides gets the queue's overrides on or after from,
+	// in date order.
+	GetScheduleOverrides(ctx context.Context, queue ksuid.KSUID, from string) ([]*ScheduleOverride, error)
+}
+
+// GetScheduleOverrides lists the queue's schedule overrides from today on,
+// in date order.
+func (s *Server) GetScheduleOverrides(gs getScheduleOverrides) E {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		q := r.Context().Value(queueContextKey).(*Queue)
+
+		overrides, err := gs.GetScheduleOverrides(r.Context(), q.ID, CurrentDate(q.Zone()))
+		if err != nil {
+			s.logger.Errorw("failed to get schedule overrides",
+				RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+				"queue_id", q.ID,
+				"err", err,
+			)
+			return err
+		}
+
+		return s.sendResponse(http.StatusOK, overrides, w, r)
+	}
+}
+
+type getScheduleOverride interface {
+	GetScheduleOverride(ctx context.Context, queue ksuid.KSUID, date string) (*ScheduleOverride, error)
+}
+
+type updateScheduleOverride interface {
+	addAuditLogEntry
+	getScheduleOverride
+	SetScheduleOverride(ctx context.Context, override *ScheduleOverride) error
+}
+
+// overrideDate reads the date in the URL, making sure it's a real one.
+func overrideDate(r *http.Request) (string, error) {
+	date := chi.URLParam(r, "date")
+	_, err := time.Parse(DateFormat, date)
+	return date, err
+}
+
+// UpdateScheduleOverride sets the queue's schedule for the date in the URL,
+// either to the given schedule or to closed all day.
+func (s *Server) UpdateScheduleOverride(us updateScheduleOverride) E {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		q := r.Context().Value(queueContextKey).(*Queue)
+		email := r.Context().Value(emailContextKey).(string)
+		l := s.logger.With(
+			RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+			"queue_id", q.ID,
+			"email", email,
+		)
+
+		date, err := overrideDate(r)
+		if err != nil {
+			l.Warnw("got invalid override date", "date", date, "err", err)
+			return StatusError{
+				http.StatusBadRequest,
+				"I couldn't read that date. Try one like 2021-03-01.",
+			}
+		}
+
+		var body struct {
+			Schedule  string      `json:"schedule"`
+			Intervals DaySchedule `json:"intervals"`
+			Closed    bool        `json:"closed"`
+			Note      string      `json:"note"`
+		}
+		err = json.NewDecoder(r.Body).Decode(&body)
+		if err != nil {
+			l.Warnw("failed to decode schedule override", "err", err)
+			return StatusError{
+				http.StatusBadRequest,
+				"We couldn't read the schedule override from the request body.",
+			}
+		}
+
+		var intervals DaySchedule
+		switch {
+		case body.Closed:
+			intervals = DaySchedule{}
+		case body.Intervals != nil:
+			intervals, err = body.Intervals.Normalized()
+			if err != nil {
+				l.Warnw("got invalid override intervals", "err", err)
+				return invalidIntervals
+			}
+		case validSchedule(body.Schedule):
+			intervals = ParseHalfHours(body.Schedule)
+		default:
+			l.Warnw("got invalid override schedule", "schedule", body.Schedule)
+			return StatusError{
+				http.StatusBadRequest,
+				"Make sure your schedule is 48 characters long and only has c, o and p in it, or give intervals, or set closed.",
+			}
+		}
+
+		before, err := us.GetScheduleOverride(r.Context(), q.ID, date)
+		if errors.Is(err, sql.ErrNoRows) {
+			before = nil
+		} else if err != nil {
+			l.Errorw("failed to get schedule override", "date", date, "err", err)
+			return err
+		}
+
+		override := &ScheduleOverride{
+			Queue:     q.ID,
+			Date:      date,
+			Schedule:  intervals.HalfHours(),
+			Intervals: intervals,
+			Note:      strings.TrimSpace(body.Note),
+		}
+		err = us.SetScheduleOverride(r.Context(), override)
+		if err != nil {
+			l.Errorw("failed to set schedule override", "date", date, "err", err)
+			return err
+		}
+
+		err = s.auditQueue(r.Context(), us, q, AuditScheduleOverrideUpdate, date, before, override)
+		if err != nil {
+			l.Errorw("failed to audit schedule override update", "err", err)
+			return err
+		}
+
+		l.Infow("set schedule override", "date", date)
+		s.publish(r.Context(), q.ID, WS("REFRESH", nil), QueueTopicGeneric(q.ID))
+		return s.sendResponse(http.StatusOK, override, w, r)
+	}
+}
+
+type removeScheduleOverride interface {
+	addAuditLogEntry
+	getScheduleOverride
+	RemoveScheduleOverride(ctx context.Context, queue ksuid.KSUID, date string) error
+}
+
+// RemoveScheduleOverride puts the date in the URL back on the weekly
+// schedule.
+func (s *Server) RemoveScheduleOverride(rs removeScheduleOverride) E {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		q := r.Context().Value(queueContextKey).(*Queue)
+		email := r.Context().Value(emailContextKey).(string)
+		l := s.logger.With(
+			RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+			"queue_id", q.ID,
+			"email", email,
+		)
+
+		notFound := StatusError{
+			http.StatusNotFound,
+			"There's no schedule override on that date.",
+		}
+
+		date, err := overrideDate(r)
+		if err != nil {
+			l.Warnw("got invalid override date", "date", date, "err", err)
+			return notFound
+		}
+
+		before, err := rs.GetScheduleOverride(r.Context(), q.ID, date)
+		if errors.Is(err, sql.ErrNoRows) {
+			l.Warnw("attempted to remove non-existent schedule override", "date", date)
+			return notFound
+		} else if err != nil {
+			l.Errorw("failed to get schedule override", "date", date, "err", err)
+			return err
+		}
+
+		err = rs.RemoveScheduleOverride(r.Context(), q.ID, date)
+		if err != nil {
+			l.Errorw("failed to remove schedule override", "date", date, "err", err)
+			return err
+		}
+
+		err = s.auditQueue(r.Context(), rs, q, AuditScheduleOverrideRemove, date, before, nil)
+		if err != nil {
+			l.Errorw("failed to audit schedule override removal", "err", err)
+			return err
+		}
+
+		l.Infow("removed schedule override", "date", date)
+		s.publish(r.Context(), q.ID, WS("REFRESH", nil), QueueTopicGeneric(q.ID))
+		return s.sendResponse(http.StatusNoContent, nil, w, r)
+	}
+}
@@ -0,0 +1,29 @@
+package api_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/CarsonHoffman/office-hours-queue/server/api"
+)
+
+func TestUpdateQueueScheduleDays(t *testing.T) {
+	ts := newTestServer(t)
+	q := ts.addQueue("ordered")
+
+	halfHours := func(days int) []string {
+		week := make([]string, days)
+		for i := range week {
+			week[i] = strings.Repeat("c", 48)
+		}
+		return week
+	}
+	for _, days := range []int{0, 6, 8} {
+		ts.expect(http.StatusBadRequest, testAdmin, "PUT", "/queues/"+q+"/schedule", halfHours(days))
+		ts.expect(http.StatusBadRequest, testAdmin, "PUT", "/queues/"+q+"/schedule/intervals", make([][]api.ScheduleInterval, days))
+	}
+
+	ts.must(testAdmin, "PUT", "/queues/"+q+"/schedule", halfHours(7), nil)
+	ts.must(testAdmin, "PUT", "/queues/"+q+"/schedule/intervals", make([][]api.ScheduleInterval, 7), nil)
+}
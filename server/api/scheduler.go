@@ -0,0 +1,201 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/segmentio/ksuid"
+)
+
+type getScheduledQueues interface {
+	// GetScheduledQueues gets every active ordered queue that opens and
+	// closes on its schedule.
+	GetScheduledQueues(ctx context.Context) ([]*Queue, error)
+}
+
+type setScheduledOpen interface {
+	// SetScheduledOpen records whether the queue's schedule has it open,
+	// and returns what was recorded before, or nil if nothing was. Another
+	// instance recording the same thing first makes it look unchanged.
+	SetScheduledOpen(ctx context.Context, queue ksuid.KSUID, open bool) (*bool, error)
+}
+
+type watchSchedules interface {
+	transactioner
+	getScheduledQueues
+	getCurrentDaySchedule
+	setScheduledOpen
+	endQueueSession
+}
+
+// watchSchedules publishes QUEUE_OPEN whenever a scheduled queue opens or
+// closes, so that clients sitting on the queue page hear about it without
+// having to ask. It runs for the life of the server.
+func (s *Server) watchSchedules(ws watchSchedules) {
+	for {
+		// Schedules change on the minute, so look just after each one
+		// starts.
+		now := time.Now()
+		time.Sleep(now.Truncate(time.Minute).Add(time.Minute + time.Second).Sub(now))
+
+		var queues []*Queue
+		err := s.inTransaction(ws, func(ctx context.Context) error {
+			var err error
+			queues, err = ws.GetScheduledQueues(ctx)
+			return err
+		})
+		if err != nil {
+			s.logger.Errorw("failed to get scheduled queues", "err", err)
+			continue
+		}
+
+		for _, q := range queues {
+			err := s.inTransaction(ws, func(ctx context.Context) error {
+				return s.checkSchedule(ctx, ws, q)
+			})
+			if err != nil {
+				s.logger.Errorw("failed to check queue schedule",
+					"queue_id", q.ID,
+					"err", err,
+				)
+			}
+		}
+	}
+}
+
+// checkSchedule publishes QUEUE_OPEN if q has opened or closed since it
+// was last checked.
+func (s *Server) checkSchedule(ctx context.Context, ws watchSchedules, q *Queue) error {
+	schedule, err := ws.GetCurrentDaySchedule(ctx, q.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get queue schedule: %w", err)
+	}
+	open := schedule.At(CurrentMinute(q.Zone())) != 'c'
+
+	was, err := ws.SetScheduledOpen(ctx, q.ID, open)
+	if err != nil {
+		return fmt.Errorf("failed to record scheduled open status: %w", err)
+	}
+
+	// The first time we see a queue, we don't know whether it just
+	// changed, and clients already got its status when they loaded it.
+	if was == nil || *was == open {
+		return nil
+	}
+
+	s.logger.Infow("queue changed open status on schedule",
+		"queue_id", q.ID,
+		"open", open,
+	)
+	s.publish(ctx, q.ID, WS("QUEUE_OPEN", open), QueueTopicGeneric(q.ID))
+
+	if !open {
+		return s.endSession(ctx, ws, q)
+	}
+	return nil
+}
+
+// carryOverBoost is how much the priority of carried-over entries goes
+// up: more than any entry gets when it's added, so they come before
+// everyone who signs up next session.
+const carryOverBoost = 10
+
+type endQueueSession interface {
+	addAuditLogEntry
+	getQueueConfiguration
+	clearQueueEntries
+	BoostQueueEntries(ctx context.Context, queue ksuid.KSUID, boost int) error
+}
+
+// endSession deals with the entries left in q when it closes on its
+// schedule, according to its end-of-session policy. Nobody in particular
+// did it, so it's recorded as the system's doing.
+func (s *Server) endSession(ctx context.Context, es endQueueSession, q *Queue) error {
+	config, err := es.GetQueueConfiguration(ctx, q.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get queue configuration: %w", err)
+	}
+
+	if config.EndOfSession != EndOfSessionClear && config.EndOfSession != EndOfSessionCarryOver {
+		return nil
+	}
+
+	entries, err := es.GetQueueEntries(ctx, q.ID, true)
+	if err != nil {
+		return fmt.Errorf("failed to get queue entries: %w", err)
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	switch config.EndOfSession {
+	case EndOfSessionClear:
+		err = es.ClearQueueEntries(ctx, q.ID, SystemActor)
+		if err != nil {
+			return fmt.Errorf("failed to clear queue: %w", err)
+		}
+
+		err = s.auditQueue(ctx, es, q, AuditQueueClear, "", entries, nil)
+		if err != nil {
+			return fmt.Errorf("failed to audit queue clear: %w", err)
+		}
+
+		s.publish(ctx, q.ID, WS("QUEUE_CLEAR", nil), QueueTopicGeneric(q.ID))
+	case EndOfSessionCarryOver:
+		err = es.BoostQueueEntries(ctx, q.ID, carryOverBoost)
+		if err != nil {
+			return fmt.Errorf("failed to boost queue entries: %w", err)
+		}
+
+		after, err := es.GetQueueEntries(ctx, q.ID, true)
+		if err != nil {
+			return fmt.Errorf("failed to get boosted queue entries: %w", err)
+		}
+
+		err = s.auditQueue(ctx, es, q, AuditQueueCarryOver, "", entries, after)
+		if err != nil {
+			return fmt.Errorf("failed to audit queue carry over: %w", err)
+		}
+
+		s.publish(ctx, q.ID, WS("REFRESH", nil), QueueTopicGeneric(q.ID))
+	}
+
+	s.logger.Infow("ended queue session",
+		"queue_id", q.ID,
+		"end_of_session", config.EndOfSession,
+		"entries", len(entries),
+	)
+	return nil
+}
+
+// inTransaction runs f in a transaction of its own, for work that isn't
+// part of a request, and publishes the events f publishes once it's
+// committed.
+func (s *Server) inTransaction(tr transactioner, f func(ctx context.Context) error) error {
+	tx, err := tr.BeginTx()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	var events outbox
+	ctx := context.WithValue(context.Background(), TransactionContextKey, tx)
+	ctx = context.WithValue(ctx, outboxContextKey, &events)
+
+	err = f(ctx)
+	if err != nil {
+		rollbackErr := tx.Rollback()
+		if rollbackErr != nil {
+			s.logger.Errorw("transaction rollback failed", "err", rollbackErr)
+		}
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	events.flush(s.broker)
+	return nil
+}
@@ -0,0 +1,171 @@
+package api_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/CarsonHoffman/office-hours-queue/server/api"
+	"github.com/segmentio/ksuid"
+)
+
+// queueState gets q's entries and stack as staff see them.
+func (ts *testServer) queueState(q string) ([]*api.QueueEntry, []*api.RemovedQueueEntry) {
+	ts.t.Helper()
+	var state struct {
+		Queue []*api.QueueEntry        `json:"queue"`
+		Stack []*api.RemovedQueueEntry `json:"stack"`
+	}
+	ts.must(testTA, "GET", "/queues/"+q, nil, &state)
+	return state.Queue, state.Stack
+}
+
+// auditLog gets q's audit log, newest first.
+func (ts *testServer) auditLog(q string) []*api.AuditLogEntry {
+	ts.t.Helper()
+	var log struct {
+		Entries []*api.AuditLogEntry `json:"entries"`
+	}
+	ts.must(testAdmin, "GET", "/queues/"+q+"/logs", nil, &log)
+	return log.Entries
+}
+
+// closeWithEntries closes q with two students on it and the given end of
+// session policy.
+func (ts *testServer) closeWithEntries(q, endOfSession string) {
+	ts.t.Helper()
+	ts.openQueue(q, map[string]interface{}{"end_of_session": endOfSession})
+	ts.must("alice@example.edu", "POST", "/queues/"+q+"/entries", testEntry, nil)
+	ts.must("bob@example.edu", "POST", "/queues/"+q+"/entries", testEntry, nil)
+
+	tx, err := ts.store.BeginTx()
+	if err != nil {
+		ts.t.Fatalf("failed to begin transaction: %v", err)
+	}
+	id, _ := ksuid.Parse(q)
+	queue, err := ts.store.GetQueue(context.WithValue(context.Background(), api.TransactionContextKey, tx), id)
+	tx.Rollback()
+	if err != nil {
+		ts.t.Fatalf("failed to get queue: %v", err)
+	}
+
+	err = ts.server.EndSession(ts.store, queue)
+	if err != nil {
+		ts.t.Fatalf("failed to end session: %v", err)
+	}
+}
+
+func TestEndOfSessionKeep(t *testing.T) {
+	ts := newTestServer(t)
+	q := ts.addQueue("ordered")
+	ts.closeWithEntries(q, api.EndOfSessionKeep)
+
+	entries, stack := ts.queueState(q)
+	if len(entries) != 2 || len(stack) != 0 {
+		t.Errorf("kept %d entries with %d removed, want 2 kept", len(entries), len(stack))
+	}
+	for _, e := range entries {
+		if e.Priority != 0 {
+			t.Errorf("kept entry with priority %d, want 0", e.Priority)
+		}
+	}
+}
+
+func TestEndOfSessionClear(t *testing.T) {
+	ts := newTestServer(t)
+	q := ts.addQueue("ordered")
+	ts.closeWithEntries(q, api.EndOfSessionClear)
+
+	entries, stack := ts.queueState(q)
+	if len(entries) != 0 || len(stack) != 2 {
+		t.Fatalf("left %d entries with %d removed, want 2 removed", len(entries), len(stack))
+	}
+	for _, e := range stack {
+		if e.RemovedBy != api.SystemActor {
+			t.Errorf("entry removed by %q, want %q", e.RemovedBy, api.SystemActor)
+		}
+	}
+
+	log := ts.auditLog(q)
+	if len(log) == 0 || log[0].Action != api.AuditQueueClear || log[0].Actor != api.SystemActor {
+		t.Errorf("last audit log entry is %+v, want a queue clear by %s", log[0], api.SystemActor)
+	}
+
+	// Entries cleared at the end of a session weren't helped, so students
+	// can sign up again right away.
+	ts.must("alice@example.edu", "POST", "/queues/"+q+"/entries", testEntry, nil)
+}
+
+func TestEndOfSessionCarryOver(t *testing.T) {
+	ts := newTestServer(t)
+	q := ts.addQueue("ordered")
+	ts.closeWithEntries(q, api.EndOfSessionCarryOver)
+
+	ts.must("carol@example.edu", "POST", "/queues/"+q+"/entries", testEntry, nil)
+
+	entries, stack := ts.queueState(q)
+	if len(entries) != 3 || len(stack) != 0 {
+		t.Fatalf("left %d entries with %d removed, want 3 left", len(entries), len(stack))
+	}
+	priorities := make(map[string]int)
+	for _, e := range entries {
+		priorities[e.Email] = e.Priority
+	}
+	for _, carried := range []string{"alice@example.edu", "bob@example.edu"} {
+		if priorities[carried] <= priorities["carol@example.edu"] {
+			t.Errorf("got priorities %v, want carried-over entries ahead of carol's", priorities)
+		}
+	}
+
+	var carriedOver bool
+	for _, l := range ts.auditLog(q) {
+		carriedOver = carriedOver || l.Action == api.AuditQueueCarryOver && l.Actor == api.SystemActor
+	}
+	if !carriedOver {
+		t.Errorf("audit log doesn't have a carry over by %s", api.SystemActor)
+	}
+}
+
+func TestScheduleChangeForgetsScheduledOpen(t *testing.T) {
+	ts := newTestServer(t)
+	q := ts.addQueue("ordered")
+	id, _ := ksuid.Parse(q)
+
+	// What the scheduler last saw, as it sees it next.
+	setScheduledOpen := func(open bool) *bool {
+		tx, err := ts.store.BeginTx()
+		if err != nil {
+			t.Fatalf("failed to begin transaction: %v", err)
+		}
+		defer tx.Commit()
+		was, err := ts.store.SetScheduledOpen(context.WithValue(context.Background(), api.TransactionContextKey, tx), id, open)
+		if err != nil {
+			t.Fatalf("failed to set scheduled open: %v", err)
+		}
+		return was
+	}
+
+	week := make([][]api.ScheduleInterval, 7)
+	for _, change := range []struct {
+		name string
+		f    func()
+	}{
+		{"configuration", func() {
+			ts.must(testAdmin, "PUT", "/queues/"+q+"/configuration", map[string]interface{}{"scheduled": true}, nil)
+		}},
+		{"schedule", func() {
+			ts.must(testAdmin, "PUT", "/queues/"+q+"/schedule/intervals", week, nil)
+		}},
+		{"override", func() {
+			ts.must(testAdmin, "PUT", "/queues/"+q+"/schedule/overrides/2030-01-01", map[string]interface{}{"intervals": []api.ScheduleInterval{}}, nil)
+		}},
+		{"override removal", func() {
+			ts.must(testAdmin, "DELETE", "/queues/"+q+"/schedule/overrides/2030-01-01", nil, nil)
+		}},
+	} {
+		setScheduledOpen(true)
+		change.f()
+		if was := setScheduledOpen(false); was != nil {
+			t.Errorf("after changing the %s, the scheduler saw the queue as open=%v, want nothing", change.name, *was)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package api_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/CarsonHoffman/office-hours-queue/server/api"
+	"github.com/CarsonHoffman/office-hours-queue/server/memstore"
+	"github.com/gorilla/sessions"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// testServer is a server backed by the in-memory store, for testing
+// requests end to end.
+type testServer struct {
+	t      *testing.T
+	server *api.Server
+	store  *memstore.Store
+	broker *api.LocalBroker
+	srv    *httptest.Server
+	key    []byte
+}
+
+func newTestServer(t *testing.T) *testServer {
+	return newTestServerIn(t, "example.edu")
+}
+
+// newTestServerIn is newTestServer with validDomain as the valid domain
+// (or none, if it's empty).
+func newTestServerIn(t *testing.T, validDomain string) *testServer {
+	store := memstore.New()
+	key := []byte("0123456789abcdef0123456789abcdef")
+	config := api.Config{
+		SessionsKey:     key,
+		MetricsPassword: "metrics",
+		ValidDomain:     validDomain,
+	}
+
+	broker := api.NewLocalBroker()
+	s, err := api.New(store, broker, zap.NewNop().Sugar(), nil, nil, config, prometheus.NewRegistry())
+	if err != nil {
+		t.Fatalf("failed to set up server: %v", err)
+	}
+
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	return &testServer{t, s, store, broker, srv, key}
+}
+
+// cookie logs email in, the way the login handler would.
+func (ts *testServer) cookie(email string) *http.Cookie {
+	tx, err := ts.store.BeginTx()
+	if err != nil {
+		ts.t.Fatalf("failed to begin transaction: %v", err)
+	}
+	ctx := context.WithValue(context.Background(), api.TransactionContextKey, tx)
+	us, err := ts.store.AddUserSession(ctx, &api.UserSession{
+		Email:     email,
+		UserAgent: "test",
+		CreatedAt: time.Now(),
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		ts.t.Fatalf("failed to add session: %v", err)
+	}
+	tx.Commit()
+
+	r := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	session, _ := sessions.NewCookieStore(ts.key).New(r, "session")
+	session.Values["session_id"] = us.ID.String()
+	session.Values["email"] = email
+	session.Values["profile_pic"] = ""
+	session.Values["name"] = email
+	session.Values["first_name"] = email
+	err = session.Save(r, w)
+	if err != nil {
+		ts.t.Fatalf("failed to save session: %v", err)
+	}
+	return w.Result().Cookies()[0]
+}
+
+// do makes a request as email (or nobody, if it's empty) with body as
+// JSON, and returns the status and response body.
+func (ts *testServer) do(email, method, path string, body interface{}) (int, []byte) {
+	var b []byte
+	if body != nil {
+		b, _ = json.Marshal(body)
+	}
+
+	r, err := http.NewRequest(method, ts.srv.URL+path, bytes.NewReader(b))
+	if err != nil {
+		ts.t.Fatalf("failed to make request: %v", err)
+	}
+	r.Header.Set("Origin", ts.srv.URL)
+	if email != "" {
+		r.AddCookie(ts.cookie(email))
+	}
+
+	resp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		ts.t.Fatalf("%s %s failed: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	rb, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		ts.t.Fatalf("failed to read response to %s %s: %v", method, path, err)
+	}
+	return resp.StatusCode, rb
+}
+
+// must is do for requests that have to succeed, decoding the response
+// into out if it's not nil.
+func (ts *testServer) must(email, method, path string, body, out interface{}) {
+	ts.t.Helper()
+	status, b := ts.do(email, method, path, body)
+	if status >= 300 {
+		ts.t.Fatalf("%s %s: got %d: %s", method, path, status, b)
+	}
+	if out != nil {
+		err := json.Unmarshal(b, out)
+		if err != nil {
+			ts.t.Fatalf("failed to decode response to %s %s: %v", method, path, err)
+		}
+	}
+}
+
+// expect fails the test unless a request gets status.
+func (ts *testServer) expect(status int, email, method, path string, body interface{}) []byte {
+	ts.t.Helper()
+	got, b := ts.do(email, method, path, body)
+	if got != status {
+		ts.t.Fatalf("%s %s as %q: got %d, want %d: %s", method, path, email, got, status, b)
+	}
+	return b
+}
+
+const (
+	testAdmin = "admin@example.edu"
+	testTA    = "ta@example.edu"
+)
+
+// addQueue sets up a course with testTA on staff and a queue of type
+// typ in it, and returns the queue's ID. testAdmin is a site admin.
+func (ts *testServer) addQueue(typ string) string {
+	ts.t.Helper()
+	ts.store.AddSiteAdmin(testAdmin)
+
+	var course api.Course
+	ts.must(testAdmin, "POST", "/courses", map[string]string{
+		"short_name": "EECS 280",
+		"full_name":  "Programming and Introductory Data Structures",
+		"time_zone":  "UTC",
+	}, &course)
+	ts.must(testAdmin, "POST", "/courses/"+course.ID.String()+"/admins", []api.CourseAdmin{{Email: testTA, Role: api.RoleTA}}, nil)
+
+	var queue api.Queue
+	ts.must(testAdmin, "POST", "/courses/"+course.ID.String()+"/queues", map[string]string{
+		"type": typ,
+		"name": "Office Hours",
+	}, &queue)
+	return queue.ID.String()
+}
+
+// openQueue takes q off its schedule and opens it, with the rest of its
+// configuration as in config.
+func (ts *testServer) openQueue(q string, config map[string]interface{}) {
+	ts.t.Helper()
+	config["scheduled"] = false
+	ts.must(testAdmin, "PUT", "/queues/"+q+"/configuration", config, nil)
+	ts.must(testAdmin, "PUT", "/queues/"+q+"/configuration/manual-open?open=true", nil, nil)
+}
@@ -0,0 +1,212 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/gorilla/sessions"
+	"github.com/segmentio/ksuid"
+)
+
+const sessionIDContextKey = "session_id"
+
+// How long a login lasts.
+const sessionLifetime = 30 * 24 * time.Hour
+
+// UserSession is a login, as seen by the user it belongs to. Every session
+// cookie refers to one by ID, so deleting it logs that browser out no
+// matter where the session itself is stored.
+type UserSession struct {
+	ID         ksuid.KSUID `json:"id" db:"id"`
+	Email      string      `json:"email" db:"email"`
+	UserAgent  string      `json:"user_agent" db:"user_agent"`
+	CreatedAt  time.Time   `json:"created_at" db:"created_at"`
+	LastSeenAt time.Time   `json:"last_seen_at" db:"last_seen_at"`
+	ExpiresAt  time.Time   `json:"expires_at" db:"expires_at"`
+
+	// Whether this is the session the request was made with.
+	Current bool `json:"current" db:"-"`
+}
+
+// LastSeenResolution is how out of date a session's last seen time (or an
+// API token's last used time) is allowed to get. Writing it on every
+// request would make every request a write, and nobody needs to know
+// which second a session was last seen anyway.
+const LastSeenResolution = 5 * time.Minute
+
+type useUserSession interface {
+	// UseUserSession gets the unexpired session with id, recording that
+	// it's been seen if it hasn't been in the last LastSeenResolution, or
+	// sql.ErrNoRows if there isn't one.
+	UseUserSession(ctx context.Context, id ksuid.KSUID) (*UserSession, error)
+}
+
+type removeUserSession interface {
+	RemoveUserSession(ctx context.Context, id ksuid.KSUID) error
+}
+
+type addUserSession interface {
+	removeUserSession
+	AddUserSession(ctx context.Context, session *UserSession) (*UserSession, error)
+}
+
+// saveLogin sets up the session for the user who just logged in.
+func (s *Server) saveLogin(as addUserSession, w http.ResponseWriter, r *http.Request, session *sessions.Session, info *UserInfo) error {
+	// Logging in again in the same browser replaces whatever login was
+	// there before.
+	oldID, _ := session.Values["session_id"].(string)
+	if old, err := ksuid.Parse(oldID); err == nil {
+		err = as.RemoveUserSession(r.Context(), old)
+		if err != nil {
+			return err
+		}
+	}
+	delete(session.Values, "impersonating")
+	delete(session.Values, "impersonating_until")
+
+	now := time.Now()
+	us, err := as.AddUserSession(r.Context(), &UserSession{
+		Email:     info.Email,
+		UserAgent: r.UserAgent(),
+		CreatedAt: now,
+		ExpiresAt: now.Add(sessionLifetime),
+	})
+	if err != nil {
+		return err
+	}
+
+	session.Values["session_id"] = us.ID.String()
+	session.Values["email"] = info.Email
+	session.Values["profile_pic"] = info.Picture
+	session.Values["name"] = info.Name
+	session.Values["first_name"] = info.FirstName
+	return s.sessions.Save(r, w, session)
+}
+
+type getUserSessions interface {
+	GetUserSessions(ctx context.Context, email string) ([]*UserSession, error)
+}
+
+// GetUserSessions lists the user's active sessions, most recent first.
+func (s *Server) GetUserSessions(gs getUserSessions) E {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		email := r.Context().Value(emailContextKey).(string)
+		current, _ := r.Context().Value(sessionIDContextKey).(ksuid.KSUID)
+
+		userSessions, err := gs.GetUserSessions(r.Context(), email)
+		if err != nil {
+			s.logger.Errorw("failed to get sessions",
+				RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+				"email", email,
+				"err", err,
+			)
+			return err
+		}
+
+		for _, us := range userSessions {
+			us.Current = us.ID == current
+		}
+
+		return s.sendResponse(http.StatusOK, userSessions, w, r)
+	}
+}
+
+type revokeUserSession interface {
+	removeUserSession
+	GetUserSession(ctx context.Context, id ksuid.KSUID) (*UserSession, error)
+}
+
+// RemoveUserSession logs one of the user's sessions out.
+func (s *Server) RemoveUserSession(rs revokeUserSession) E {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		email := r.Context().Value(emailContextKey).(string)
+		l := s.logger.With(
+			RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+			"email", email,
+		)
+
+		notFound := StatusError{
+			http.StatusNotFound,
+			"I couldn't find that session. Maybe it's already logged out?",
+		}
+
+		id, err := ksuid.Parse(chi.URLParam(r, "session_id"))
+		if err != nil {
+			l.Warnw("failed to parse session ID", "session_id", chi.URLParam(r, "session_id"), "err", err)
+			return notFound
+		}
+		l = l.With("session_id", id)
+
+		us, err := rs.GetUserSession(r.Context(), id)
+		if errors.Is(err, sql.ErrNoRows) {
+			l.Warnw("attempted to revoke non-existent session")
+			return notFound
+		} else if err != nil {
+			l.Errorw("failed to get session", "err", err)
+			return err
+		}
+
+		if us.Email != email {
+			l.Warnw("attempted to revoke other user's session", "owner", us.Email)
+			return notFound
+		}
+
+		err = rs.RemoveUserSession(r.Context(), id)
+		if err != nil {
+			l.Errorw("failed to revoke session", "err", err)
+			return err
+		}
+
+		l.Infow("revoked session")
+		return s.sendResponse(http.StatusNoContent, nil, w, r)
+	}
+}
+
+type removeUserSessions interface {
+	addAuditLogEntry
+	RemoveUserSessions(ctx context.Context, email string) (int, error)
+	RemoveAPITokens(ctx context.Context, email string) (int, error)
+}
+
+// RemoveUserSessions logs the user in the URL out everywhere, for when
+// they shouldn't have access anymore (like a TA leaving). Their API tokens
+// are revoked too, since they'd otherwise keep working as them.
+func (s *Server) RemoveUserSessions(rs removeUserSessions) E {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		email := r.Context().Value(emailContextKey).(string)
+		target := chi.URLParam(r, "email")
+		l := s.logger.With(
+			RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+			"email", email,
+			"target", target,
+		)
+
+		n, err := rs.RemoveUserSessions(r.Context(), target)
+		if err != nil {
+			l.Errorw("failed to revoke sessions", "err", err)
+			return err
+		}
+
+		tokens, err := rs.RemoveAPITokens(r.Context(), target)
+		if err != nil {
+			l.Errorw("failed to revoke API tokens", "err", err)
+			return err
+		}
+
+		err = s.auditSite(r.Context(), rs, AuditSessionsRemove, target, nil, map[string]int{
+			"sessions":   n,
+			"api_tokens": tokens,
+		})
+		if err != nil {
+			l.Errorw("failed to audit session revocation", "err", err)
+			return err
+		}
+
+		l.Infow("revoked all sessions", "sessions", n, "api_tokens", tokens)
+		return s.sendResponse(http.StatusNoContent, nil, w, r)
+	}
+}
@@ -0,0 +1,129 @@
+package api_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/CarsonHoffman/office-hours-queue/server/api"
+	"github.com/gorilla/sessions"
+)
+
+// request makes a GET request to path with whatever credentials set
+// adds, returning the response with its body closed.
+func (ts *testServer) request(path string, set func(r *http.Request)) *http.Response {
+	ts.t.Helper()
+	r, err := http.NewRequest("GET", ts.srv.URL+path, nil)
+	if err != nil {
+		ts.t.Fatalf("failed to make request: %v", err)
+	}
+	set(r)
+
+	resp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		ts.t.Fatalf("GET %s failed: %v", path, err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func TestUntrackedSession(t *testing.T) {
+	ts := newTestServer(t)
+	ts.store.AddSiteAdmin(testAdmin)
+	const student = "student@example.edu"
+
+	// A cookie from before sessions were tracked.
+	r := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	session, _ := sessions.NewCookieStore(ts.key).New(r, "session")
+	session.Values["email"] = student
+	session.Values["profile_pic"] = ""
+	session.Values["name"] = student
+	session.Values["first_name"] = student
+	err := session.Save(r, w)
+	if err != nil {
+		t.Fatalf("failed to save session: %v", err)
+	}
+	legacy := w.Result().Cookies()[0]
+
+	resp := ts.request("/users/@me", func(r *http.Request) { r.AddCookie(legacy) })
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("untracked session got %d, want it logged in", resp.StatusCode)
+	}
+	cookies := resp.Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("got %d cookies for an untracked session, want one tracking it", len(cookies))
+	}
+	tracked := cookies[0]
+
+	var userSessions []*api.UserSession
+	ts.must(student, "GET", "/users/@me/sessions", nil, &userSessions)
+	if len(userSessions) != 2 {
+		t.Errorf("got %d sessions, want the tracked one and the test's", len(userSessions))
+	}
+
+	// Now it can be logged out like any other.
+	ts.must(testAdmin, "DELETE", "/users/"+student+"/sessions", nil, nil)
+	resp = ts.request("/users/@me", func(r *http.Request) { r.AddCookie(tracked) })
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("revoked session got %d, want %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+}
+
+func TestRemoveUserSessionsRevokesAPITokens(t *testing.T) {
+	ts := newTestServer(t)
+	ts.store.AddSiteAdmin(testAdmin)
+
+	var token struct {
+		Token string `json:"token"`
+	}
+	ts.must(testTA, "POST", "/users/@me/tokens", map[string]interface{}{
+		"name":   "Grading script",
+		"scopes": []string{api.APITokenScopeRead},
+	}, &token)
+	bearer := func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token.Token) }
+
+	if resp := ts.request("/users/@me", bearer); resp.StatusCode != http.StatusOK {
+		t.Fatalf("new API token got %d, want it logged in", resp.StatusCode)
+	}
+
+	ts.must(testAdmin, "DELETE", "/users/"+testTA+"/sessions", nil, nil)
+	if resp := ts.request("/users/@me", bearer); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("API token of a user logged out everywhere got %d, want %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+}
+
+func TestBasicAuthIsNotAnAPIToken(t *testing.T) {
+	ts := newTestServer(t)
+	q := ts.addQueue("ordered")
+	ts.openQueue(q, map[string]interface{}{})
+	const student = "student@example.edu"
+	cookie := ts.cookie(student)
+
+	// Like a staging site behind a proxy with Basic auth.
+	basic := func(r *http.Request) {
+		r.SetBasicAuth("staging", "hunter2")
+		r.AddCookie(cookie)
+	}
+	if resp := ts.request("/users/@me", basic); resp.StatusCode != http.StatusOK {
+		t.Errorf("session with Basic auth got %d, want it logged in", resp.StatusCode)
+	}
+	if resp := ts.request("/queues/"+q, func(r *http.Request) { r.SetBasicAuth("staging", "hunter2") }); resp.StatusCode != http.StatusOK {
+		t.Errorf("public page with Basic auth got %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	// The browser sends Basic auth by itself, so it doesn't get a request
+	// from another site past the CSRF check.
+	r, _ := http.NewRequest("POST", ts.srv.URL+"/queues/"+q+"/entries", strings.NewReader(`{"description":"a","location":"b"}`))
+	r.Header.Set("Origin", "https://evil.example.com")
+	basic(r)
+	resp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("cross-site request with Basic auth got %d, want %d", resp.StatusCode, http.StatusForbidden)
+	}
+}
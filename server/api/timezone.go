@@ -0,0 +1,57 @@
+package api
+
+import (
+	"context"
+	"time"
+)
+
+// Location loads the IANA time zone name. Courses without one (and, just
+// in case, ones whose zone has since disappeared from the zone database)
+// use the server's.
+func Location(name string) *time.Location {
+	if name == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
+// validTimeZone is whether name is an IANA time zone we can use, or empty
+// for the server's.
+func validTimeZone(name string) bool {
+	if name == "" {
+		return true
+	}
+	// LoadLocation treats "Local" as the server's zone, and would let
+	// "UTC" through anyway; only real zone names should be stored.
+	if name == "Local" {
+		return false
+	}
+	_, err := time.LoadLocation(name)
+	return err == nil
+}
+
+// Zone is the time zone the course's schedules and appointments are in.
+func (c *Course) Zone() *time.Location {
+	return Location(c.TimeZone)
+}
+
+// Zone is the time zone of the queue's course.
+func (q *Queue) Zone() *time.Location {
+	return Location(q.TimeZone)
+}
+
+// contextLocation gets the time zone of the request's course, or of its
+// queue's course.
+func contextLocation(ctx context.Context) *time.Location {
+	if c, ok := ctx.Value(courseContextKey).(*Course); ok {
+		return c.Zone()
+	}
+	if q, ok := ctx.Value(queueContextKey).(*Queue); ok {
+		return q.Zone()
+	}
+	return time.Local
+}
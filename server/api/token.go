@@ -0,0 +1,385 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dchest/uniuri"
+	"github.com/go-chi/chi"
+	"github.com/lib/pq"
+	"github.com/segmentio/ksuid"
+)
+
+const apiTokenContextKey = "api_token"
+
+// API tokens are handed out as this prefix followed by apiTokenLength
+// random characters, which makes them easy to spot if they're leaked.
+const (
+	apiTokenPrefix = "ohq_"
+	apiTokenLength = 40
+)
+
+const (
+	defaultAPITokenLifetime = 90 * 24 * time.Hour
+	maxAPITokenLifetime     = 365 * 24 * time.Hour
+)
+
+// What an API token may be used for. Read covers GET and HEAD requests,
+// and write covers everything else.
+const (
+	APITokenScopeRead  = "read"
+	APITokenScopeWrite = "write"
+)
+
+// APIToken lets a bot or script act as the user who created it without a
+// session. Course is set for tokens that can only be used in one course.
+// Only a hash of the token itself is kept.
+type APIToken struct {
+	ID         ksuid.KSUID    `json:"id" db:"id"`
+	Email      string         `json:"email" db:"email"`
+	Name       string         `json:"name" db:"name"`
+	Course     *ksuid.KSUID   `json:"course" db:"course"`
+	Scopes     pq.StringArray `json:"scopes" db:"scopes"`
+	ExpiresAt  time.Time      `json:"expires_at" db:"expires_at"`
+	LastUsedAt *time.Time     `json:"last_used_at" db:"last_used_at"`
+
+	// The name of the user who created the token, as it was then, for
+	// the name context keys.
+	OwnerName      string `json:"-" db:"owner_name"`
+	OwnerFirstName string `json:"-" db:"owner_first_name"`
+}
+
+// hasScope reports whether t can be used for requests with method.
+func (t *APIToken) hasScope(method string) bool {
+	scope := APITokenScopeWrite
+	if method == http.MethodGet || method == http.MethodHead {
+		scope = APITokenScopeRead
+	}
+
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+type useAPIToken interface {
+	// UseAPIToken gets the token with hash, recording that it's been
+	// used if it hasn't been in the last LastSeenResolution, or
+	// sql.ErrNoRows if there isn't one.
+	UseAPIToken(ctx context.Context, hash string) (*APIToken, error)
+}
+
+// hasAPIToken reports whether r is made with an API token. Any other kind
+// of Authorization header (like the Basic auth of a proxy in front of a
+// staging site) isn't ours, and the request's session counts as usual.
+func hasAPIToken(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ")
+}
+
+// apiTokenLogin resolves the request's Authorization header into a token.
+func (s *Server) apiTokenLogin(ua useAPIToken, r *http.Request) (*APIToken, error) {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return nil, StatusError{
+			http.StatusUnauthorized,
+			"I only understand `Bearer` API tokens in the Authorization header.",
+		}
+	}
+
+	token, err := ua.UseAPIToken(r.Context(), hashAPIToken(strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, StatusError{
+			http.StatusUnauthorized,
+			"I don't recognize that API token. Maybe it was revoked?",
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	if !token.ExpiresAt.After(time.Now()) {
+		return nil, StatusError{
+			http.StatusUnauthorized,
+			"That API token has expired.",
+		}
+	}
+
+	if !token.hasScope(r.Method) {
+		return nil, StatusError{
+			http.StatusForbidden,
+			"That API token doesn't have the scope for this request.",
+		}
+	}
+
+	return token, nil
+}
+
+// apiTokenAllowedIn reports whether the request can be made in course: it
+// wasn't made with a course-scoped API token for some other course.
+func apiTokenAllowedIn(r *http.Request, course ksuid.KSUID) bool {
+	token, ok := r.Context().Value(apiTokenContextKey).(*APIToken)
+	return !ok || token.Course == nil || *token.Course == course
+}
+
+// RejectAPITokens only lets through requests made with a session, for the
+// endpoints that shouldn't be open to a leaked token (like making more).
+func (s *Server) RejectAPITokens(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Value(apiTokenContextKey).(*APIToken); ok {
+			s.logger.Warnw("API token used for session-only endpoint",
+				RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+				"email", r.Context().Value(emailContextKey),
+			)
+			s.errorMessage(
+				http.StatusForbidden,
+				"You'll need to log in to do that; API tokens won't work.",
+				w, r,
+			)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type getAPITokens interface {
+	GetAPITokens(ctx context.Context, email string) ([]*APIToken, error)
+}
+
+func (s *Server) GetAPITokens(gt getAPITokens) E {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		email := r.Context().Value(emailContextKey).(string)
+
+		tokens, err := gt.GetAPITokens(r.Context(), email)
+		if err != nil {
+			s.logger.Errorw("failed to get API tokens",
+				RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+				"email", email,
+				"err", err,
+			)
+			return err
+		}
+
+		return s.sendResponse(http.StatusOK, tokens, w, r)
+	}
+}
+
+type addAPIToken interface {
+	getCourse
+	addAuditLogEntry
+	AddAPIToken(ctx context.Context, token *APIToken, hash string) (*APIToken, error)
+}
+
+func (s *Server) AddAPIToken(at addAPIToken) E {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		email := r.Context().Value(emailContextKey).(string)
+		name, _ := r.Context().Value(nameContextKey).(string)
+		firstName, _ := r.Context().Value(firstNameContextKey).(string)
+		l := s.logger.With(
+			RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+			"email", email,
+		)
+
+		var body struct {
+			Name      string       `json:"name"`
+			Course    *ksuid.KSUID `json:"course"`
+			Scopes    []string     `json:"scopes"`
+			ExpiresAt *time.Time   `json:"expires_at"`
+		}
+		err := json.NewDecoder(r.Body).Decode(&body)
+		if err != nil {
+			l.Warnw("failed to decode token from body", "err", err)
+			return StatusError{
+				http.StatusBadRequest,
+				"We couldn't read the token from the request body.",
+			}
+		}
+
+		if strings.TrimSpace(body.Name) == "" {
+			l.Warnw("got token without name")
+			return StatusError{
+				http.StatusBadRequest,
+				"Give the token a name so you can tell it apart from the others.",
+			}
+		}
+
+		if len(body.Scopes) == 0 {
+			l.Warnw("got token without scopes")
+			return StatusError{
+				http.StatusBadRequest,
+				"The token needs at least one scope: `read` or `write`.",
+			}
+		}
+		for _, scope := range body.Scopes {
+			if scope != APITokenScopeRead && scope != APITokenScopeWrite {
+				l.Warnw("got unknown token scope", "scope", scope)
+				return StatusError{
+					http.StatusBadRequest,
+					`I haven't seen the scope "` + scope + `" before. Try read or write.`,
+				}
+			}
+		}
+
+		now := time.Now()
+		expiresAt := now.Add(defaultAPITokenLifetime)
+		if body.ExpiresAt != nil {
+			expiresAt = *body.ExpiresAt
+		}
+		if !expiresAt.After(now) || expiresAt.After(now.Add(maxAPITokenLifetime)) {
+			l.Warnw("got invalid token expiry", "expires_at", expiresAt)
+			return StatusError{
+				http.StatusBadRequest,
+				"Tokens need to expire sometime in the next year.",
+			}
+		}
+
+		if body.Course != nil {
+			_, err = at.GetCourse(r.Context(), *body.Course)
+			if errors.Is(err, sql.ErrNoRows) {
+				l.Warnw("attempted to create token for non-existent course", "course_id", body.Course)
+				return StatusError{
+					http.StatusNotFound,
+					"I've looked everywhere, but I can't find that course.",
+				}
+			} else if err != nil {
+				l.Errorw("failed to get course", "course_id", body.Course, "err", err)
+				return err
+			}
+		}
+
+		secret := apiTokenPrefix + uniuri.NewLen(apiTokenLength)
+		token, err := at.AddAPIToken(r.Context(), &APIToken{
+			Email:          email,
+			Name:           body.Name,
+			Course:         body.Course,
+			Scopes:         body.Scopes,
+			ExpiresAt:      expiresAt,
+			OwnerName:      name,
+			OwnerFirstName: firstName,
+		}, hashAPIToken(secret))
+		if err != nil {
+			l.Errorw("failed to create API token", "err", err)
+			return err
+		}
+
+		if token.Course != nil {
+			err = s.auditCourse(r.Context(), at, *token.Course, AuditAPITokenAdd, token.ID.String(), nil, token)
+			if err != nil {
+				l.Errorw("failed to audit token creation", "err", err)
+				return err
+			}
+		}
+
+		l.Infow("created API token", "token_id", token.ID, "course_id", token.Course, "scopes", token.Scopes)
+
+		// This is the only time the token itself is ever sent.
+		resp := struct {
+			*APIToken
+			Token string `json:"token"`
+		}{token, secret}
+		return s.sendResponse(http.StatusCreated, resp, w, r)
+	}
+}
+
+type removeAPIToken interface {
+	addAuditLogEntry
+	GetAPIToken(ctx context.Context, id ksuid.KSUID) (*APIToken, error)
+	RemoveAPIToken(ctx context.Context, id ksuid.KSUID) error
+}
+
+// RemoveAPIToken revokes the token in the URL. Users can revoke their own
+// tokens, and a course's instructors can revoke any of the tokens scoped
+// to it.
+func (s *Server) RemoveAPIToken(rt removeAPIToken) E {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		email := r.Context().Value(emailContextKey).(string)
+		l := s.logger.With(
+			RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+			"email", email,
+		)
+
+		notFound := StatusError{
+			http.StatusNotFound,
+			"I couldn't find that token. Maybe it was already revoked?",
+		}
+
+		id, err := ksuid.Parse(chi.URLParam(r, "token_id"))
+		if err != nil {
+			l.Warnw("failed to parse token ID", "token_id", chi.URLParam(r, "token_id"), "err", err)
+			return notFound
+		}
+		l = l.With("token_id", id)
+
+		token, err := rt.GetAPIToken(r.Context(), id)
+		if errors.Is(err, sql.ErrNoRows) {
+			l.Warnw("attempted to revoke non-existent token")
+			return notFound
+		} else if err != nil {
+			l.Errorw("failed to get API token", "err", err)
+			return err
+		}
+
+		if c, ok := r.Context().Value(courseContextKey).(*Course); ok {
+			if token.Course == nil || *token.Course != c.ID {
+				l.Warnw("attempted to revoke token from other course", "course_id", c.ID)
+				return notFound
+			}
+		} else if token.Email != email {
+			l.Warnw("attempted to revoke other user's token", "owner", token.Email)
+			return notFound
+		}
+
+		err = rt.RemoveAPIToken(r.Context(), id)
+		if err != nil {
+			l.Errorw("failed to revoke API token", "err", err)
+			return err
+		}
+
+		if token.Course != nil {
+			err = s.auditCourse(r.Context(), rt, *token.Course, AuditAPITokenRemove, token.ID.String(), token, nil)
+			if err != nil {
+				l.Errorw("failed to audit token revocation", "err", err)
+				return err
+			}
+		}
+
+		l.Infow("revoked API token", "owner", token.Email)
+		return s.sendResponse(http.StatusNoContent, nil, w, r)
+	}
+}
+
+type getCourseAPITokens interface {
+	GetCourseAPITokens(ctx context.Context, course ksuid.KSUID) ([]*APIToken, error)
+}
+
+// GetCourseAPITokens lists every token scoped to the course in the URL,
+// whoever made it.
+func (s *Server) GetCourseAPITokens(gt getCourseAPITokens) E {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		c := r.Context().Value(courseContextKey).(*Course)
+
+		tokens, err := gt.GetCourseAPITokens(r.Context(), c.ID)
+		if err != nil {
+			s.logger.Errorw("failed to get course API tokens",
+				RequestIDContextKey, r.Context().Value(RequestIDContextKey),
+				"course_id", c.ID,
+				"err", err,
+			)
+			return err
+		}
+
+		return s.sendResponse(http.StatusOK, tokens, w, r)
+	}
+}
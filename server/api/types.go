@@ -12,7 +12,11 @@ type Course struct {
 	ID        ksuid.KSUID `json:"id" db:"id"`
 	ShortName string      `json:"short_name" db:"short_name"`
 	FullName  string      `json:"full_name" db:"full_name"`
-	Queues    []*Queue    `json:"queues"`
+
+	// The IANA time zone (like America/Detroit) that the course's queues
+	// open and close in. Empty means the server's time zone.
+	TimeZone string   `json:"time_zone" db:"time_zone"`
+	Queues   []*Queue `json:"queues"`
 }
 
 type QueueType string
@@ -30,6 +34,9 @@ type Queue struct {
 	Location string      `json:"location" db:"location"`
 	Map      string      `json:"map" db:"map"`
 	Active   bool        `json:"active" db:"active"`
+
+	// The time zone of the queue's course; see Course.TimeZone.
+	TimeZone string `json:"time_zone" db:"time_zone"`
 }
 
 type QueueConfiguration struct {
@@ -43,6 +50,24 @@ type QueueConfiguration struct {
 	Virtual             bool        `json:"virtual" db:"virtual"`
 	Scheduled           bool        `json:"scheduled" db:"scheduled"`
 	ManualOpen          bool        `json:"manual_open" db:"manual_open"`
+	EndOfSession        string      `json:"end_of_session" db:"end_of_session"`
+}
+
+// What happens to the entries still in a scheduled queue when it closes:
+// they stay put, they're removed without having been helped, or they stay
+// and are moved ahead of anyone who signs up next session.
+const (
+	EndOfSessionKeep      = "keep"
+	EndOfSessionClear     = "clear"
+	EndOfSessionCarryOver = "carry_over"
+)
+
+func validEndOfSession(policy string) bool {
+	switch policy {
+	case EndOfSessionKeep, EndOfSessionClear, EndOfSessionCarryOver:
+		return true
+	}
+	return false
 }
 
 type Announcement struct {
@@ -67,24 +92,38 @@ type QueueEntry struct {
 	RemovedBy   sql.NullString `json:"-" db:"removed_by"`
 	RemovedAt   sql.NullTime   `json:"-" db:"removed_at"`
 	Helped      bool           `json:"-" db:"helped"`
+
+	// The staff member helping the student, if any. HelpingName is their
+	// first name, for telling the student who's on the way.
+	HelpingBy    *string    `json:"helping_by,omitempty" db:"helping_by"`
+	HelpingName  *string    `json:"helping_name,omitempty" db:"helping_name"`
+	HelpingSince *time.Time `json:"helping_since,omitempty" db:"helping_since"`
+
+	// Only filled in for the student's own entries; see queuePositions.
+	Position      int  `json:"position,omitempty" db:"-"`
+	EstimatedWait *int `json:"estimated_wait,omitempty" db:"-"`
 }
 
 func (q *QueueEntry) RemovedEntry() *RemovedQueueEntry {
 	return &RemovedQueueEntry{
-		ID:          q.ID,
-		Queue:       q.Queue,
-		Email:       q.Email,
-		Name:        q.Name,
-		Description: q.Description,
-		Location:    q.Location,
-		MapX:        q.MapX,
-		MapY:        q.MapY,
-		Priority:    q.Priority,
-		Pinned:      q.Pinned,
-		Active:      sql.NullBool{Bool: true, Valid: true},
-		RemovedBy:   q.RemovedBy.String,
-		RemovedAt:   q.RemovedAt.Time,
-		Helped:      q.Helped,
+		ID:           q.ID,
+		Queue:        q.Queue,
+		Email:        q.Email,
+		Name:         q.Name,
+		Description:  q.Description,
+		Location:     q.Location,
+		MapX:         q.MapX,
+		MapY:         q.MapY,
+		Priority:     q.Priority,
+		Pinned:       q.Pinned,
+		Active:       sql.NullBool{Bool: true, Valid: true},
+		RemovedBy:    q.RemovedBy.String,
+		RemovedAt:    q.RemovedAt.Time,
+		Helped:       q.Helped,
+		Helping:      q.Helping,
+		HelpingBy:    q.HelpingBy,
+		HelpingName:  q.HelpingName,
+		HelpingSince: q.HelpingSince,
 	}
 }
 
@@ -94,11 +133,20 @@ func (q *QueueEntry) MarshalJSON() ([]byte, error) {
 		IDTimestamp string `json:"id_timestamp"`
 		*QueueEntryWithTimestamp
 	}{
-		IDTimestamp:             q.ID.Time().Format(time.RFC3339),
+		IDTimestamp:             q.ID.Time().UTC().Format(time.RFC3339),
 		QueueEntryWithTimestamp: (*QueueEntryWithTimestamp)(q),
 	})
 }
 
+// NoHelperEmail returns a version of this queue entry for the student
+// whose entry it is, who gets to know who's on the way by name but not
+// by email.
+func (q *QueueEntry) NoHelperEmail() *QueueEntry {
+	newEntry := *q
+	newEntry.HelpingBy = nil
+	return &newEntry
+}
+
 // Anonymized returns a version of this queue entry suitable for
 // consumption by other users.
 func (q *QueueEntry) Anonymized() *QueueEntry {
@@ -127,16 +175,20 @@ type RemovedQueueEntry struct {
 	RemovedAt   time.Time    `json:"removed_at" db:"removed_at"`
 	Helped      bool         `json:"helped" db:"helped"`
 	Helping     bool         `json:"-" db:"helping"`
+
+	HelpingBy    *string    `json:"helping_by,omitempty" db:"helping_by"`
+	HelpingName  *string    `json:"-" db:"helping_name"`
+	HelpingSince *time.Time `json:"helping_since,omitempty" db:"helping_since"`
 }
 
 func (q *RemovedQueueEntry) MarshalJSON() ([]byte, error) {
 	type QueueEntryWithTimestamp RemovedQueueEntry
-	q.RemovedAt = q.RemovedAt.In(time.Local)
+	q.RemovedAt = q.RemovedAt.UTC()
 	return json.Marshal(struct {
 		IDTimestamp string `json:"id_timestamp"`
 		*QueueEntryWithTimestamp
 	}{
-		IDTimestamp:             q.ID.Time().Format(time.RFC3339),
+		IDTimestamp:             q.ID.Time().UTC().Format(time.RFC3339),
 		QueueEntryWithTimestamp: (*QueueEntryWithTimestamp)(q),
 	})
 }
@@ -151,6 +203,18 @@ func (q *RemovedQueueEntry) Anonymized() *RemovedQueueEntry {
 	}
 }
 
+// HelpThroughput summarizes the help given on a queue since some point
+// in time, for estimating wait times.
+type HelpThroughput struct {
+	// The number of entries helped, and the number of distinct staff
+	// members who helped them.
+	Helped  int `db:"helped"`
+	Helpers int `db:"helpers"`
+
+	// When the first of them was helped.
+	First sql.NullTime `db:"first"`
+}
+
 type Message struct {
 	ID       ksuid.KSUID `json:"id" db:"id"`
 	Queue    ksuid.KSUID `json:"queue" db:"queue"`
@@ -184,12 +248,12 @@ type AppointmentSlot struct {
 
 func (a *AppointmentSlot) MarshalJSON() ([]byte, error) {
 	type AppointmentSlotWithTimestamp AppointmentSlot
-	a.ScheduledTime = a.ScheduledTime.In(time.Local)
+	a.ScheduledTime = a.ScheduledTime.UTC()
 	return json.Marshal(struct {
 		IDTimestamp string `json:"id_timestamp"`
 		*AppointmentSlotWithTimestamp
 	}{
-		IDTimestamp:                  a.ID.Time().Format(time.RFC3339),
+		IDTimestamp:                  a.ID.Time().UTC().Format(time.RFC3339),
 		AppointmentSlotWithTimestamp: (*AppointmentSlotWithTimestamp)(a),
 	})
 }
@@ -5,6 +5,10 @@ import "github.com/segmentio/ksuid"
 type WSMessage struct {
 	Event string      `json:"e"`
 	Data  interface{} `json:"d"`
+
+	// Every event sent to a queue gets the next number in that queue's
+	// sequence, which clients pass back as ?since= when they reconnect.
+	Seq uint64 `json:"s,omitempty"`
 }
 
 func WS(event string, data interface{}) *WSMessage {
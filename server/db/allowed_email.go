@@ -0,0 +1,77 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/segmentio/ksuid"
+)
+
+func (s *Server) CourseAllowsEmail(ctx context.Context, course ksuid.KSUID, email string) (bool, error) {
+	tx := getTransaction(ctx)
+	var n int
+	err := tx.GetContext(ctx, &n,
+		"SELECT COUNT(*) FROM course_allowed_emails WHERE course=$1 AND email=$2",
+		course, email,
+	)
+	return n > 0, err
+}
+
+func (s *Server) EmailAllowedInAnyCourse(ctx context.Context, email string) (bool, error) {
+	tx := getTransaction(ctx)
+	var n int
+	err := tx.GetContext(ctx, &n,
+		"SELECT COUNT(*) FROM course_allowed_emails WHERE email=$1",
+		email,
+	)
+	return n > 0, err
+}
+
+func (s *Server) GetAllowedEmails(ctx context.Context, course ksuid.KSUID) ([]string, error) {
+	tx := getTransaction(ctx)
+	emails := make([]string, 0)
+	err := tx.SelectContext(ctx, &emails,
+		"SELECT email FROM course_allowed_emails WHERE course=$1 ORDER BY email",
+		course,
+	)
+	return emails, err
+}
+
+func (s *Server) AddAllowedEmails(ctx context.Context, course ksuid.KSUID, emails []string, overwrite bool) error {
+	tx := getTransaction(ctx)
+
+	if overwrite {
+		_, err := tx.ExecContext(ctx, "DELETE FROM course_allowed_emails WHERE course=$1", course)
+		if err != nil {
+			return fmt.Errorf("failed to delete existing allowed emails: %w", err)
+		}
+	}
+
+	for _, email := range emails {
+		_, err := tx.ExecContext(ctx,
+			"INSERT INTO course_allowed_emails (course, email) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+			course, email,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert %s into course %s allowed emails: %w", email, course, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) RemoveAllowedEmails(ctx context.Context, course ksuid.KSUID, emails []string) error {
+	tx := getTransaction(ctx)
+
+	for _, email := range emails {
+		_, err := tx.ExecContext(ctx,
+			"DELETE FROM course_allowed_emails WHERE course=$1 AND email=$2",
+			course, email,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to delete %s from course %s allowed emails: %w", email, course, err)
+		}
+	}
+
+	return nil
+}
@@ -112,7 +112,12 @@ func (s *Server) ClaimTimeslot(ctx context.Context, queue ksuid.KSUID, day, time
 		return nil, fmt.Errorf("attempted to claim slot %d out of %d slots", timeslot, len(schedule.Schedule))
 	}
 
-	from, to := api.WeekdayBounds(day)
+	loc, err := s.queueZone(ctx, queue)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get queue time zone: %w", err)
+	}
+
+	from, to := api.WeekdayBounds(day, loc)
 	slots, err := s.GetAppointmentsByTimeslot(ctx, queue, from, to, timeslot)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get appointment slots: %w", err)
@@ -141,7 +146,7 @@ func (s *Server) ClaimTimeslot(ctx context.Context, queue ksuid.KSUID, day, time
 	// There's room for another appointment at the current timeslot.
 	// Let's claim it.
 	id := ksuid.New()
-	appointmentTime := api.TimeslotToTime(day, timeslot, schedule.Duration)
+	appointmentTime := api.TimeslotToTime(day, timeslot, schedule.Duration, loc)
 	var a api.AppointmentSlot
 	err = tx.GetContext(ctx, &a,
 		"INSERT INTO appointment_slots (id, queue, staff_email, scheduled_time, timeslot, duration) VALUES ($1, $2, $3, $4, $5, $6) RETURNING *",
@@ -177,7 +182,12 @@ func (s *Server) UnclaimAppointment(ctx context.Context, appointment ksuid.KSUID
 
 func (s *Server) SignupForAppointment(ctx context.Context, queue ksuid.KSUID, appointment *api.AppointmentSlot) (*api.AppointmentSlot, error) {
 	tx := getTransaction(ctx)
-	start, end := api.WeekdayBounds(int(appointment.ScheduledTime.Local().Weekday()))
+	loc, err := s.queueZone(ctx, queue)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get queue time zone: %w", err)
+	}
+
+	start, end := api.WeekdayBounds(int(appointment.ScheduledTime.In(loc).Weekday()), loc)
 	var newAppointment api.AppointmentSlot
 	appointments, err := s.GetAppointmentsByTimeslot(ctx, queue, start, end, appointment.Timeslot)
 	if err != nil {
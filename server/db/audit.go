@@ -0,0 +1,70 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/CarsonHoffman/office-hours-queue/server/api"
+)
+
+// nullJSON turns an empty JSON value into a NULL, rather than an invalid
+// empty document.
+func nullJSON(v json.RawMessage) interface{} {
+	if len(v) == 0 {
+		return nil
+	}
+	return string(v)
+}
+
+func (s *Server) AddAuditLogEntry(ctx context.Context, entry *api.AuditLogEntry) error {
+	tx := getTransaction(ctx)
+	_, err := tx.ExecContext(ctx,
+		"INSERT INTO audit_log (id, course, queue, actor, action, target, before, after) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
+		entry.ID, entry.Course, entry.Queue, entry.Actor, entry.Action, entry.Target, nullJSON(entry.Before), nullJSON(entry.After),
+	)
+	return err
+}
+
+func (s *Server) GetAuditLog(ctx context.Context, filter *api.AuditLogFilter) ([]*api.AuditLogEntry, error) {
+	tx := getTransaction(ctx)
+
+	var conditions []string
+	var args []interface{}
+	where := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	// Site-wide entries don't have a course.
+	if filter.Course.IsNil() {
+		conditions = append(conditions, "course IS NULL")
+	} else {
+		where("course=$%d", filter.Course)
+	}
+
+	if filter.Queue != nil {
+		where("queue=$%d", *filter.Queue)
+	}
+	if filter.Actor != "" {
+		where("actor=$%d", filter.Actor)
+	}
+	if filter.Action != "" {
+		where("action=$%d", filter.Action)
+	}
+	if filter.Target != "" {
+		where("target=$%d", filter.Target)
+	}
+	if !filter.Before.IsNil() {
+		where("id<$%d", filter.Before)
+	}
+	args = append(args, filter.Limit)
+
+	entries := make([]*api.AuditLogEntry, 0)
+	err := tx.SelectContext(ctx, &entries,
+		fmt.Sprintf("SELECT * FROM audit_log WHERE %s ORDER BY id DESC LIMIT $%d", strings.Join(conditions, " AND "), len(args)),
+		args...,
+	)
+	return entries, err
+}
@@ -0,0 +1,392 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/CarsonHoffman/office-hours-queue/server/api"
+	"github.com/cskr/pubsub"
+	"github.com/lib/pq"
+	"github.com/segmentio/ksuid"
+	"go.uber.org/zap"
+)
+
+// The channel every instance LISTENs on for events.
+const brokerChannel = "queue_events"
+
+// NOTIFY payloads max out at 8000 bytes; anything bigger than this goes
+// through the broker_payloads table instead.
+const maxNotifyPayload = 7000
+
+// The number of events kept for each topic for replaying to clients
+// that reconnect.
+const replaySize = 256
+
+const (
+	heartbeatInterval = 5 * time.Second
+
+	// How long an instance can go without a heartbeat before the others
+	// consider it gone and clean up after it.
+	heartbeatTimeout = 30 * time.Second
+)
+
+// Broker is an api.Broker that fans events out to every instance of the
+// server through Postgres LISTEN/NOTIFY, and keeps WebSocket presence
+// in the database so it's aggregated across instances.
+//
+// Every event, including the ones this instance publishes, comes back
+// through the listener before being delivered to local subscribers, so
+// all instances see events in the same order.
+type Broker struct {
+	s        *Server
+	logger   *zap.SugaredLogger
+	instance string
+	listener *pq.Listener
+	ps       *pubsub.PubSub
+	replay   *api.ReplayBuffer
+
+	// Local WebSocket counts, written through to websocket_presence.
+	// They're kept here as well so the rows can be restored if this
+	// instance is ever mistaken for dead.
+	connections     map[ksuid.KSUID]map[string]int
+	connectionsLock sync.Mutex
+
+	// The topics each local subscription was made with, so subscribers
+	// can be told to refresh if the listener misses anything.
+	subscriptions     map[chan interface{}][]string
+	subscriptionsLock sync.Mutex
+}
+
+type brokerEvent struct {
+	Queue   ksuid.KSUID    `json:"q"`
+	Topics  []string       `json:"t"`
+	Message *api.WSMessage `json:"m,omitempty"`
+
+	// Filled in by the database as the notification is sent.
+	Seq uint64 `json:"s,omitempty"`
+
+	// Set instead of the above when the event was too large to send
+	// directly; the ID of its row in broker_payloads.
+	Ref int64 `json:"r,omitempty"`
+}
+
+func NewBroker(s *Server, logger *zap.SugaredLogger) (*Broker, error) {
+	b := &Broker{
+		s:             s,
+		logger:        logger,
+		instance:      ksuid.New().String(),
+		ps:            pubsub.New(5),
+		connections:   make(map[ksuid.KSUID]map[string]int),
+		subscriptions: make(map[chan interface{}][]string),
+	}
+	b.replay = api.NewReplayBuffer(replaySize, b.seq)
+
+	_, err := s.DB.Exec("INSERT INTO broker_instances (id) VALUES ($1)", b.instance)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register broker instance: %w", err)
+	}
+
+	b.listener = pq.NewListener(s.connect, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			logger.Warnw("broker listener connection event", "event", event, "err", err)
+		}
+	})
+	err = b.listener.Listen(brokerChannel)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for broker events: %w", err)
+	}
+
+	go b.listen()
+	go b.heartbeat()
+
+	logger.Infow("started postgres broker", "instance", b.instance)
+	return b, nil
+}
+
+func (b *Broker) listen() {
+	for n := range b.listener.NotificationChannel() {
+		// The listener sends nil after reconnecting; anything published
+		// in the meantime is gone, so have everyone start from scratch.
+		if n == nil {
+			b.logger.Warnw("broker listener reconnected; asking subscribers to refresh")
+			b.replay.Reset()
+			b.refreshSubscribers()
+			continue
+		}
+
+		var e brokerEvent
+		err := json.Unmarshal([]byte(n.Extra), &e)
+		if err != nil {
+			b.logger.Errorw("failed to decode broker event", "payload", n.Extra, "err", err)
+			continue
+		}
+
+		if e.Ref != 0 {
+			var payload string
+			err = b.s.DB.Get(&payload, "SELECT payload FROM broker_payloads WHERE id=$1", e.Ref)
+			if err == nil {
+				err = json.Unmarshal([]byte(payload), &e)
+			}
+			if err != nil {
+				b.logger.Errorw("failed to fetch broker event payload", "ref", e.Ref, "err", err)
+				continue
+			}
+		}
+
+		if e.Message == nil {
+			b.logger.Errorw("got broker event without a message", "payload", n.Extra)
+			continue
+		}
+
+		e.Message.Seq = e.Seq
+		b.replay.Add(e.Queue, e.Message, e.Topics...)
+		b.ps.Pub(e.Message, e.Topics...)
+	}
+}
+
+// seq returns the last sequence number handed out for queue.
+func (b *Broker) seq(queue ksuid.KSUID) (uint64, error) {
+	var seq uint64
+	err := b.s.DB.Get(&seq, "SELECT seq FROM websocket_sequences WHERE queue=$1", queue)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return seq, err
+}
+
+// refreshSubscribers sends REFRESH once to each local subscriber. The
+// first topic of a subscription is enough to reach it; using only those
+// keeps subscribers with overlapping topics from getting it repeatedly.
+func (b *Broker) refreshSubscribers() {
+	b.subscriptionsLock.Lock()
+	topics := make(map[string]bool)
+	for _, t := range b.subscriptions {
+		if len(t) > 0 {
+			topics[t[0]] = true
+		}
+	}
+	b.subscriptionsLock.Unlock()
+
+	for t := range topics {
+		b.ps.Pub(api.WS("REFRESH", nil), t)
+	}
+}
+
+func (b *Broker) heartbeat() {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		err := b.beat()
+		if err != nil {
+			b.logger.Errorw("broker heartbeat failed", "instance", b.instance, "err", err)
+		}
+	}
+}
+
+func (b *Broker) beat() error {
+	res, err := b.s.DB.Exec("UPDATE broker_instances SET heartbeat=NOW() WHERE id=$1", b.instance)
+	if err != nil {
+		return fmt.Errorf("failed to update heartbeat: %w", err)
+	}
+
+	// If another instance decided we were dead (say, after a long GC
+	// pause or a network partition), our presence was cleaned up along
+	// with us; put it back.
+	if n, _ := res.RowsAffected(); n == 0 {
+		b.logger.Warnw("broker instance was cleaned up; re-registering", "instance", b.instance)
+		err = b.reregister()
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = b.s.DB.Exec(
+		"DELETE FROM broker_instances WHERE heartbeat < NOW() - $1 * INTERVAL '1 second'",
+		heartbeatTimeout.Seconds(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to clean up dead instances: %w", err)
+	}
+
+	_, err = b.s.DB.Exec("DELETE FROM broker_payloads WHERE created_at < NOW() - INTERVAL '5 minutes'")
+	if err != nil {
+		return fmt.Errorf("failed to clean up old payloads: %w", err)
+	}
+
+	return nil
+}
+
+func (b *Broker) reregister() error {
+	b.connectionsLock.Lock()
+	defer b.connectionsLock.Unlock()
+
+	tx, err := b.s.DB.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("INSERT INTO broker_instances (id) VALUES ($1)", b.instance)
+	if err != nil {
+		return fmt.Errorf("failed to register broker instance: %w", err)
+	}
+
+	for queue, emails := range b.connections {
+		for email, n := range emails {
+			_, err = tx.Exec(
+				"INSERT INTO websocket_presence (instance, queue, email, connections) VALUES ($1, $2, $3, $4)",
+				b.instance, queue, email, n,
+			)
+			if err != nil {
+				return fmt.Errorf("failed to restore presence: %w", err)
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Publish sends the event to every instance with pg_notify. The API
+// only publishes once the request's transaction has committed, so this
+// doesn't go through it.
+//
+// The sequence number is assigned in the same statement that sends the
+// notification. The counter's row stays locked until that statement
+// commits, which is also when the notification is delivered, so
+// notifications arrive in sequence order.
+func (b *Broker) Publish(ctx context.Context, queue ksuid.KSUID, msg *api.WSMessage, topics ...string) {
+	payload, err := json.Marshal(brokerEvent{Queue: queue, Topics: topics, Message: msg})
+	if err != nil {
+		b.logger.Errorw("failed to encode broker event", "event", msg.Event, "err", err)
+		return
+	}
+
+	if len(payload) > maxNotifyPayload {
+		var ref int64
+		err = b.s.DB.GetContext(ctx, &ref,
+			"INSERT INTO broker_payloads (payload) VALUES ($1) RETURNING id",
+			string(payload),
+		)
+		if err != nil {
+			b.logger.Errorw("failed to store broker event payload", "event", msg.Event, "err", err)
+			return
+		}
+		payload, _ = json.Marshal(brokerEvent{Queue: queue, Ref: ref})
+	}
+
+	_, err = b.s.DB.ExecContext(ctx,
+		`WITH s AS (
+			INSERT INTO websocket_sequences (queue, seq) VALUES ($1, 1)
+			ON CONFLICT (queue) DO UPDATE SET seq=websocket_sequences.seq+1
+			RETURNING seq
+		)
+		SELECT pg_notify($2, jsonb_set($3::jsonb, '{s}', to_jsonb(s.seq))::text) FROM s`,
+		queue, brokerChannel, string(payload),
+	)
+	if err != nil {
+		b.logger.Errorw("failed to publish broker event", "event", msg.Event, "err", err)
+	}
+}
+
+func (b *Broker) Replay(ctx context.Context, queue ksuid.KSUID, since uint64, topics ...string) ([]*api.WSMessage, bool, error) {
+	return b.replay.Since(queue, since, topics...)
+}
+
+func (b *Broker) Subscribe(topics ...string) chan interface{} {
+	ch := b.ps.Sub(topics...)
+	b.subscriptionsLock.Lock()
+	b.subscriptions[ch] = topics
+	b.subscriptionsLock.Unlock()
+	return ch
+}
+
+func (b *Broker) Unsubscribe(ch chan interface{}) {
+	b.subscriptionsLock.Lock()
+	delete(b.subscriptions, ch)
+	b.subscriptionsLock.Unlock()
+	b.ps.Unsub(ch)
+}
+
+// updatePresence applies delta to this instance's connections from email
+// to queue, and returns the totals across all live instances for the
+// queue and for the user.
+func (b *Broker) updatePresence(ctx context.Context, queue ksuid.KSUID, email string, delta int) (queueTotal, userTotal int, err error) {
+	b.connectionsLock.Lock()
+	defer b.connectionsLock.Unlock()
+
+	e := b.connections[queue]
+	if e == nil {
+		e = make(map[string]int)
+		b.connections[queue] = e
+	}
+	e[email] += delta
+	n := e[email]
+	if n <= 0 {
+		delete(e, email)
+		if len(e) == 0 {
+			delete(b.connections, queue)
+		}
+	}
+
+	tx, err := b.s.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if n > 0 {
+		_, err = tx.ExecContext(ctx,
+			"INSERT INTO websocket_presence (instance, queue, email, connections) VALUES ($1, $2, $3, $4) ON CONFLICT (instance, queue, email) DO UPDATE SET connections=EXCLUDED.connections",
+			b.instance, queue, email, n,
+		)
+	} else {
+		_, err = tx.ExecContext(ctx,
+			"DELETE FROM websocket_presence WHERE instance=$1 AND queue=$2 AND email=$3",
+			b.instance, queue, email,
+		)
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to update presence: %w", err)
+	}
+
+	err = tx.GetContext(ctx, &queueTotal,
+		"SELECT COALESCE(SUM(connections), 0) FROM websocket_presence WHERE queue=$1",
+		queue,
+	)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to count queue connections: %w", err)
+	}
+
+	err = tx.GetContext(ctx, &userTotal,
+		"SELECT COALESCE(SUM(connections), 0) FROM websocket_presence WHERE queue=$1 AND email=$2",
+		queue, email,
+	)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to count user connections: %w", err)
+	}
+
+	return queueTotal, userTotal, tx.Commit()
+}
+
+func (b *Broker) Connect(ctx context.Context, queue ksuid.KSUID, email string) (int, bool, error) {
+	ws, user, err := b.updatePresence(ctx, queue, email, 1)
+	return ws, email != "" && user == 1, err
+}
+
+func (b *Broker) Disconnect(ctx context.Context, queue ksuid.KSUID, email string) (int, bool, error) {
+	ws, user, err := b.updatePresence(ctx, queue, email, -1)
+	return ws, email != "" && user == 0, err
+}
+
+func (b *Broker) Online(ctx context.Context, queue ksuid.KSUID) ([]string, error) {
+	online := make([]string, 0)
+	err := b.s.DB.SelectContext(ctx, &online,
+		"SELECT DISTINCT email FROM websocket_presence WHERE queue=$1 AND email!='' ORDER BY email",
+		queue,
+	)
+	return online, err
+}
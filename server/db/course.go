@@ -2,6 +2,8 @@ package db
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 
 	"github.com/CarsonHoffman/office-hours-queue/server/api"
@@ -13,14 +15,14 @@ func (s *Server) GetCourses(ctx context.Context) ([]*api.Course, error) {
 	tx := getTransaction(ctx)
 	courses := make([]*api.Course, 0)
 	err := tx.SelectContext(ctx, &courses,
-		"SELECT id, short_name, full_name FROM courses ORDER BY id",
+		"SELECT id, short_name, full_name, time_zone FROM courses ORDER BY id",
 	)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to get courses: %w", err)
 	}
 
-	qStmt, err := tx.Preparex("SELECT id, course, type, name, location, map, active FROM queues WHERE active AND course=$1 ORDER BY id")
+	qStmt, err := tx.Preparex("SELECT q.id, q.course, q.type, q.name, q.location, q.map, q.active, c.time_zone FROM queues q JOIN courses c ON c.id=q.course WHERE q.active AND q.course=$1 ORDER BY q.id")
 	if err != nil {
 		return nil, fmt.Errorf("failed to set up queues statement: %w", err)
 	}
@@ -41,13 +43,13 @@ func (s *Server) GetCourse(ctx context.Context, id ksuid.KSUID) (*api.Course, er
 	tx := getTransaction(ctx)
 	var course api.Course
 	err := tx.GetContext(ctx, &course,
-		"SELECT id, short_name, full_name FROM courses WHERE id=$1",
+		"SELECT id, short_name, full_name, time_zone FROM courses WHERE id=$1",
 		id,
 	)
 	return &course, err
 }
 
-func (s *Server) GetAdminCourses(ctx context.Context, email string) ([]string, error) {
+func (s *Server) GetCourseRoles(ctx context.Context, email string) (map[string]api.CourseRole, error) {
 	tx := getTransaction(ctx)
 	var n int
 	err := tx.GetContext(ctx, &n,
@@ -58,58 +60,84 @@ func (s *Server) GetAdminCourses(ctx context.Context, email string) ([]string, e
 		return nil, fmt.Errorf("failed to check site admin status: %w", err)
 	}
 
-	courses := make([]string, 0)
-	// Check if user is site admin; if so, they are admin for all courses
+	var rows []struct {
+		Course string         `db:"course"`
+		Role   api.CourseRole `db:"role"`
+	}
+	// Check if user is site admin; if so, they are instructor for all courses
 	if n > 0 {
-		err = tx.SelectContext(ctx, &courses,
-			"SELECT id FROM courses",
+		err = tx.SelectContext(ctx, &rows,
+			"SELECT id AS course, $1::text AS role FROM courses",
+			api.RoleInstructor,
+		)
+	} else {
+		err = tx.SelectContext(ctx, &rows,
+			"SELECT course, role FROM course_admins WHERE email=$1",
+			email,
 		)
-		return courses, err
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	err = tx.SelectContext(ctx, &courses,
-		"SELECT course FROM course_admins WHERE email=$1",
-		email,
-	)
-	return courses, err
+	roles := make(map[string]api.CourseRole, len(rows))
+	for _, row := range rows {
+		roles[row.Course] = row.Role
+	}
+	return roles, nil
 }
 
 func (s *Server) GetQueues(ctx context.Context, course ksuid.KSUID) ([]*api.Queue, error) {
 	tx := getTransaction(ctx)
 	queues := make([]*api.Queue, 0)
 	err := tx.SelectContext(ctx, &queues,
-		"SELECT id, course, type, name, location, map, active FROM queues WHERE course=$1 AND active ORDER BY id",
+		"SELECT q.id, q.course, q.type, q.name, q.location, q.map, q.active, c.time_zone FROM queues q JOIN courses c ON c.id=q.course WHERE q.course=$1 AND q.active ORDER BY q.id",
 		course,
 	)
 	return queues, err
 }
 
-func (s *Server) CourseAdmin(ctx context.Context, course ksuid.KSUID, email string) (bool, error) {
+func (s *Server) CourseRole(ctx context.Context, course ksuid.KSUID, email string) (api.CourseRole, error) {
 	tx := getTransaction(ctx)
 	var n int
 	err := tx.GetContext(ctx, &n,
-		"SELECT COUNT(*) FROM (SELECT email FROM site_admins UNION SELECT email FROM course_admins WHERE course=$1) AS admins WHERE email=$2",
+		"SELECT COUNT(*) FROM site_admins WHERE email=$1",
+		email,
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to check site admin status: %w", err)
+	}
+	if n > 0 {
+		return api.RoleInstructor, nil
+	}
+
+	var role api.CourseRole
+	err = tx.GetContext(ctx, &role,
+		"SELECT role FROM course_admins WHERE course=$1 AND email=$2",
 		course, email,
 	)
-	return n > 0, err
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return role, err
 }
 
-func (s *Server) AddCourse(ctx context.Context, shortName, fullName string) (*api.Course, error) {
+func (s *Server) AddCourse(ctx context.Context, shortName, fullName, timeZone string) (*api.Course, error) {
 	tx := getTransaction(ctx)
 	id := ksuid.New()
 	var course api.Course
 	err := tx.GetContext(ctx, &course,
-		"INSERT INTO courses (id, short_name, full_name) VALUES ($1, $2, $3) RETURNING id, short_name, full_name",
-		id, shortName, fullName,
+		"INSERT INTO courses (id, short_name, full_name, time_zone) VALUES ($1, $2, $3, $4) RETURNING id, short_name, full_name, time_zone",
+		id, shortName, fullName, timeZone,
 	)
 	return &course, err
 }
 
-func (s *Server) UpdateCourse(ctx context.Context, course ksuid.KSUID, shortName, fullName string) error {
+func (s *Server) UpdateCourse(ctx context.Context, course ksuid.KSUID, shortName, fullName, timeZone string) error {
 	tx := getTransaction(ctx)
 	_, err := tx.ExecContext(ctx,
-		"UPDATE courses SET short_name=$1, full_name=$2 WHERE id=$3",
-		shortName, fullName, course,
+		"UPDATE courses SET short_name=$1, full_name=$2, time_zone=$3 WHERE id=$4",
+		shortName, fullName, timeZone, course,
 	)
 	return err
 }
@@ -128,20 +156,22 @@ func (s *Server) AddQueue(ctx context.Context, course ksuid.KSUID, queue *api.Qu
 	id := ksuid.New()
 	var newQueue api.Queue
 	err := tx.GetContext(ctx, &newQueue,
-		"INSERT INTO queues (id, course, type, name, location, map, active) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, course, type, name, location, map, active",
+		`WITH q AS (
+			INSERT INTO queues (id, course, type, name, location, map, active) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, course, type, name, location, map, active
+		) SELECT q.*, c.time_zone FROM q JOIN courses c ON c.id=q.course`,
 		id, course, queue.Type, queue.Name, queue.Location, queue.Map, true,
 	)
 	return &newQueue, err
 }
 
-func (s *Server) GetCourseAdmins(ctx context.Context, course ksuid.KSUID) ([]string, error) {
+func (s *Server) GetCourseAdmins(ctx context.Context, course ksuid.KSUID) ([]*api.CourseAdmin, error) {
 	tx := getTransaction(ctx)
-	admins := make([]string, 0)
-	err := tx.SelectContext(ctx, &admins, "SELECT email FROM course_admins WHERE course=$1", course)
+	admins := make([]*api.CourseAdmin, 0)
+	err := tx.SelectContext(ctx, &admins, "SELECT email, role FROM course_admins WHERE course=$1 ORDER BY email", course)
 	return admins, err
 }
 
-func (s *Server) AddCourseAdmins(ctx context.Context, course ksuid.KSUID, admins []string, overwrite bool) error {
+func (s *Server) AddCourseAdmins(ctx context.Context, course ksuid.KSUID, admins []*api.CourseAdmin, overwrite bool) error {
 	tx := getTransaction(ctx)
 
 	if overwrite {
@@ -152,17 +182,17 @@ func (s *Server) AddCourseAdmins(ctx context.Context, course ksuid.KSUID, admins
 		}
 	}
 
-	insert, err := tx.Prepare(pq.CopyIn("course_admins", "course", "email"))
+	insert, err := tx.Prepare(pq.CopyIn("course_admins", "course", "email", "role"))
 	if err != nil {
 		return fmt.Errorf("failed to prepare insert statement: %w", err)
 	}
 	defer insert.Close()
 
-	for _, email := range admins {
-		_, err = insert.Exec(course, email)
+	for _, admin := range admins {
+		_, err = insert.Exec(course, admin.Email, admin.Role)
 		if err != nil {
 			tx.Rollback()
-			return fmt.Errorf("failed to insert %s into course %s admins: %w", email, course, err)
+			return fmt.Errorf("failed to insert %s into course %s admins: %w", admin.Email, course, err)
 		}
 	}
 
@@ -0,0 +1,259 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Migrations live in migrations/ as NNNN_description.sql, and are applied
+// in order of NNNN. Once a migration has been applied anywhere that
+// matters, don't edit it; add a new one instead.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// An arbitrary key for the advisory lock held while migrating, so that
+// multiple instances starting at once don't trip over each other.
+const migrationLockKey = 8675309
+
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+func loadMigrations() ([]Migration, error) {
+	files, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list migrations: %w", err)
+	}
+
+	var migrations []Migration
+	seen := make(map[int]string)
+	for _, f := range files {
+		parts := strings.SplitN(strings.TrimSuffix(f.Name(), ".sql"), "_", 2)
+		version, err := strconv.Atoi(parts[0])
+		if err != nil || len(parts) != 2 {
+			return nil, fmt.Errorf("migration %s isn't named NNNN_description.sql", f.Name())
+		}
+		if other, ok := seen[version]; ok {
+			return nil, fmt.Errorf("migrations %s and %s have the same version", other, f.Name())
+		}
+		seen[version] = f.Name()
+
+		contents, err := migrationFiles.ReadFile(path.Join("migrations", f.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", f.Name(), err)
+		}
+
+		migrations = append(migrations, Migration{
+			Version: version,
+			Name:    parts[1],
+			SQL:     string(contents),
+		})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// prepareMigrations makes sure the schema_migrations table exists. If it
+// doesn't, but the schema does, the database was created from the old
+// deploy/init.sql dump, so we record the baseline migration as applied
+// rather than trying to create everything again.
+func prepareMigrations(ctx context.Context, tx *sqlx.Tx) error {
+	var exists bool
+	err := tx.GetContext(ctx, &exists, "SELECT to_regclass('public.schema_migrations') IS NOT NULL")
+	if err != nil {
+		return fmt.Errorf("failed to check for migrations table: %w", err)
+	}
+
+	if exists {
+		return nil
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`CREATE TABLE public.schema_migrations (
+			version integer PRIMARY KEY,
+			name text NOT NULL,
+			applied_at timestamp with time zone DEFAULT NOW() NOT NULL
+		)`,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create migrations table: %w", err)
+	}
+
+	var existingSchema bool
+	err = tx.GetContext(ctx, &existingSchema, "SELECT to_regclass('public.queues') IS NOT NULL")
+	if err != nil {
+		return fmt.Errorf("failed to check for existing schema: %w", err)
+	}
+
+	if existingSchema {
+		_, err = tx.ExecContext(ctx,
+			"INSERT INTO schema_migrations (version, name) VALUES (1, 'initial')",
+		)
+		if err != nil {
+			return fmt.Errorf("failed to record baseline migration: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Migrations returns every known migration, with the time it was
+// applied if it has been. Databases created from the old dump show the
+// baseline as pending until the first Migrate, which records it without
+// running it.
+func (s *Server) Migrations(ctx context.Context) ([]MigrationStatus, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var exists bool
+	err = s.DB.GetContext(ctx, &exists, "SELECT to_regclass('public.schema_migrations') IS NOT NULL")
+	if err != nil {
+		return nil, fmt.Errorf("failed to check for migrations table: %w", err)
+	}
+
+	applied := make(map[int]time.Time)
+	if exists {
+		var rows []struct {
+			Version   int       `db:"version"`
+			AppliedAt time.Time `db:"applied_at"`
+		}
+		err = s.DB.SelectContext(ctx, &rows, "SELECT version, applied_at FROM schema_migrations")
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch applied migrations: %w", err)
+		}
+		for _, row := range rows {
+			applied[row.Version] = row.AppliedAt
+		}
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		status := MigrationStatus{Version: m.Version, Name: m.Name}
+		if t, ok := applied[m.Version]; ok {
+			status.AppliedAt = &t
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// PendingMigrations returns the migrations that haven't been applied yet.
+func (s *Server) PendingMigrations(ctx context.Context) ([]MigrationStatus, error) {
+	statuses, err := s.Migrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []MigrationStatus
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			pending = append(pending, status)
+		}
+	}
+	return pending, nil
+}
+
+// Migrate applies every pending migration in order, each in its own
+// transaction, and returns the ones it applied.
+func (s *Server) Migrate(ctx context.Context) ([]Migration, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	// Advisory locks belong to a session, so hold on to one connection.
+	conn, err := s.DB.Connx(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockKey)
+
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	err = prepareMigrations(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up migrations table: %w", err)
+	}
+
+	var applied []Migration
+	for _, m := range migrations {
+		err = applyMigration(ctx, conn, m)
+		if err == errAlreadyApplied {
+			continue
+		} else if err != nil {
+			return applied, err
+		}
+		applied = append(applied, m)
+	}
+
+	return applied, nil
+}
+
+var errAlreadyApplied = fmt.Errorf("migration already applied")
+
+func applyMigration(ctx context.Context, conn *sqlx.Conn, m Migration) error {
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction for migration %04d: %w", m.Version, err)
+	}
+	defer tx.Rollback()
+
+	var version int
+	err = tx.GetContext(ctx, &version, "SELECT version FROM schema_migrations WHERE version=$1", m.Version)
+	if err == nil {
+		return errAlreadyApplied
+	} else if err != sql.ErrNoRows {
+		return fmt.Errorf("failed to check migration %04d: %w", m.Version, err)
+	}
+
+	_, err = tx.ExecContext(ctx, m.SQL)
+	if err != nil {
+		return fmt.Errorf("failed to apply migration %04d_%s: %w", m.Version, m.Name, err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO schema_migrations (version, name) VALUES ($1, $2)",
+		m.Version, m.Name,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record migration %04d: %w", m.Version, err)
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,15 @@
+-- These columns were added by hand in production over time (helping never
+-- made it into the dump at all), so existing databases may or may not
+-- have them.
+ALTER TABLE public.queue_entries ADD COLUMN IF NOT EXISTS helping boolean DEFAULT false NOT NULL;
+ALTER TABLE public.queue_entries ADD COLUMN IF NOT EXISTS helped boolean DEFAULT true NOT NULL;
+ALTER TABLE public.queues ADD COLUMN IF NOT EXISTS prevent_groups_boost boolean DEFAULT false NOT NULL;
+ALTER TABLE public.queues ADD COLUMN IF NOT EXISTS manual_open boolean DEFAULT false NOT NULL;
+
+-- The dump's indexes referenced a removed column that queue_entries
+-- never had; active (which is NULL once an entry is removed) is what
+-- the queries actually filter on.
+DROP INDEX IF EXISTS public.queue_entries_queue_removed_idx;
+DROP INDEX IF EXISTS public.queue_entries_queue_removed_removed_at_idx;
+CREATE INDEX IF NOT EXISTS queue_entries_queue_active_idx ON public.queue_entries USING btree (queue, active);
+CREATE INDEX IF NOT EXISTS queue_entries_queue_active_removed_at_idx ON public.queue_entries USING btree (queue, active, removed_at);
@@ -0,0 +1,27 @@
+-- State shared between instances of the server by the Postgres broker
+-- (see broker.go). Instances heartbeat every few seconds, and anything
+-- belonging to one that stops is cleaned up by the others.
+CREATE TABLE public.broker_instances (
+    id text PRIMARY KEY,
+    heartbeat timestamp with time zone DEFAULT NOW() NOT NULL
+);
+
+-- The WebSockets each instance has open to each queue. Anonymous
+-- connections are counted under an empty email.
+CREATE TABLE public.websocket_presence (
+    instance text NOT NULL REFERENCES public.broker_instances(id) ON DELETE CASCADE,
+    queue character(27) NOT NULL COLLATE pg_catalog."C",
+    email text NOT NULL,
+    connections integer NOT NULL,
+    PRIMARY KEY (instance, queue, email)
+);
+
+CREATE INDEX websocket_presence_queue_idx ON public.websocket_presence USING btree (queue);
+
+-- NOTIFY payloads are limited to 8000 bytes, so larger events are stored
+-- here and referred to by ID in the notification.
+CREATE TABLE public.broker_payloads (
+    id bigserial PRIMARY KEY,
+    payload text NOT NULL,
+    created_at timestamp with time zone DEFAULT NOW() NOT NULL
+);
@@ -0,0 +1,6 @@
+-- The last sequence number handed out to an event on each queue, shared
+-- by all instances so clients can resume against any of them.
+CREATE TABLE public.websocket_sequences (
+    queue character(27) NOT NULL COLLATE pg_catalog."C" PRIMARY KEY,
+    seq bigint NOT NULL
+);
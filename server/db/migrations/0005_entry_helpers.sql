@@ -0,0 +1,6 @@
+-- Who's helping each entry and since when. These are left in place once
+-- the entry is removed, so removed_at - helping_since is how long the
+-- student was helped for.
+ALTER TABLE public.queue_entries ADD COLUMN helping_by text;
+ALTER TABLE public.queue_entries ADD COLUMN helping_name text;
+ALTER TABLE public.queue_entries ADD COLUMN helping_since timestamp without time zone;
@@ -0,0 +1,16 @@
+-- Who changed what, written in the same transaction as the change. There
+-- are deliberately no foreign keys: the log should outlive the queues and
+-- courses it talks about.
+CREATE TABLE public.audit_log (
+    id character(27) NOT NULL COLLATE pg_catalog."C" PRIMARY KEY,
+    course character(27) NOT NULL COLLATE pg_catalog."C",
+    queue character(27) COLLATE pg_catalog."C",
+    actor text NOT NULL,
+    action text NOT NULL,
+    target text NOT NULL,
+    before jsonb,
+    after jsonb
+);
+
+CREATE INDEX audit_log_course_id_idx ON public.audit_log USING btree (course, id);
+CREATE INDEX audit_log_queue_id_idx ON public.audit_log USING btree (queue, id);
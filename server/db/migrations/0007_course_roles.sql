@@ -0,0 +1,6 @@
+-- What each course admin is allowed to do. Everyone who was already an
+-- admin could do everything, so they start out as instructors; anyone
+-- added without a role from now on is a TA.
+ALTER TABLE public.course_admins ADD COLUMN role text NOT NULL DEFAULT 'instructor'
+    CHECK (role IN ('observer', 'ta', 'head_ta', 'instructor'));
+ALTER TABLE public.course_admins ALTER COLUMN role SET DEFAULT 'ta';
@@ -0,0 +1,18 @@
+-- Tokens for bots and scripts to act as the user who made them. Only the
+-- SHA-256 hash of each token is kept; course is set for tokens that only
+-- work in one course.
+CREATE TABLE public.api_tokens (
+    id character(27) NOT NULL COLLATE pg_catalog."C" PRIMARY KEY,
+    token_hash text NOT NULL UNIQUE,
+    email text NOT NULL,
+    name text NOT NULL,
+    course character(27) COLLATE pg_catalog."C" REFERENCES public.courses(id) ON DELETE CASCADE,
+    scopes text[] NOT NULL,
+    expires_at timestamp with time zone NOT NULL,
+    last_used_at timestamp with time zone,
+    owner_name text NOT NULL,
+    owner_first_name text NOT NULL
+);
+
+CREATE INDEX api_tokens_email_idx ON public.api_tokens USING btree (email);
+CREATE INDEX api_tokens_course_idx ON public.api_tokens USING btree (course);
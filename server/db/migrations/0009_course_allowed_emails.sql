@@ -0,0 +1,10 @@
+-- Users outside of the valid domains (students from a partner school,
+-- guest graders with personal accounts) who can use a course anyway.
+-- Emails are stored lowercased.
+CREATE TABLE public.course_allowed_emails (
+    course character(27) NOT NULL COLLATE pg_catalog."C" REFERENCES public.courses(id) ON DELETE CASCADE,
+    email text NOT NULL,
+    PRIMARY KEY (course, email)
+);
+
+CREATE INDEX course_allowed_emails_email_idx ON public.course_allowed_emails USING btree (email);
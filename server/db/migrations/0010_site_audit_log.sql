@@ -0,0 +1,5 @@
+-- Some things in the audit log (like impersonation) aren't about any one
+-- course; those entries don't have one.
+ALTER TABLE public.audit_log ALTER COLUMN course DROP NOT NULL;
+
+CREATE INDEX audit_log_site_id_idx ON public.audit_log USING btree (id) WHERE course IS NULL;
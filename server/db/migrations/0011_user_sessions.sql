@@ -0,0 +1,13 @@
+-- Every login, so users can see where they're logged in and sessions can
+-- be revoked. Session cookies refer to these by ID; the sessions
+-- themselves still live in http_sessions (or the cookie).
+CREATE TABLE public.user_sessions (
+    id character(27) NOT NULL COLLATE pg_catalog."C" PRIMARY KEY,
+    email text NOT NULL,
+    user_agent text NOT NULL,
+    created_at timestamp with time zone NOT NULL,
+    last_seen_at timestamp with time zone NOT NULL,
+    expires_at timestamp with time zone NOT NULL
+);
+
+CREATE INDEX user_sessions_email_idx ON public.user_sessions USING btree (email);
@@ -0,0 +1,4 @@
+-- The IANA time zone each course's queues open, close and take
+-- appointments in. Empty means the server's time zone, which is what
+-- every course used before.
+ALTER TABLE public.courses ADD COLUMN time_zone text NOT NULL DEFAULT '';
@@ -0,0 +1,9 @@
+-- Schedules for specific dates (in the course's time zone), used instead
+-- of the weekly schedule on those days.
+CREATE TABLE public.schedule_overrides (
+    queue character(27) NOT NULL COLLATE pg_catalog."C" REFERENCES public.queues(id) ON DELETE CASCADE,
+    date date NOT NULL,
+    schedule character(48) NOT NULL,
+    note text NOT NULL DEFAULT '',
+    PRIMARY KEY (queue, date)
+);
@@ -0,0 +1,5 @@
+-- Schedules as lists of open intervals to the minute. Rows saved before
+-- this are NULL and are read from their half-hour schedule; the half-hour
+-- schedule is still kept up to date for anything that reads it.
+ALTER TABLE public.schedules ADD COLUMN intervals jsonb;
+ALTER TABLE public.schedule_overrides ADD COLUMN intervals jsonb;
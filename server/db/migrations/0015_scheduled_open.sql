@@ -0,0 +1,3 @@
+-- Whether the scheduler last saw each scheduled queue open, so that only
+-- one instance announces it opening or closing.
+ALTER TABLE public.queues ADD COLUMN scheduled_open boolean;
@@ -0,0 +1,3 @@
+-- What happens to the entries left in a scheduled queue when it closes
+-- (keep, clear, or carry_over).
+ALTER TABLE public.queues ADD COLUMN end_of_session text NOT NULL DEFAULT 'keep';
@@ -15,7 +15,7 @@ func (s *Server) GetQueue(ctx context.Context, queue ksuid.KSUID) (*api.Queue, e
 	tx := getTransaction(ctx)
 	var q api.Queue
 	err := tx.GetContext(ctx, &q,
-		"SELECT id, course, type, name, location, map, active FROM queues q WHERE active AND id=$1",
+		"SELECT q.id, q.course, q.type, q.name, q.location, q.map, q.active, c.time_zone FROM queues q JOIN courses c ON c.id=q.course WHERE q.active AND q.id=$1",
 		queue,
 	)
 	return &q, err
@@ -39,15 +39,36 @@ func (s *Server) RemoveQueue(ctx context.Context, queue ksuid.KSUID) error {
 	return err
 }
 
-func (s *Server) GetCurrentDaySchedule(ctx context.Context, queue ksuid.KSUID) (string, error) {
+// queueZone gets the time zone of the queue's course.
+func (s *Server) queueZone(ctx context.Context, queue ksuid.KSUID) (*time.Location, error) {
 	tx := getTransaction(ctx)
-	var schedule string
-	day := time.Now().Weekday()
-	err := tx.GetContext(ctx, &schedule,
-		"SELECT schedule FROM schedules WHERE queue=$1 AND day=$2",
-		queue, day,
+	var timeZone string
+	err := tx.GetContext(ctx, &timeZone,
+		"SELECT c.time_zone FROM queues q JOIN courses c ON c.id=q.course WHERE q.id=$1",
+		queue,
+	)
+	return api.Location(timeZone), err
+}
+
+func (s *Server) GetCurrentDaySchedule(ctx context.Context, queue ksuid.KSUID) (api.DaySchedule, error) {
+	tx := getTransaction(ctx)
+	loc, err := s.queueZone(ctx, queue)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get queue time zone: %w", err)
+	}
+
+	// Today's override, if there is one, takes the place of the weekly
+	// schedule.
+	var schedule daySchedule
+	err = tx.GetContext(ctx, &schedule,
+		`SELECT
+			COALESCE(o.schedule, s.schedule) AS schedule,
+			CASE WHEN o.queue IS NULL THEN s.intervals ELSE o.intervals END AS intervals
+		FROM schedules s LEFT JOIN schedule_overrides o ON o.queue=s.queue AND o.date=$3
+		WHERE s.queue=$1 AND s.day=$2`,
+		queue, api.CurrentWeekday(loc), api.CurrentDate(loc),
 	)
-	return schedule, err
+	return schedule.intervals(), err
 }
 
 func (s *Server) GetQueueEntry(ctx context.Context, entry ksuid.KSUID, allowRemoved bool) (*api.QueueEntry, error) {
@@ -86,7 +107,7 @@ func (s *Server) GetQueueConfiguration(ctx context.Context, queue ksuid.KSUID) (
 	tx := getTransaction(ctx)
 	var config api.QueueConfiguration
 	err := tx.GetContext(ctx, &config,
-		"SELECT id, enable_location_field, prevent_unregistered, prevent_groups, prevent_groups_boost, prioritize_new, cooldown, virtual, scheduled, manual_open FROM queues WHERE id=$1",
+		"SELECT id, enable_location_field, prevent_unregistered, prevent_groups, prevent_groups_boost, prioritize_new, cooldown, virtual, scheduled, manual_open, end_of_session FROM queues WHERE id=$1",
 		queue,
 	)
 	return &config, err
@@ -95,8 +116,50 @@ func (s *Server) GetQueueConfiguration(ctx context.Context, queue ksuid.KSUID) (
 func (s *Server) UpdateQueueConfiguration(ctx context.Context, queue ksuid.KSUID, config *api.QueueConfiguration) error {
 	tx := getTransaction(ctx)
 	_, err := tx.ExecContext(ctx,
-		"UPDATE queues SET enable_location_field=$1, prevent_unregistered=$2, prevent_groups=$3, prevent_groups_boost=$4, prioritize_new=$5, cooldown=$6, virtual=$7, scheduled=$8 WHERE id=$9",
-		config.EnableLocationField, config.PreventUnregistered, config.PreventGroups, config.PreventGroupsBoost, config.PrioritizeNew, config.Cooldown, config.Virtual, config.Scheduled, queue,
+		"UPDATE queues SET enable_location_field=$1, prevent_unregistered=$2, prevent_groups=$3, prevent_groups_boost=$4, prioritize_new=$5, cooldown=$6, virtual=$7, scheduled=$8, end_of_session=$9, scheduled_open=NULL WHERE id=$10",
+		config.EnableLocationField, config.PreventUnregistered, config.PreventGroups, config.PreventGroupsBoost, config.PrioritizeNew, config.Cooldown, config.Virtual, config.Scheduled, config.EndOfSession, queue,
+	)
+	return err
+}
+
+func (s *Server) GetScheduledQueues(ctx context.Context) ([]*api.Queue, error) {
+	tx := getTransaction(ctx)
+	queues := make([]*api.Queue, 0)
+	err := tx.SelectContext(ctx, &queues,
+		"SELECT q.id, q.course, q.type, q.name, q.location, q.map, q.active, c.time_zone FROM queues q JOIN courses c ON c.id=q.course WHERE q.active AND q.type=$1 AND q.scheduled ORDER BY q.id",
+		api.Ordered,
+	)
+	return queues, err
+}
+
+func (s *Server) SetScheduledOpen(ctx context.Context, queue ksuid.KSUID, open bool) (*bool, error) {
+	tx := getTransaction(ctx)
+	// Locking the row makes another instance checking the same queue wait
+	// for us, and then see that nothing's changed.
+	var was *bool
+	err := tx.GetContext(ctx, &was,
+		"SELECT scheduled_open FROM queues WHERE id=$1 FOR UPDATE",
+		queue,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"UPDATE queues SET scheduled_open=$1 WHERE id=$2",
+		open, queue,
+	)
+	return was, err
+}
+
+// forgetScheduledOpen forgets whether the queue's schedule had it open,
+// after its schedule changes. Otherwise the next check would take the
+// change for the queue opening or closing on its own, and end its session.
+func forgetScheduledOpen(ctx context.Context, queue ksuid.KSUID) error {
+	tx := getTransaction(ctx)
+	_, err := tx.ExecContext(ctx,
+		"UPDATE queues SET scheduled_open=NULL WHERE id=$1",
+		queue,
 	)
 	return err
 }
@@ -221,83 +284,6 @@ func (s *Server) TeammateInQueue(ctx context.Context, queue ksuid.KSUID, email s
 	return n > 0, err
 }
 
-func (s *Server) CanAddEntry(ctx context.Context, queue ksuid.KSUID, email string) (bool, error) {
-	q, err := s.GetQueue(ctx, queue)
-	if err != nil {
-		return false, fmt.Errorf("failed to get queue: %w", err)
-	}
-
-	admin, err := s.CourseAdmin(ctx, q.Course, email)
-	if err != nil {
-		return false, fmt.Errorf("failed to determine admin status in course: %w", err)
-	}
-
-	if admin {
-		return true, nil
-	}
-
-	config, err := s.GetQueueConfiguration(ctx, queue)
-	if err != nil {
-		return false, fmt.Errorf("failed to get queue configuration: %w", err)
-	}
-
-	if config.Scheduled {
-		schedule, err := s.GetCurrentDaySchedule(ctx, queue)
-		if err != nil {
-			return false, fmt.Errorf("failed to get queue schedule: %w", err)
-		}
-		halfHour := api.CurrentHalfHour()
-		if schedule[halfHour] == 'c' {
-			return false, fmt.Errorf("the queue is closed")
-		}
-	} else if !config.ManualOpen {
-		return false, fmt.Errorf("the queue is closed")
-	}
-
-	if config.PreventUnregistered {
-		isInRoster, err := s.UserInQueueRoster(ctx, queue, email)
-		if err != nil {
-			return false, fmt.Errorf("failed to determine roster status in queue: %w", err)
-		}
-
-		if !isInRoster {
-			return false, fmt.Errorf("you are not in the course roster")
-		}
-	}
-
-	if config.PreventGroups {
-		teammateInQueue, err := s.TeammateInQueue(ctx, queue, email)
-		if err != nil {
-			return false, fmt.Errorf("failed to determine teammate status in queue: %w", err)
-		}
-
-		if teammateInQueue {
-			return false, fmt.Errorf("your teammate is in the queue")
-		}
-	}
-
-	last, err := s.LastHelpedTime(ctx, queue, email)
-	if err != nil {
-		return false, fmt.Errorf("failed to get last helped time: %w", err)
-	}
-
-	if last.Valid && time.Since(last.Time) < time.Second*time.Duration(config.Cooldown) {
-		e := "you are attempting to sign up too soon after you were last helped. Try again in "
-		wait := time.Until(last.Time.Add(time.Second * time.Duration(config.Cooldown)))
-		switch int(wait.Minutes()) {
-		case 0:
-			e += fmt.Sprintf("%d seconds", int(wait.Seconds()))
-		case 1:
-			e += "a minute"
-		default:
-			e += fmt.Sprintf("%d minutes", int(wait.Minutes()))
-		}
-		return false, fmt.Errorf(e)
-	}
-
-	return true, nil
-}
-
 func (s *Server) LastHelpedTime(ctx context.Context, queue ksuid.KSUID, email string) (sql.NullTime, error) {
 	tx := getTransaction(ctx)
 	var t sql.NullTime
@@ -322,7 +308,12 @@ func (s *Server) GetEntryPriority(ctx context.Context, queue ksuid.KSUID, email
 		return 0, nil
 	}
 
-	start, _ := api.WeekdayBounds(int(time.Now().Local().Weekday()))
+	loc, err := s.queueZone(ctx, queue)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get queue time zone: %w", err)
+	}
+
+	start, _ := api.WeekdayBounds(api.CurrentWeekday(loc), loc)
 	var payload [16]byte
 	firstIDOfDay, err := ksuid.FromParts(start, payload[:])
 	if err != nil {
@@ -388,12 +379,12 @@ func (s *Server) CanRemoveQueueEntry(ctx context.Context, queue ksuid.KSUID, ent
 		return false, fmt.Errorf("failed to get queue: %w", err)
 	}
 
-	admin, err := s.CourseAdmin(ctx, q.Course, email)
+	role, err := s.CourseRole(ctx, q.Course, email)
 	if err != nil {
-		return false, fmt.Errorf("failed to determine admin status: %w", err)
+		return false, fmt.Errorf("failed to determine role in course: %w", err)
 	}
 
-	if admin {
+	if role.AtLeast(api.RoleTA) {
 		return true, nil
 	}
 
@@ -424,11 +415,13 @@ func (s *Server) PinQueueEntry(ctx context.Context, entry ksuid.KSUID) error {
 	return err
 }
 
-func (s *Server) SetQueueEntryHelping(ctx context.Context, entry ksuid.KSUID, helping bool) error {
+func (s *Server) SetQueueEntryHelping(ctx context.Context, entry ksuid.KSUID, helping bool, helper, helperName string) error {
 	tx := getTransaction(ctx)
+	// The same staff member claiming an entry again keeps their original
+	// start time.
 	_, err := tx.ExecContext(ctx,
-		"UPDATE queue_entries SET helping=$1 WHERE id=$2",
-		helping, entry,
+		"UPDATE queue_entries SET helping=$1, helping_by=CASE WHEN $1 THEN $2 END, helping_name=CASE WHEN $1 THEN $3 END, helping_since=CASE WHEN NOT $1 THEN NULL WHEN helping AND helping_by=$2 THEN helping_since ELSE NOW() END WHERE id=$4",
+		helping, helper, helperName, entry,
 	)
 	return err
 }
@@ -460,6 +453,15 @@ func (s *Server) ClearQueueEntries(ctx context.Context, queue ksuid.KSUID, remov
 	return err
 }
 
+func (s *Server) BoostQueueEntries(ctx context.Context, queue ksuid.KSUID, boost int) error {
+	tx := getTransaction(ctx)
+	_, err := tx.ExecContext(ctx,
+		"UPDATE queue_entries SET priority=priority+$1 WHERE active IS NOT NULL AND queue=$2",
+		boost, queue,
+	)
+	return err
+}
+
 func (s *Server) GetQueueStack(ctx context.Context, queue ksuid.KSUID, limit int) ([]*api.RemovedQueueEntry, error) {
 	tx := getTransaction(ctx)
 	entries := make([]*api.RemovedQueueEntry, 0)
@@ -470,6 +472,77 @@ func (s *Server) GetQueueStack(ctx context.Context, queue ksuid.KSUID, limit int
 	return entries, err
 }
 
+// idRange returns the bounds of the IDs of entries created between from
+// (inclusive) and to (exclusive); entry IDs are ordered by creation time.
+func idRange(from, to time.Time) (first, last ksuid.KSUID, err error) {
+	var payload [16]byte
+	first, err = ksuid.FromParts(from, payload[:])
+	if err != nil {
+		return first, last, fmt.Errorf("failed to generate first KSUID of range: %w", err)
+	}
+	last, err = ksuid.FromParts(to, payload[:])
+	if err != nil {
+		return first, last, fmt.Errorf("failed to generate last KSUID of range: %w", err)
+	}
+	return first, last, nil
+}
+
+func (s *Server) GetRemovedQueueEntries(ctx context.Context, queue ksuid.KSUID, from, to time.Time) ([]*api.RemovedQueueEntry, error) {
+	tx := getTransaction(ctx)
+	first, last, err := idRange(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*api.RemovedQueueEntry, 0)
+	err = tx.SelectContext(ctx, &entries,
+		"SELECT * FROM queue_entries WHERE queue=$1 AND active IS NULL AND id>=$2 AND id<$3 ORDER BY id",
+		queue, first, last,
+	)
+	return entries, err
+}
+
+func (s *Server) ExportQueueEntries(ctx context.Context, queue ksuid.KSUID, from, to time.Time, f func(*api.QueueEntry) error) error {
+	tx := getTransaction(ctx)
+	first, last, err := idRange(from, to)
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.QueryxContext(ctx,
+		"SELECT * FROM queue_entries WHERE queue=$1 AND id>=$2 AND id<$3 ORDER BY id",
+		queue, first, last,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e api.QueueEntry
+		err = rows.StructScan(&e)
+		if err != nil {
+			return err
+		}
+
+		err = f(&e)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (s *Server) GetHelpThroughput(ctx context.Context, queue ksuid.KSUID, since time.Time) (*api.HelpThroughput, error) {
+	tx := getTransaction(ctx)
+	var t api.HelpThroughput
+	err := tx.GetContext(ctx, &t,
+		"SELECT COUNT(*) AS helped, COUNT(DISTINCT removed_by) AS helpers, MIN(removed_at) AS first FROM queue_entries WHERE queue=$1 AND active IS NULL AND removed_by!=email AND helped AND removed_at>=$2",
+		queue, since,
+	)
+	return &t, err
+}
+
 func (s *Server) GetQueueAnnouncements(ctx context.Context, queue ksuid.KSUID) ([]*api.Announcement, error) {
 	tx := getTransaction(ctx)
 	announcements := make([]*api.Announcement, 0)
@@ -500,38 +573,61 @@ func (s *Server) RemoveQueueAnnouncement(ctx context.Context, announcement ksuid
 	return err
 }
 
-func (s *Server) GetQueueSchedule(ctx context.Context, queue ksuid.KSUID) ([]string, error) {
+// daySchedule is a schedule as it's stored: intervals, and the same day
+// in half hours for anything that reads the table directly. Schedules
+// saved before intervals existed only have the half hours.
+type daySchedule struct {
+	Schedule  string          `db:"schedule"`
+	Intervals api.DaySchedule `db:"intervals"`
+}
+
+func (d daySchedule) intervals() api.DaySchedule {
+	if d.Intervals == nil {
+		return api.ParseHalfHours(d.Schedule)
+	}
+	return d.Intervals
+}
+
+func (s *Server) GetQueueSchedule(ctx context.Context, queue ksuid.KSUID) ([]api.DaySchedule, error) {
 	tx := getTransaction(ctx)
-	schedules := make([]string, 0)
-	err := tx.SelectContext(ctx, &schedules,
-		"SELECT schedule FROM schedules WHERE queue=$1 ORDER BY day",
+	var rows []daySchedule
+	err := tx.SelectContext(ctx, &rows,
+		"SELECT schedule, intervals FROM schedules WHERE queue=$1 ORDER BY day",
 		queue,
 	)
-	return schedules, err
+	if err != nil {
+		return nil, err
+	}
+
+	schedules := make([]api.DaySchedule, 0, len(rows))
+	for _, row := range rows {
+		schedules = append(schedules, row.intervals())
+	}
+	return schedules, nil
 }
 
-func (s *Server) AddQueueSchedule(ctx context.Context, queue ksuid.KSUID, day int, schedule string) error {
+func (s *Server) AddQueueSchedule(ctx context.Context, queue ksuid.KSUID, day int, schedule api.DaySchedule) error {
 	tx := getTransaction(ctx)
 	_, err := tx.ExecContext(ctx,
-		"INSERT INTO schedules (queue, day, schedule) VALUES ($1, $2, $3)",
-		queue, day, schedule,
+		"INSERT INTO schedules (queue, day, schedule, intervals) VALUES ($1, $2, $3, $4)",
+		queue, day, schedule.HalfHours(), schedule,
 	)
 	return err
 }
 
-func (s *Server) UpdateQueueSchedule(ctx context.Context, queue ksuid.KSUID, schedules []string) error {
+func (s *Server) UpdateQueueSchedule(ctx context.Context, queue ksuid.KSUID, schedules []api.DaySchedule) error {
 	tx := getTransaction(ctx)
 	for i, schedule := range schedules {
 		_, err := tx.ExecContext(ctx,
-			"UPDATE schedules SET schedule=$1 WHERE queue=$2 AND day=$3",
-			schedule, queue, i,
+			"UPDATE schedules SET schedule=$1, intervals=$2 WHERE queue=$3 AND day=$4",
+			schedule.HalfHours(), schedule, queue, i,
 		)
 		if err != nil {
 			return fmt.Errorf("failed to update schedule for day %d: %w", i, err)
 		}
 	}
 
-	return nil
+	return forgetScheduledOpen(ctx, queue)
 }
 
 func (s *Server) SendMessage(ctx context.Context, queue ksuid.KSUID, content, sender, receiver string) (*api.Message, error) {
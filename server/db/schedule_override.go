@@ -0,0 +1,68 @@
+package db
+
+import (
+	"context"
+
+	"github.com/CarsonHoffman/office-hours-queue/server/api"
+	"github.com/segmentio/ksuid"
+)
+
+// fillIntervals reads the intervals of overrides saved before there were
+// any from their half hours.
+func fillIntervals(o *api.ScheduleOverride) {
+	if o.Intervals == nil {
+		o.Intervals = api.ParseHalfHours(o.Schedule)
+	}
+}
+
+func (s *Server) GetScheduleOverrides(ctx context.Context, queue ksuid.KSUID, from string) ([]*api.ScheduleOverride, error) {
+	tx := getTransaction(ctx)
+	overrides := make([]*api.ScheduleOverride, 0)
+	err := tx.SelectContext(ctx, &overrides,
+		"SELECT queue, to_char(date, 'YYYY-MM-DD') AS date, schedule, intervals, note FROM schedule_overrides WHERE queue=$1 AND date>=$2 ORDER BY date",
+		queue, from,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, o := range overrides {
+		fillIntervals(o)
+	}
+	return overrides, nil
+}
+
+func (s *Server) GetScheduleOverride(ctx context.Context, queue ksuid.KSUID, date string) (*api.ScheduleOverride, error) {
+	tx := getTransaction(ctx)
+	var override api.ScheduleOverride
+	err := tx.GetContext(ctx, &override,
+		"SELECT queue, to_char(date, 'YYYY-MM-DD') AS date, schedule, intervals, note FROM schedule_overrides WHERE queue=$1 AND date=$2",
+		queue, date,
+	)
+	fillIntervals(&override)
+	return &override, err
+}
+
+func (s *Server) SetScheduleOverride(ctx context.Context, override *api.ScheduleOverride) error {
+	tx := getTransaction(ctx)
+	_, err := tx.ExecContext(ctx,
+		"INSERT INTO schedule_overrides (queue, date, schedule, intervals, note) VALUES ($1, $2, $3, $4, $5) ON CONFLICT (queue, date) DO UPDATE SET schedule=EXCLUDED.schedule, intervals=EXCLUDED.intervals, note=EXCLUDED.note",
+		override.Queue, override.Date, override.Schedule, override.Intervals, override.Note,
+	)
+	if err != nil {
+		return err
+	}
+	return forgetScheduledOpen(ctx, override.Queue)
+}
+
+func (s *Server) RemoveScheduleOverride(ctx context.Context, queue ksuid.KSUID, date string) error {
+	tx := getTransaction(ctx)
+	_, err := tx.ExecContext(ctx,
+		"DELETE FROM schedule_overrides WHERE queue=$1 AND date=$2",
+		queue, date,
+	)
+	if err != nil {
+		return err
+	}
+	return forgetScheduledOpen(ctx, queue)
+}
@@ -5,18 +5,24 @@ import (
 	"fmt"
 
 	"github.com/CarsonHoffman/office-hours-queue/server/api"
-	"github.com/dlmiddlecote/sqlstats"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
-	"github.com/prometheus/client_golang/prometheus"
 )
 
 type Server struct {
 	DB *sqlx.DB
+
+	// Kept around for connections that can't come from the pool, like
+	// the broker's listener.
+	connect string
 }
 
-func (s *Server) BeginTx() (*sqlx.Tx, error) {
-	return s.DB.Beginx()
+func (s *Server) BeginTx() (api.Tx, error) {
+	tx, err := s.DB.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	return tx, nil
 }
 
 // Does this make calling database functions annoying? You bet!
@@ -27,19 +33,44 @@ func getTransaction(ctx context.Context) *sqlx.Tx {
 	return ctx.Value(api.TransactionContextKey).(*sqlx.Tx)
 }
 
-func New(url, database, username, password string) (*Server, error) {
+// Connect opens the database without touching the schema; New is what
+// the server wants, but the migrate command needs a connection even
+// when the schema is out of date.
+func Connect(url, database, username, password string) (*Server, error) {
 	connect := fmt.Sprintf("postgres://%s:%s@%s/%s?sslmode=disable", username, password, url, database)
 	db, err := sqlx.Connect("postgres", connect)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
 
-	var s Server
-	s.DB = db
+	return &Server{DB: db, connect: connect}, nil
+}
+
+// New connects to the database and brings its schema up to date. If
+// migrate is false, pending migrations are an error instead, for
+// deployments that would rather run them by hand.
+func New(url, database, username, password string, migrate bool) (*Server, error) {
+	s, err := Connect(url, database, username, password)
+	if err != nil {
+		return nil, err
+	}
 
-	prometheus.MustRegister(sqlstats.NewStatsCollector("queue", db))
+	if migrate {
+		_, err = s.Migrate(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("failed to migrate database: %w", err)
+		}
+	} else {
+		pending, err := s.PendingMigrations(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("failed to check migrations: %w", err)
+		}
+		if len(pending) > 0 {
+			return nil, fmt.Errorf("database has %d pending migrations (first: %04d_%s)", len(pending), pending[0].Version, pending[0].Name)
+		}
+	}
 
-	return &s, nil
+	return s, nil
 }
 
 func (s *Server) SiteAdmin(ctx context.Context, email string) (bool, error) {
@@ -0,0 +1,93 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/CarsonHoffman/office-hours-queue/server/api"
+	"github.com/segmentio/ksuid"
+)
+
+const userSessionColumns = "id, email, user_agent, created_at, last_seen_at, expires_at"
+
+func (s *Server) UseUserSession(ctx context.Context, id ksuid.KSUID) (*api.UserSession, error) {
+	tx := getTransaction(ctx)
+	var session api.UserSession
+	err := tx.GetContext(ctx, &session,
+		"SELECT "+userSessionColumns+" FROM user_sessions WHERE id=$1 AND expires_at>NOW()",
+		id,
+	)
+	if err != nil {
+		return &session, err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"UPDATE user_sessions SET last_seen_at=NOW() WHERE id=$1 AND last_seen_at < NOW() - $2 * INTERVAL '1 second'",
+		id, api.LastSeenResolution.Seconds(),
+	)
+	return &session, err
+}
+
+func (s *Server) GetUserSession(ctx context.Context, id ksuid.KSUID) (*api.UserSession, error) {
+	tx := getTransaction(ctx)
+	var session api.UserSession
+	err := tx.GetContext(ctx, &session,
+		"SELECT "+userSessionColumns+" FROM user_sessions WHERE id=$1 AND expires_at>NOW()",
+		id,
+	)
+	return &session, err
+}
+
+func (s *Server) GetUserSessions(ctx context.Context, email string) ([]*api.UserSession, error) {
+	tx := getTransaction(ctx)
+	sessions := make([]*api.UserSession, 0)
+	err := tx.SelectContext(ctx, &sessions,
+		"SELECT "+userSessionColumns+" FROM user_sessions WHERE email=$1 AND expires_at>NOW() ORDER BY last_seen_at DESC",
+		email,
+	)
+	return sessions, err
+}
+
+func (s *Server) AddUserSession(ctx context.Context, session *api.UserSession) (*api.UserSession, error) {
+	tx := getTransaction(ctx)
+
+	// Nobody will ever see the user's expired sessions again, so this is
+	// as good a time as any to clean them up.
+	_, err := tx.ExecContext(ctx,
+		"DELETE FROM user_sessions WHERE email=$1 AND expires_at<=NOW()",
+		session.Email,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete expired sessions: %w", err)
+	}
+
+	id := ksuid.New()
+	var newSession api.UserSession
+	err = tx.GetContext(ctx, &newSession,
+		"INSERT INTO user_sessions (id, email, user_agent, created_at, last_seen_at, expires_at) VALUES ($1, $2, $3, $4, $4, $5) RETURNING "+userSessionColumns,
+		id, session.Email, session.UserAgent, session.CreatedAt, session.ExpiresAt,
+	)
+	return &newSession, err
+}
+
+func (s *Server) RemoveUserSession(ctx context.Context, id ksuid.KSUID) error {
+	tx := getTransaction(ctx)
+	_, err := tx.ExecContext(ctx,
+		"DELETE FROM user_sessions WHERE id=$1",
+		id,
+	)
+	return err
+}
+
+func (s *Server) RemoveUserSessions(ctx context.Context, email string) (int, error) {
+	tx := getTransaction(ctx)
+	res, err := tx.ExecContext(ctx,
+		"DELETE FROM user_sessions WHERE email=$1 AND expires_at>NOW()",
+		email,
+	)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
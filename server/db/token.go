@@ -0,0 +1,91 @@
+package db
+
+import (
+	"context"
+
+	"github.com/CarsonHoffman/office-hours-queue/server/api"
+	"github.com/segmentio/ksuid"
+)
+
+const apiTokenColumns = "id, email, name, course, scopes, expires_at, last_used_at, owner_name, owner_first_name"
+
+func (s *Server) UseAPIToken(ctx context.Context, hash string) (*api.APIToken, error) {
+	tx := getTransaction(ctx)
+	var token api.APIToken
+	err := tx.GetContext(ctx, &token,
+		"SELECT "+apiTokenColumns+" FROM api_tokens WHERE token_hash=$1",
+		hash,
+	)
+	if err != nil {
+		return &token, err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"UPDATE api_tokens SET last_used_at=NOW() WHERE id=$1 AND (last_used_at IS NULL OR last_used_at < NOW() - $2 * INTERVAL '1 second')",
+		token.ID, api.LastSeenResolution.Seconds(),
+	)
+	return &token, err
+}
+
+func (s *Server) GetAPIToken(ctx context.Context, id ksuid.KSUID) (*api.APIToken, error) {
+	tx := getTransaction(ctx)
+	var token api.APIToken
+	err := tx.GetContext(ctx, &token,
+		"SELECT "+apiTokenColumns+" FROM api_tokens WHERE id=$1",
+		id,
+	)
+	return &token, err
+}
+
+func (s *Server) GetAPITokens(ctx context.Context, email string) ([]*api.APIToken, error) {
+	tx := getTransaction(ctx)
+	tokens := make([]*api.APIToken, 0)
+	err := tx.SelectContext(ctx, &tokens,
+		"SELECT "+apiTokenColumns+" FROM api_tokens WHERE email=$1 ORDER BY id",
+		email,
+	)
+	return tokens, err
+}
+
+func (s *Server) GetCourseAPITokens(ctx context.Context, course ksuid.KSUID) ([]*api.APIToken, error) {
+	tx := getTransaction(ctx)
+	tokens := make([]*api.APIToken, 0)
+	err := tx.SelectContext(ctx, &tokens,
+		"SELECT "+apiTokenColumns+" FROM api_tokens WHERE course=$1 ORDER BY id",
+		course,
+	)
+	return tokens, err
+}
+
+func (s *Server) AddAPIToken(ctx context.Context, token *api.APIToken, hash string) (*api.APIToken, error) {
+	tx := getTransaction(ctx)
+	id := ksuid.New()
+	var newToken api.APIToken
+	err := tx.GetContext(ctx, &newToken,
+		"INSERT INTO api_tokens (id, token_hash, email, name, course, scopes, expires_at, owner_name, owner_first_name) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING "+apiTokenColumns,
+		id, hash, token.Email, token.Name, token.Course, token.Scopes, token.ExpiresAt, token.OwnerName, token.OwnerFirstName,
+	)
+	return &newToken, err
+}
+
+func (s *Server) RemoveAPIToken(ctx context.Context, id ksuid.KSUID) error {
+	tx := getTransaction(ctx)
+	_, err := tx.ExecContext(ctx,
+		"DELETE FROM api_tokens WHERE id=$1",
+		id,
+	)
+	return err
+}
+
+func (s *Server) RemoveAPITokens(ctx context.Context, email string) (int, error) {
+	tx := getTransaction(ctx)
+	res, err := tx.ExecContext(ctx,
+		"DELETE FROM api_tokens WHERE email=$1",
+		email,
+	)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
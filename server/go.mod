@@ -1,21 +1,21 @@
 module github.com/CarsonHoffman/office-hours-queue/server
 
-go 1.14
+go 1.16
 
 require (
 	cloud.google.com/go/compute v1.5.0 // indirect
 	github.com/antonlindstrom/pgstore v0.0.0-20200229204646-b08ebf1105e0
+	github.com/coreos/go-oidc/v3 v3.1.0
 	github.com/cskr/pubsub v1.0.2
 	github.com/dchest/uniuri v0.0.0-20200228104902-7aecb25e1fe5
 	github.com/dlmiddlecote/sqlstats v1.0.2
 	github.com/go-chi/chi v1.5.4
 	github.com/go-chi/chi/v5 v5.0.7
-	github.com/go-kit/kit v0.10.0 // indirect
+	github.com/golang/groupcache v0.0.0-20210331224755-41bb18bfe9da // indirect
 	github.com/gorilla/sessions v1.2.1
 	github.com/gorilla/websocket v1.5.0
 	github.com/jmoiron/sqlx v1.3.4
 	github.com/lib/pq v1.10.4
-	github.com/olivere/elastic/v7 v7.0.31
 	github.com/prometheus/client_golang v1.12.1
 	github.com/segmentio/ksuid v1.0.4
 	go.uber.org/atomic v1.9.0 // indirect
@@ -0,0 +1,83 @@
+// Package login implements the identity providers users can log in to the
+// queue with.
+package login
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/CarsonHoffman/office-hours-queue/server/api"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/idtoken"
+	goauth2 "google.golang.org/api/oauth2/v2"
+	"google.golang.org/api/option"
+)
+
+// Google logs users in with their Google accounts.
+type Google struct {
+	config oauth2.Config
+}
+
+func NewGoogle(clientID, clientSecret, redirectURL string) *Google {
+	return &Google{
+		config: oauth2.Config{
+			Endpoint:     google.Endpoint,
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			RedirectURL:  redirectURL,
+			Scopes:       []string{"openid", "email", "profile"},
+		},
+	}
+}
+
+func (g *Google) AuthCodeURL(state string) string {
+	return g.config.AuthCodeURL(state)
+}
+
+func (g *Google) Exchange(ctx context.Context, code, state string) (*api.UserInfo, error) {
+	token, err := g.config.Exchange(ctx, code)
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange token: %w", err)
+	}
+
+	service, err := goauth2.NewService(ctx, option.WithTokenSource(g.config.TokenSource(ctx, token)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up OAuth2 service: %w", err)
+	}
+
+	info, err := service.Userinfo.V2.Me.Get().Do()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch user info: %w", err)
+	}
+
+	return &api.UserInfo{
+		Email:     info.Email,
+		Name:      info.Name,
+		FirstName: info.GivenName,
+		Picture:   info.Picture,
+	}, nil
+}
+
+func (g *Google) ValidateIDToken(ctx context.Context, token string) (*api.UserInfo, error) {
+	payload, err := idtoken.Validate(ctx, token, g.config.ClientID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to validate token: %w", err)
+	}
+
+	email, ok := payload.Claims["email"].(string)
+	if !ok {
+		return nil, fmt.Errorf("token has no email")
+	}
+
+	// The rest are nice to have, but we can get by without them.
+	name, _ := payload.Claims["name"].(string)
+	firstName, _ := payload.Claims["given_name"].(string)
+	picture, _ := payload.Claims["picture"].(string)
+	return &api.UserInfo{
+		Email:     email,
+		Name:      name,
+		FirstName: firstName,
+		Picture:   picture,
+	}, nil
+}
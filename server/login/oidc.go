@@ -0,0 +1,126 @@
+package login
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/CarsonHoffman/office-hours-queue/server/api"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// Claims says which claims of an ID token hold each piece of a user's
+// information, since not every identity provider uses the standard ones.
+type Claims struct {
+	Email     string
+	Name      string
+	FirstName string
+	Picture   string
+}
+
+// DefaultClaims are the standard OpenID Connect claims.
+var DefaultClaims = Claims{
+	Email:     "email",
+	Name:      "name",
+	FirstName: "given_name",
+	Picture:   "picture",
+}
+
+// OIDC logs users in with any OpenID Connect identity provider (e.g.
+// Keycloak or Shibboleth), found through the issuer's discovery document.
+// ID tokens are checked against the keys the issuer publishes.
+type OIDC struct {
+	config   oauth2.Config
+	verifier *oidc.IDTokenVerifier
+	claims   Claims
+}
+
+// NewOIDC fetches the issuer's discovery document, so the issuer needs to
+// be reachable at startup.
+func NewOIDC(ctx context.Context, issuer, clientID, clientSecret, redirectURL string, scopes []string, claims Claims) (*OIDC, error) {
+	provider, err := oidc.NewProvider(ctx, issuer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover OpenID Connect provider %s: %w", issuer, err)
+	}
+
+	return &OIDC{
+		config: oauth2.Config{
+			Endpoint:     provider.Endpoint(),
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			RedirectURL:  redirectURL,
+			Scopes:       scopes,
+		},
+		verifier: provider.Verifier(&oidc.Config{ClientID: clientID}),
+		claims:   claims,
+	}, nil
+}
+
+// The state is used as the nonce too: it's already random and tied to the
+// user's session, which is all the nonce needs to be.
+func (o *OIDC) AuthCodeURL(state string) string {
+	return o.config.AuthCodeURL(state, oidc.Nonce(state))
+}
+
+func (o *OIDC) Exchange(ctx context.Context, code, state string) (*api.UserInfo, error) {
+	token, err := o.config.Exchange(ctx, code)
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange token: %w", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("token response has no ID token")
+	}
+
+	idToken, err := o.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify ID token: %w", err)
+	}
+
+	if idToken.Nonce != state {
+		return nil, errors.New("ID token nonce doesn't match state")
+	}
+
+	return o.userInfo(idToken)
+}
+
+func (o *OIDC) ValidateIDToken(ctx context.Context, token string) (*api.UserInfo, error) {
+	idToken, err := o.verifier.Verify(ctx, token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify ID token: %w", err)
+	}
+
+	return o.userInfo(idToken)
+}
+
+// userInfo maps the ID token's claims to the user's information.
+func (o *OIDC) userInfo(idToken *oidc.IDToken) (*api.UserInfo, error) {
+	var claims map[string]interface{}
+	err := idToken.Claims(&claims)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode ID token claims: %w", err)
+	}
+
+	email, ok := claims[o.claims.Email].(string)
+	if !ok || email == "" {
+		return nil, fmt.Errorf("ID token has no %s claim", o.claims.Email)
+	}
+
+	// Only trust emails the provider says it's verified, if it says
+	// either way.
+	if verified, ok := claims["email_verified"].(bool); ok && !verified {
+		return nil, fmt.Errorf("email %s isn't verified", email)
+	}
+
+	name, _ := claims[o.claims.Name].(string)
+	firstName, _ := claims[o.claims.FirstName].(string)
+	picture, _ := claims[o.claims.Picture].(string)
+	return &api.UserInfo{
+		Email:     email,
+		Name:      name,
+		FirstName: firstName,
+		Picture:   picture,
+	}, nil
+}
@@ -0,0 +1,198 @@
+package login_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CarsonHoffman/office-hours-queue/server/login"
+)
+
+const testClientID = "queue"
+
+// testIssuer is an OpenID Connect provider that hands out an ID token
+// with whatever claims a test gives it, signed with a key it publishes.
+type testIssuer struct {
+	t      *testing.T
+	srv    *httptest.Server
+	key    *rsa.PrivateKey
+	claims map[string]interface{}
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	i := &testIssuer{t: t, key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                i.srv.URL,
+			"authorization_endpoint":                i.srv.URL + "/authorize",
+			"token_endpoint":                        i.srv.URL + "/token",
+			"jwks_uri":                              i.srv.URL + "/keys",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"alg": "RS256",
+				"use": "sig",
+				"kid": "test",
+				"n":   encode(key.N.Bytes()),
+				"e":   encode(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     i.idToken(i.claims),
+		})
+	})
+
+	i.srv = httptest.NewServer(mux)
+	t.Cleanup(i.srv.Close)
+	return i
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// idToken signs an ID token for the test client with claims on top of
+// the ones every token needs.
+func (i *testIssuer) idToken(claims map[string]interface{}) string {
+	payload := map[string]interface{}{
+		"iss": i.srv.URL,
+		"sub": "1234",
+		"aud": testClientID,
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	for k, v := range claims {
+		payload[k] = v
+	}
+
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": "test"})
+	body, _ := json.Marshal(payload)
+	signed := encode(header) + "." + encode(body)
+
+	hash := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, i.key, crypto.SHA256, hash[:])
+	if err != nil {
+		i.t.Fatalf("failed to sign ID token: %v", err)
+	}
+	return signed + "." + encode(sig)
+}
+
+func (i *testIssuer) provider(claims login.Claims) *login.OIDC {
+	o, err := login.NewOIDC(context.Background(), i.srv.URL, testClientID, "secret", "https://queue.example.edu/api/oauth2callback", []string{"openid", "email", "profile"}, claims)
+	if err != nil {
+		i.t.Fatalf("failed to set up provider: %v", err)
+	}
+	return o
+}
+
+func TestOIDCExchange(t *testing.T) {
+	i := newTestIssuer(t)
+	i.claims = map[string]interface{}{
+		"nonce":          "state",
+		"email":          "student@example.edu",
+		"email_verified": true,
+		"name":           "Jane Student",
+		"given_name":     "Jane",
+		"picture":        "https://example.edu/jane.png",
+	}
+
+	user, err := i.provider(login.DefaultClaims).Exchange(context.Background(), "code", "state")
+	if err != nil {
+		t.Fatalf("exchange failed: %v", err)
+	}
+	if user.Email != "student@example.edu" || user.Name != "Jane Student" || user.FirstName != "Jane" || user.Picture != "https://example.edu/jane.png" {
+		t.Errorf("got user %+v", user)
+	}
+}
+
+func TestOIDCNonceMismatch(t *testing.T) {
+	i := newTestIssuer(t)
+	i.claims = map[string]interface{}{
+		"nonce": "someone else's state",
+		"email": "student@example.edu",
+	}
+
+	_, err := i.provider(login.DefaultClaims).Exchange(context.Background(), "code", "state")
+	if err == nil || !strings.Contains(err.Error(), "nonce") {
+		t.Errorf("exchange with a token for another state got error %v, want a nonce mismatch", err)
+	}
+}
+
+func TestOIDCUnverifiedEmail(t *testing.T) {
+	i := newTestIssuer(t)
+	i.claims = map[string]interface{}{
+		"nonce":          "state",
+		"email":          "student@example.edu",
+		"email_verified": false,
+	}
+
+	_, err := i.provider(login.DefaultClaims).Exchange(context.Background(), "code", "state")
+	if err == nil || !strings.Contains(err.Error(), "verified") {
+		t.Errorf("exchange with an unverified email got error %v, want it refused", err)
+	}
+
+	_, err = i.provider(login.DefaultClaims).ValidateIDToken(context.Background(), i.idToken(i.claims))
+	if err == nil || !strings.Contains(err.Error(), "verified") {
+		t.Errorf("ID token with an unverified email got error %v, want it refused", err)
+	}
+}
+
+func TestOIDCCustomClaims(t *testing.T) {
+	i := newTestIssuer(t)
+	i.claims = map[string]interface{}{
+		"nonce":     "state",
+		"mail":      "student@example.edu",
+		"cn":        "Jane Student",
+		"givenName": "Jane",
+		// The standard claims shouldn't be used when others are configured.
+		"email": "wrong@example.edu",
+		"name":  "Wrong",
+	}
+
+	o := i.provider(login.Claims{
+		Email:     "mail",
+		Name:      "cn",
+		FirstName: "givenName",
+		Picture:   "photo",
+	})
+	user, err := o.Exchange(context.Background(), "code", "state")
+	if err != nil {
+		t.Fatalf("exchange failed: %v", err)
+	}
+	if user.Email != "student@example.edu" || user.Name != "Jane Student" || user.FirstName != "Jane" || user.Picture != "" {
+		t.Errorf("got user %+v", user)
+	}
+
+	// Without the configured email claim, there's nobody to log in.
+	delete(i.claims, "mail")
+	_, err = o.Exchange(context.Background(), "code", "state")
+	if err == nil || !strings.Contains(err.Error(), "mail claim") {
+		t.Errorf("exchange without the email claim got error %v, want it refused", err)
+	}
+}
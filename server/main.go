@@ -1,26 +1,31 @@
 package main
 
 import (
+	"context"
 	"io/ioutil"
 	"net/http"
 	"net/http/pprof"
 	"os"
+	"strings"
 
 	"github.com/CarsonHoffman/office-hours-queue/server/api"
 	"github.com/CarsonHoffman/office-hours-queue/server/db"
+	"github.com/CarsonHoffman/office-hours-queue/server/login"
+	"github.com/CarsonHoffman/office-hours-queue/server/memstore"
+	"github.com/dlmiddlecote/sqlstats"
 	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"go.uber.org/zap"
-	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/google"
 )
 
 func main() {
 	z, _ := zap.NewProduction()
 	l := z.Sugar().With("name", "queue")
 
-	password, err := ioutil.ReadFile(os.Getenv("QUEUE_DB_PASSWORD_FILE"))
-	if err != nil {
-		l.Fatalw("failed to load DB password file", "err", err)
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		migrateCommand(l, os.Args[2:])
+		return
 	}
 
 	oauthClientSecret, err := ioutil.ReadFile(os.Getenv("QUEUE_OAUTH2_CLIENT_SECRET_FILE"))
@@ -28,20 +33,57 @@ func main() {
 		l.Fatalw("failed to load OAuth2 client secret file", "err", err)
 	}
 
-	config := oauth2.Config{
-		Endpoint:     google.Endpoint,
-		ClientID:     os.Getenv("QUEUE_OAUTH2_CLIENT_ID"),
-		ClientSecret: string(oauthClientSecret),
-		RedirectURL:  os.Getenv("QUEUE_OAUTH2_REDIRECT_URI"),
-		Scopes:       []string{"openid", "email", "profile"},
-	}
+	provider := loginProvider(l, string(oauthClientSecret))
 
-	db, err := db.New(os.Getenv("QUEUE_DB_URL"), os.Getenv("QUEUE_DB_DATABASE"), os.Getenv("QUEUE_DB_USERNAME"), string(password))
+	config, err := api.ConfigFromEnv()
 	if err != nil {
-		l.Fatalw("failed to set up database", "err", err)
+		l.Fatalw("failed to load configuration", "err", err)
 	}
 
-	s := api.New(db, l, db.DB.DB, config)
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	var s *api.Server
+	if os.Getenv("QUEUE_STORE") == "memory" {
+		// Handy for local development: no database, and nothing survives
+		// a restart. Sessions are kept in the cookie instead.
+		m := memstore.New()
+		if admin := os.Getenv("QUEUE_SITE_ADMIN"); admin != "" {
+			m.AddSiteAdmin(admin)
+		}
+		l.Warnw("using in-memory store; data will be lost on restart")
+		s, err = api.New(m, api.NewLocalBroker(), l, nil, provider, config, registry)
+	} else {
+		url, database, username, password := dbConfig(l)
+		migrate := os.Getenv("QUEUE_DB_AUTO_MIGRATE") != "false"
+		var store *db.Server
+		store, err = db.New(url, database, username, password, migrate)
+		if err != nil {
+			l.Fatalw("failed to set up database", "err", err)
+		}
+
+		// The Postgres broker lets several instances of the server run
+		// side by side; a single instance can skip the round trips.
+		var broker api.Broker
+		if os.Getenv("QUEUE_BROKER") == "local" {
+			broker = api.NewLocalBroker()
+		} else {
+			broker, err = db.NewBroker(store, l)
+			if err != nil {
+				l.Fatalw("failed to set up broker", "err", err)
+			}
+		}
+
+		registry.MustRegister(sqlstats.NewStatsCollector("queue", store.DB))
+
+		s, err = api.New(store, broker, l, store.DB.DB, provider, config, registry)
+	}
+	if err != nil {
+		l.Fatalw("failed to set up server", "err", err)
+	}
 
 	r := chi.NewRouter()
 	r.Mount("/", s)
@@ -60,3 +102,50 @@ func main() {
 
 	l.Fatalw("http server failed", "err", http.ListenAndServe(":8080", r))
 }
+
+// loginProvider sets up the identity provider users log in with: Google
+// by default, or any OpenID Connect provider with QUEUE_LOGIN_PROVIDER=oidc.
+func loginProvider(l *zap.SugaredLogger, clientSecret string) api.LoginProvider {
+	clientID := os.Getenv("QUEUE_OAUTH2_CLIENT_ID")
+	redirectURL := os.Getenv("QUEUE_OAUTH2_REDIRECT_URI")
+
+	switch p := os.Getenv("QUEUE_LOGIN_PROVIDER"); p {
+	case "", "google":
+		return login.NewGoogle(clientID, clientSecret, redirectURL)
+	case "oidc":
+		scopes := []string{"openid", "email", "profile"}
+		if v := os.Getenv("QUEUE_OIDC_SCOPES"); v != "" {
+			scopes = strings.Fields(v)
+		}
+
+		claims := login.DefaultClaims
+		for env, claim := range map[string]*string{
+			"QUEUE_OIDC_EMAIL_CLAIM":      &claims.Email,
+			"QUEUE_OIDC_NAME_CLAIM":       &claims.Name,
+			"QUEUE_OIDC_GIVEN_NAME_CLAIM": &claims.FirstName,
+			"QUEUE_OIDC_PICTURE_CLAIM":    &claims.Picture,
+		} {
+			if v := os.Getenv(env); v != "" {
+				*claim = v
+			}
+		}
+
+		provider, err := login.NewOIDC(context.Background(), os.Getenv("QUEUE_OIDC_ISSUER"), clientID, clientSecret, redirectURL, scopes, claims)
+		if err != nil {
+			l.Fatalw("failed to set up OpenID Connect login", "err", err)
+		}
+		return provider
+	default:
+		l.Fatalw("unknown login provider", "provider", p)
+		return nil
+	}
+}
+
+func dbConfig(l *zap.SugaredLogger) (url, database, username, password string) {
+	p, err := ioutil.ReadFile(os.Getenv("QUEUE_DB_PASSWORD_FILE"))
+	if err != nil {
+		l.Fatalw("failed to load DB password file", "err", err)
+	}
+
+	return os.Getenv("QUEUE_DB_URL"), os.Getenv("QUEUE_DB_DATABASE"), os.Getenv("QUEUE_DB_USERNAME"), string(p)
+}
@@ -0,0 +1,59 @@
+package memstore
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/segmentio/ksuid"
+)
+
+func (s *Store) CourseAllowsEmail(ctx context.Context, course ksuid.KSUID, email string) (bool, error) {
+	st := getTransaction(ctx)
+	return st.allowedEmails[course][email], nil
+}
+
+func (s *Store) EmailAllowedInAnyCourse(ctx context.Context, email string) (bool, error) {
+	st := getTransaction(ctx)
+	for _, emails := range st.allowedEmails {
+		if emails[email] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *Store) GetAllowedEmails(ctx context.Context, course ksuid.KSUID) ([]string, error) {
+	st := getTransaction(ctx)
+	emails := make([]string, 0)
+	for email := range st.allowedEmails[course] {
+		emails = append(emails, email)
+	}
+	sort.Strings(emails)
+	return emails, nil
+}
+
+func (s *Store) AddAllowedEmails(ctx context.Context, course ksuid.KSUID, emails []string, overwrite bool) error {
+	st := getTransaction(ctx)
+	if _, ok := st.courses[course]; !ok {
+		return fmt.Errorf("course %s doesn't exist", course)
+	}
+
+	existing := st.allowedEmails[course]
+	if overwrite || existing == nil {
+		existing = make(map[string]bool)
+	}
+	for _, email := range emails {
+		existing[email] = true
+	}
+	st.allowedEmails[course] = existing
+	return nil
+}
+
+func (s *Store) RemoveAllowedEmails(ctx context.Context, course ksuid.KSUID, emails []string) error {
+	st := getTransaction(ctx)
+	for _, email := range emails {
+		delete(st.allowedEmails[course], email)
+	}
+	return nil
+}
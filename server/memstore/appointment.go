@@ -0,0 +1,301 @@
+package memstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/CarsonHoffman/office-hours-queue/server/api"
+	"github.com/segmentio/ksuid"
+)
+
+func (s *Store) GetAppointment(ctx context.Context, appointment ksuid.KSUID) (*api.AppointmentSlot, error) {
+	st := getTransaction(ctx)
+	a, ok := st.appointments[appointment]
+	if !ok {
+		return &api.AppointmentSlot{}, sql.ErrNoRows
+	}
+	newAppointment := *a
+	return &newAppointment, nil
+}
+
+// appointmentsBetween returns copies of the appointments on queue with
+// scheduled times in [from, to] that satisfy filter, ordered by ID.
+func (st *state) appointmentsBetween(queue ksuid.KSUID, from, to time.Time, filter func(*api.AppointmentSlot) bool) []*api.AppointmentSlot {
+	appointments := make([]*api.AppointmentSlot, 0)
+	for _, a := range st.appointments {
+		if a.Queue != queue || a.ScheduledTime.Before(from) || a.ScheduledTime.After(to) {
+			continue
+		}
+		if filter != nil && !filter(a) {
+			continue
+		}
+		newAppointment := *a
+		appointments = append(appointments, &newAppointment)
+	}
+
+	sort.Slice(appointments, func(i, j int) bool {
+		return ksuid.Compare(appointments[i].ID, appointments[j].ID) < 0
+	})
+	return appointments
+}
+
+func (s *Store) GetAppointments(ctx context.Context, queue ksuid.KSUID, from, to time.Time) ([]*api.AppointmentSlot, error) {
+	st := getTransaction(ctx)
+	return st.appointmentsBetween(queue, from, to, nil), nil
+}
+
+func (s *Store) GetAppointmentsWithStudent(ctx context.Context, queue ksuid.KSUID, from, to time.Time) ([]*api.AppointmentSlot, error) {
+	st := getTransaction(ctx)
+	appointments := st.appointmentsBetween(queue, from, to, func(a *api.AppointmentSlot) bool {
+		return a.StudentEmail != nil
+	})
+	for i, a := range appointments {
+		appointments[i] = a.Anonymized()
+	}
+	return appointments, nil
+}
+
+func (s *Store) GetAppointmentsForUser(ctx context.Context, queue ksuid.KSUID, from, to time.Time, email string) ([]*api.AppointmentSlot, error) {
+	st := getTransaction(ctx)
+	appointments := st.appointmentsBetween(queue, from, to, func(a *api.AppointmentSlot) bool {
+		return a.StudentEmail != nil && *a.StudentEmail == email
+	})
+	for _, a := range appointments {
+		a.StaffEmail = nil
+	}
+	return appointments, nil
+}
+
+func (s *Store) TeammateHasAppointment(ctx context.Context, queue ksuid.KSUID, from, to time.Time, email string) (bool, error) {
+	st := getTransaction(ctx)
+	teammates := make(map[string]bool)
+	for _, teammate := range st.teammates(queue, email) {
+		teammates[teammate] = true
+	}
+
+	appointments := st.appointmentsBetween(queue, from, to, func(a *api.AppointmentSlot) bool {
+		return a.StudentEmail != nil && teammates[*a.StudentEmail]
+	})
+	return len(appointments) > 0, nil
+}
+
+func (s *Store) GetAppointmentSchedule(ctx context.Context, queue ksuid.KSUID) ([]*api.AppointmentSchedule, error) {
+	st := getTransaction(ctx)
+	var days []int
+	for day := range st.appointmentSchedules[queue] {
+		days = append(days, day)
+	}
+	sort.Ints(days)
+
+	schedules := make([]*api.AppointmentSchedule, 0, len(days))
+	for _, day := range days {
+		schedule := *st.appointmentSchedules[queue][day]
+		schedules = append(schedules, &schedule)
+	}
+	return schedules, nil
+}
+
+func (s *Store) GetAppointmentScheduleForDay(ctx context.Context, queue ksuid.KSUID, day int) (*api.AppointmentSchedule, error) {
+	st := getTransaction(ctx)
+	schedule, ok := st.appointmentSchedules[queue][day]
+	if !ok {
+		return &api.AppointmentSchedule{}, sql.ErrNoRows
+	}
+	newSchedule := *schedule
+	return &newSchedule, nil
+}
+
+func (s *Store) AddAppointmentSchedule(ctx context.Context, queue ksuid.KSUID, day int, schedule *api.AppointmentSchedule) error {
+	st := getTransaction(ctx)
+	days := st.appointmentSchedules[queue]
+	if days == nil {
+		days = make(map[int]*api.AppointmentSchedule)
+		st.appointmentSchedules[queue] = days
+	}
+
+	if _, ok := days[day]; ok {
+		return uniqueViolation("appointment_schedules_pkey")
+	}
+
+	days[day] = &api.AppointmentSchedule{
+		Queue:    queue,
+		Day:      time.Weekday(day),
+		Duration: schedule.Duration,
+		Padding:  schedule.Padding,
+		Schedule: schedule.Schedule,
+	}
+	return nil
+}
+
+func (s *Store) UpdateAppointmentSchedule(ctx context.Context, queue ksuid.KSUID, day int, schedule *api.AppointmentSchedule) error {
+	st := getTransaction(ctx)
+	if existing, ok := st.appointmentSchedules[queue][day]; ok {
+		existing.Duration = schedule.Duration
+		existing.Padding = schedule.Padding
+		existing.Schedule = schedule.Schedule
+	}
+	return nil
+}
+
+func (s *Store) GetAppointmentsByTimeslot(ctx context.Context, queue ksuid.KSUID, from, to time.Time, timeslot int) ([]*api.AppointmentSlot, error) {
+	st := getTransaction(ctx)
+	return st.appointmentsBetween(queue, from, to, func(a *api.AppointmentSlot) bool {
+		return a.Timeslot == timeslot
+	}), nil
+}
+
+func (s *Store) ClaimTimeslot(ctx context.Context, queue ksuid.KSUID, day, timeslot int, email string) (*api.AppointmentSlot, error) {
+	st := getTransaction(ctx)
+	schedule, err := s.GetAppointmentScheduleForDay(ctx, queue, day)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get appointment schedule: %w", err)
+	}
+
+	if timeslot >= len(schedule.Schedule) {
+		return nil, fmt.Errorf("attempted to claim slot %d out of %d slots", timeslot, len(schedule.Schedule))
+	}
+
+	loc := st.queueZone(queue)
+	from, to := api.WeekdayBounds(day, loc)
+	slots, err := s.GetAppointmentsByTimeslot(ctx, queue, from, to, timeslot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get appointment slots: %w", err)
+	}
+
+	// Check if there's an existing slot without a staff member; if so,
+	// prefer taking that one first
+	for _, slot := range slots {
+		if slot.StaffEmail == nil {
+			a := st.appointments[slot.ID]
+			a.StaffEmail = &email
+			newAppointment := *a
+			return &newAppointment, nil
+		}
+	}
+
+	// If we made it here, there aren't any existing slots without a
+	// staff member. Now check if there are any open spots
+	open := int(schedule.Schedule[timeslot]-'0') - len(slots)
+	if open < 1 {
+		return nil, fmt.Errorf("no spots open to claim at timeslot %d", timeslot)
+	}
+
+	// There's room for another appointment at the current timeslot.
+	// Let's claim it.
+	a := &api.AppointmentSlot{
+		ID:            ksuid.New(),
+		Queue:         queue,
+		StaffEmail:    &email,
+		ScheduledTime: api.TimeslotToTime(day, timeslot, schedule.Duration, loc),
+		Timeslot:      timeslot,
+		Duration:      schedule.Duration,
+	}
+	st.appointments[a.ID] = a
+
+	newAppointment := *a
+	return &newAppointment, nil
+}
+
+func (s *Store) UnclaimAppointment(ctx context.Context, appointment ksuid.KSUID) (deleted bool, err error) {
+	st := getTransaction(ctx)
+	a, ok := st.appointments[appointment]
+	if !ok {
+		return false, fmt.Errorf("failed to get appointment: %w", sql.ErrNoRows)
+	}
+
+	// If there's no student associated with this appointment, there's
+	// no point in keeping it around
+	if a.StudentEmail == nil {
+		delete(st.appointments, appointment)
+		return true, nil
+	}
+
+	// If there is a student associated with it, just remove the staff email
+	a.StaffEmail = nil
+	return false, nil
+}
+
+func (s *Store) SignupForAppointment(ctx context.Context, queue ksuid.KSUID, appointment *api.AppointmentSlot) (*api.AppointmentSlot, error) {
+	st := getTransaction(ctx)
+	loc := st.queueZone(queue)
+	start, end := api.WeekdayBounds(int(appointment.ScheduledTime.In(loc).Weekday()), loc)
+	appointments, err := s.GetAppointmentsByTimeslot(ctx, queue, start, end, appointment.Timeslot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get appointments for timeslot: %w", err)
+	}
+
+	// Check if an appointment without a student already exists
+	for _, existing := range appointments {
+		if existing.StudentEmail == nil {
+			a := st.appointments[existing.ID]
+			a.StudentEmail = appointment.StudentEmail
+			a.Name = appointment.Name
+			a.Location = appointment.Location
+			a.Description = appointment.Description
+			a.MapX = appointment.MapX
+			a.MapY = appointment.MapY
+			newAppointment := *a
+			return &newAppointment, nil
+		}
+	}
+
+	// If not, insert a new appointment
+	a := &api.AppointmentSlot{
+		ID:            ksuid.New(),
+		Queue:         appointment.Queue,
+		StudentEmail:  appointment.StudentEmail,
+		ScheduledTime: appointment.ScheduledTime,
+		Timeslot:      appointment.Timeslot,
+		Duration:      appointment.Duration,
+		Name:          appointment.Name,
+		Location:      appointment.Location,
+		Description:   appointment.Description,
+		MapX:          appointment.MapX,
+		MapY:          appointment.MapY,
+	}
+	st.appointments[a.ID] = a
+
+	newAppointment := *a
+	return &newAppointment, nil
+}
+
+func (s *Store) UpdateAppointment(ctx context.Context, appointment ksuid.KSUID, newAppointment *api.AppointmentSlot) error {
+	st := getTransaction(ctx)
+	if a, ok := st.appointments[appointment]; ok {
+		a.Name = newAppointment.Name
+		a.Location = newAppointment.Location
+		a.Description = newAppointment.Description
+		a.MapX = newAppointment.MapX
+		a.MapY = newAppointment.MapY
+	}
+	return nil
+}
+
+func (s *Store) RemoveAppointmentSignup(ctx context.Context, appointment ksuid.KSUID) (deleted bool, newAppointment *api.AppointmentSlot, err error) {
+	st := getTransaction(ctx)
+	a, ok := st.appointments[appointment]
+	if !ok {
+		return false, nil, fmt.Errorf("failed to get appointment: %w", sql.ErrNoRows)
+	}
+
+	// If there's no staff member associated with this appointment, just drop it
+	if a.StaffEmail == nil {
+		delete(st.appointments, appointment)
+		return true, nil, nil
+	}
+
+	// If a staff member has a claim on this appointment, don't delete it,
+	// just set the student fields to null
+	a.StudentEmail = nil
+	a.Name = nil
+	a.Location = nil
+	a.Description = nil
+	a.MapX = nil
+	a.MapY = nil
+
+	newAppt := *a
+	return false, &newAppt, nil
+}
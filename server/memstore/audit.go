@@ -0,0 +1,42 @@
+package memstore
+
+import (
+	"context"
+	"sort"
+
+	"github.com/CarsonHoffman/office-hours-queue/server/api"
+	"github.com/segmentio/ksuid"
+)
+
+func (s *Store) AddAuditLogEntry(ctx context.Context, entry *api.AuditLogEntry) error {
+	st := getTransaction(ctx)
+	e := *entry
+	st.auditLog = append(st.auditLog, &e)
+	return nil
+}
+
+func (s *Store) GetAuditLog(ctx context.Context, filter *api.AuditLogFilter) ([]*api.AuditLogEntry, error) {
+	st := getTransaction(ctx)
+	entries := make([]*api.AuditLogEntry, 0)
+	for _, e := range st.auditLog {
+		if e.Course != filter.Course ||
+			(filter.Queue != nil && (e.Queue == nil || *e.Queue != *filter.Queue)) ||
+			(filter.Actor != "" && e.Actor != filter.Actor) ||
+			(filter.Action != "" && e.Action != filter.Action) ||
+			(filter.Target != "" && e.Target != filter.Target) ||
+			(!filter.Before.IsNil() && ksuid.Compare(e.ID, filter.Before) >= 0) {
+			continue
+		}
+		newEntry := *e
+		entries = append(entries, &newEntry)
+	}
+
+	// ORDER BY id DESC LIMIT $n
+	sort.Slice(entries, func(i, j int) bool {
+		return ksuid.Compare(entries[i].ID, entries[j].ID) > 0
+	})
+	if len(entries) > filter.Limit {
+		entries = entries[:filter.Limit]
+	}
+	return entries, nil
+}
@@ -0,0 +1,200 @@
+package memstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+
+	"github.com/CarsonHoffman/office-hours-queue/server/api"
+	"github.com/segmentio/ksuid"
+)
+
+// activeQueues returns the active queues in course, ordered by ID.
+func (st *state) activeQueues(course ksuid.KSUID) []*api.Queue {
+	var ids []ksuid.KSUID
+	for id, q := range st.queues {
+		if q.Active && q.Course == course {
+			ids = append(ids, id)
+		}
+	}
+	sortByID(ids)
+
+	queues := make([]*api.Queue, 0, len(ids))
+	for _, id := range ids {
+		queues = append(queues, st.queue(st.queues[id]))
+	}
+	return queues
+}
+
+func (s *Store) GetCourses(ctx context.Context) ([]*api.Course, error) {
+	st := getTransaction(ctx)
+	var ids []ksuid.KSUID
+	for id := range st.courses {
+		ids = append(ids, id)
+	}
+	sortByID(ids)
+
+	courses := make([]*api.Course, 0, len(ids))
+	for _, id := range ids {
+		c := *st.courses[id]
+		c.Queues = st.activeQueues(id)
+		courses = append(courses, &c)
+	}
+	return courses, nil
+}
+
+func (s *Store) GetCourse(ctx context.Context, id ksuid.KSUID) (*api.Course, error) {
+	st := getTransaction(ctx)
+	c, ok := st.courses[id]
+	if !ok {
+		return &api.Course{}, sql.ErrNoRows
+	}
+	course := *c
+	return &course, nil
+}
+
+func (s *Store) GetCourseRoles(ctx context.Context, email string) (map[string]api.CourseRole, error) {
+	st := getTransaction(ctx)
+	roles := make(map[string]api.CourseRole)
+
+	// Check if user is site admin; if so, they are instructor for all courses
+	if st.siteAdmins[email] {
+		for id := range st.courses {
+			roles[id.String()] = api.RoleInstructor
+		}
+	} else {
+		for id, admins := range st.courseAdmins {
+			if role, ok := admins[email]; ok {
+				roles[id.String()] = role
+			}
+		}
+	}
+
+	return roles, nil
+}
+
+func (s *Store) GetQueues(ctx context.Context, course ksuid.KSUID) ([]*api.Queue, error) {
+	st := getTransaction(ctx)
+	return st.activeQueues(course), nil
+}
+
+func (s *Store) CourseRole(ctx context.Context, course ksuid.KSUID, email string) (api.CourseRole, error) {
+	st := getTransaction(ctx)
+	if st.siteAdmins[email] {
+		return api.RoleInstructor, nil
+	}
+	return st.courseAdmins[course][email], nil
+}
+
+func (s *Store) AddCourse(ctx context.Context, shortName, fullName, timeZone string) (*api.Course, error) {
+	st := getTransaction(ctx)
+	course := &api.Course{
+		ID:        ksuid.New(),
+		ShortName: shortName,
+		FullName:  fullName,
+		TimeZone:  timeZone,
+	}
+	st.courses[course.ID] = course
+
+	c := *course
+	return &c, nil
+}
+
+func (s *Store) UpdateCourse(ctx context.Context, course ksuid.KSUID, shortName, fullName, timeZone string) error {
+	st := getTransaction(ctx)
+	c, ok := st.courses[course]
+	if !ok {
+		return nil
+	}
+	c.ShortName = shortName
+	c.FullName = fullName
+	c.TimeZone = timeZone
+	return nil
+}
+
+func (s *Store) DeleteCourse(ctx context.Context, course ksuid.KSUID) error {
+	st := getTransaction(ctx)
+	delete(st.courses, course)
+	delete(st.courseAdmins, course)
+	delete(st.allowedEmails, course)
+	for id, t := range st.apiTokens {
+		if t.Course != nil && *t.Course == course {
+			delete(st.apiTokens, id)
+		}
+	}
+	for id, q := range st.queues {
+		if q.Course == course {
+			st.deleteQueue(id)
+		}
+	}
+	return nil
+}
+
+func (s *Store) AddQueue(ctx context.Context, course ksuid.KSUID, queue *api.Queue) (*api.Queue, error) {
+	st := getTransaction(ctx)
+	if _, ok := st.courses[course]; !ok {
+		return nil, fmt.Errorf("course %s doesn't exist", course)
+	}
+
+	q := &queueRow{
+		Queue: api.Queue{
+			ID:       ksuid.New(),
+			Course:   course,
+			Type:     queue.Type,
+			Name:     queue.Name,
+			Location: queue.Location,
+			Map:      queue.Map,
+			Active:   true,
+		},
+	}
+	// Column defaults from the queues table
+	q.config.ID = q.ID
+	q.config.EnableLocationField = true
+	q.config.EndOfSession = api.EndOfSessionKeep
+	st.queues[q.ID] = q
+
+	return st.queue(q), nil
+}
+
+func (s *Store) GetCourseAdmins(ctx context.Context, course ksuid.KSUID) ([]*api.CourseAdmin, error) {
+	st := getTransaction(ctx)
+	admins := make([]*api.CourseAdmin, 0)
+	for email, role := range st.courseAdmins[course] {
+		admins = append(admins, &api.CourseAdmin{Email: email, Role: role})
+	}
+	sort.Slice(admins, func(i, j int) bool {
+		return admins[i].Email < admins[j].Email
+	})
+	return admins, nil
+}
+
+func (s *Store) AddCourseAdmins(ctx context.Context, course ksuid.KSUID, admins []*api.CourseAdmin, overwrite bool) error {
+	st := getTransaction(ctx)
+	if _, ok := st.courses[course]; !ok {
+		return fmt.Errorf("course %s doesn't exist", course)
+	}
+
+	existing := st.courseAdmins[course]
+	if overwrite || existing == nil {
+		existing = make(map[string]api.CourseRole)
+	}
+
+	for _, admin := range admins {
+		if _, ok := existing[admin.Email]; ok {
+			return fmt.Errorf("failed to insert %s into course %s admins: %w", admin.Email, course, uniqueViolation("course_admins_pkey"))
+		}
+		existing[admin.Email] = admin.Role
+	}
+
+	st.courseAdmins[course] = existing
+	return nil
+}
+
+func (s *Store) RemoveCourseAdmins(ctx context.Context, course ksuid.KSUID, admins []string) error {
+	st := getTransaction(ctx)
+	for _, email := range admins {
+		delete(st.courseAdmins[course], email)
+	}
+	return nil
+}
@@ -0,0 +1,813 @@
+package memstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/CarsonHoffman/office-hours-queue/server/api"
+	"github.com/segmentio/ksuid"
+)
+
+// deleteQueue removes a queue along with everything that references it,
+// like the ON DELETE CASCADE foreign keys do.
+func (st *state) deleteQueue(queue ksuid.KSUID) {
+	delete(st.queues, queue)
+	delete(st.schedules, queue)
+	delete(st.scheduleOverrides, queue)
+	delete(st.roster, queue)
+	delete(st.groups, queue)
+	delete(st.appointmentSchedules, queue)
+	for id, e := range st.entries {
+		if e.Queue == queue {
+			delete(st.entries, id)
+		}
+	}
+	for id, a := range st.announcements {
+		if a.Queue == queue {
+			delete(st.announcements, id)
+		}
+	}
+	for id, m := range st.messages {
+		if m.Queue == queue {
+			delete(st.messages, id)
+		}
+	}
+	for id, a := range st.appointments {
+		if a.Queue == queue {
+			delete(st.appointments, id)
+		}
+	}
+}
+
+// queue copies the queue out of q, along with its course's time zone
+// (which the database joins in).
+func (st *state) queue(q *queueRow) *api.Queue {
+	newQueue := q.Queue
+	if c, ok := st.courses[q.Course]; ok {
+		newQueue.TimeZone = c.TimeZone
+	}
+	return &newQueue
+}
+
+// queueZone gets the time zone of the queue's course.
+func (st *state) queueZone(queue ksuid.KSUID) *time.Location {
+	q, ok := st.queues[queue]
+	if !ok {
+		return time.Local
+	}
+	return st.queue(q).Zone()
+}
+
+func (s *Store) GetQueue(ctx context.Context, queue ksuid.KSUID) (*api.Queue, error) {
+	st := getTransaction(ctx)
+	q, ok := st.queues[queue]
+	if !ok || !q.Active {
+		return &api.Queue{}, sql.ErrNoRows
+	}
+	return st.queue(q), nil
+}
+
+func (s *Store) UpdateQueue(ctx context.Context, queue ksuid.KSUID, values *api.Queue) error {
+	st := getTransaction(ctx)
+	if q, ok := st.queues[queue]; ok {
+		q.Name = values.Name
+		q.Location = values.Location
+	}
+	return nil
+}
+
+func (s *Store) RemoveQueue(ctx context.Context, queue ksuid.KSUID) error {
+	st := getTransaction(ctx)
+	st.deleteQueue(queue)
+	return nil
+}
+
+func (s *Store) GetCurrentDaySchedule(ctx context.Context, queue ksuid.KSUID) (api.DaySchedule, error) {
+	st := getTransaction(ctx)
+	loc := st.queueZone(queue)
+	schedule, ok := st.schedules[queue][api.CurrentWeekday(loc)]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	if override, ok := st.scheduleOverrides[queue][api.CurrentDate(loc)]; ok {
+		return copySchedule(override.Intervals), nil
+	}
+	return copySchedule(schedule), nil
+}
+
+func (s *Store) GetQueueEntry(ctx context.Context, entry ksuid.KSUID, allowRemoved bool) (*api.QueueEntry, error) {
+	st := getTransaction(ctx)
+	e, ok := st.entries[entry]
+	if !ok || (!allowRemoved && !e.Active.Valid) {
+		return &api.QueueEntry{}, sql.ErrNoRows
+	}
+	newEntry := *e
+	return &newEntry, nil
+}
+
+// activeEntries returns the active entries on queue in queue order.
+func (st *state) activeEntries(queue ksuid.KSUID) []*api.QueueEntry {
+	entries := make([]*api.QueueEntry, 0)
+	for _, e := range st.entries {
+		if e.Queue == queue && e.Active.Valid {
+			entries = append(entries, e)
+		}
+	}
+
+	// ORDER BY pinned DESC, priority DESC, id
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.Pinned != b.Pinned {
+			return a.Pinned
+		}
+		if a.Priority != b.Priority {
+			return a.Priority > b.Priority
+		}
+		return ksuid.Compare(a.ID, b.ID) < 0
+	})
+	return entries
+}
+
+func (s *Store) GetQueueEntries(ctx context.Context, queue ksuid.KSUID, admin bool) ([]*api.QueueEntry, error) {
+	st := getTransaction(ctx)
+	entries := make([]*api.QueueEntry, 0)
+	for _, e := range st.activeEntries(queue) {
+		if admin {
+			newEntry := *e
+			entries = append(entries, &newEntry)
+			continue
+		}
+
+		// Only the columns the non-admin query selects
+		entries = append(entries, &api.QueueEntry{
+			ID:       e.ID,
+			Queue:    e.Queue,
+			Priority: e.Priority,
+			Pinned:   e.Pinned,
+			Helping:  e.Helping,
+		})
+	}
+	return entries, nil
+}
+
+func (st *state) activeEntriesForUser(queue ksuid.KSUID, email string) []*api.QueueEntry {
+	entries := make([]*api.QueueEntry, 0)
+	for _, e := range st.entries {
+		if e.Queue == queue && e.Email == email && e.Active.Valid {
+			newEntry := *e
+			entries = append(entries, &newEntry)
+		}
+	}
+	return entries
+}
+
+func (s *Store) GetActiveQueueEntriesForUser(ctx context.Context, queue ksuid.KSUID, email string) ([]*api.QueueEntry, error) {
+	st := getTransaction(ctx)
+	return st.activeEntriesForUser(queue, email), nil
+}
+
+func (s *Store) GetQueueConfiguration(ctx context.Context, queue ksuid.KSUID) (*api.QueueConfiguration, error) {
+	st := getTransaction(ctx)
+	q, ok := st.queues[queue]
+	if !ok {
+		return &api.QueueConfiguration{}, sql.ErrNoRows
+	}
+	config := q.config
+	return &config, nil
+}
+
+func (s *Store) UpdateQueueConfiguration(ctx context.Context, queue ksuid.KSUID, config *api.QueueConfiguration) error {
+	st := getTransaction(ctx)
+	q, ok := st.queues[queue]
+	if !ok {
+		return nil
+	}
+
+	// Everything but the ID and manual open status, which has its own endpoint
+	manualOpen := q.config.ManualOpen
+	q.config = *config
+	q.config.ID = queue
+	q.config.ManualOpen = manualOpen
+	q.scheduledOpen = nil
+	return nil
+}
+
+func (s *Store) GetScheduledQueues(ctx context.Context) ([]*api.Queue, error) {
+	st := getTransaction(ctx)
+	var ids []ksuid.KSUID
+	for id, q := range st.queues {
+		if q.Active && q.Type == api.Ordered && q.config.Scheduled {
+			ids = append(ids, id)
+		}
+	}
+	ksuid.Sort(ids)
+
+	queues := make([]*api.Queue, 0, len(ids))
+	for _, id := range ids {
+		queues = append(queues, st.queue(st.queues[id]))
+	}
+	return queues, nil
+}
+
+func (s *Store) SetScheduledOpen(ctx context.Context, queue ksuid.KSUID, open bool) (*bool, error) {
+	st := getTransaction(ctx)
+	q, ok := st.queues[queue]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	was := q.scheduledOpen
+	q.scheduledOpen = &open
+	return was, nil
+}
+
+// forgetScheduledOpen mirrors resetting scheduled_open to NULL when the
+// queue's schedule changes.
+func (st *state) forgetScheduledOpen(queue ksuid.KSUID) {
+	if q, ok := st.queues[queue]; ok {
+		q.scheduledOpen = nil
+	}
+}
+
+func (s *Store) UpdateQueueOpenStatus(ctx context.Context, queue ksuid.KSUID, open bool) error {
+	st := getTransaction(ctx)
+	if q, ok := st.queues[queue]; ok {
+		q.config.ManualOpen = open
+	}
+	return nil
+}
+
+func (s *Store) GetQueueRoster(ctx context.Context, queue ksuid.KSUID) ([]string, error) {
+	st := getTransaction(ctx)
+	roster := make([]string, 0)
+	for email := range st.roster[queue] {
+		roster = append(roster, email)
+	}
+	sort.Strings(roster)
+	return roster, nil
+}
+
+func (s *Store) GetQueueGroups(ctx context.Context, queue ksuid.KSUID) ([][]string, error) {
+	st := getTransaction(ctx)
+	members := make(map[ksuid.KSUID][]string)
+	var groupIDs []ksuid.KSUID
+	for email, group := range st.groups[queue] {
+		if _, ok := members[group]; !ok {
+			groupIDs = append(groupIDs, group)
+		}
+		members[group] = append(members[group], email)
+	}
+	sortByID(groupIDs)
+
+	groups := make([][]string, 0, len(groupIDs))
+	for _, id := range groupIDs {
+		sort.Strings(members[id])
+		groups = append(groups, members[id])
+	}
+	return groups, nil
+}
+
+func (s *Store) UpdateQueueGroups(ctx context.Context, queue ksuid.KSUID, groups [][]string) error {
+	st := getTransaction(ctx)
+	newGroups := make(map[string]ksuid.KSUID)
+	for _, group := range groups {
+		groupID := ksuid.New()
+		for _, student := range group {
+			if _, ok := newGroups[student]; ok {
+				return fmt.Errorf("failed to insert student %s into group %s: %w", student, groupID, uniqueViolation("one_group_per_student_per_queue"))
+			}
+			newGroups[student] = groupID
+		}
+	}
+
+	st.groups[queue] = newGroups
+	return nil
+}
+
+func (s *Store) UserInQueueRoster(ctx context.Context, queue ksuid.KSUID, email string) (bool, error) {
+	st := getTransaction(ctx)
+	return st.roster[queue][email], nil
+}
+
+func (s *Store) UpdateQueueRoster(ctx context.Context, queue ksuid.KSUID, students []string) error {
+	st := getTransaction(ctx)
+	roster := make(map[string]bool)
+	for _, student := range students {
+		if roster[student] {
+			return fmt.Errorf("failed to insert student %s into roster: %w", student, uniqueViolation("roster_pkey"))
+		}
+		roster[student] = true
+	}
+
+	st.roster[queue] = roster
+	return nil
+}
+
+// teammates mirrors the teammates view: everyone in email's group on
+// queue, excluding email.
+func (st *state) teammates(queue ksuid.KSUID, email string) []string {
+	group, ok := st.groups[queue][email]
+	if !ok {
+		return nil
+	}
+
+	var teammates []string
+	for other, otherGroup := range st.groups[queue] {
+		if otherGroup == group && other != email {
+			teammates = append(teammates, other)
+		}
+	}
+	return teammates
+}
+
+func (s *Store) TeammateInQueue(ctx context.Context, queue ksuid.KSUID, email string) (bool, error) {
+	st := getTransaction(ctx)
+	for _, teammate := range st.teammates(queue, email) {
+		if len(st.activeEntriesForUser(queue, teammate)) > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// helpedBySomeoneElse matches removed_by!=email AND helped: the entry
+// was taken off the queue by a staff member who actually helped them.
+func helpedBySomeoneElse(e *api.QueueEntry) bool {
+	return e.RemovedBy.Valid && e.RemovedBy.String != e.Email && e.Helped
+}
+
+func (s *Store) LastHelpedTime(ctx context.Context, queue ksuid.KSUID, email string) (sql.NullTime, error) {
+	st := getTransaction(ctx)
+	var t sql.NullTime
+	for _, e := range st.entries {
+		if e.Queue != queue || e.Email != email || e.Active.Valid || !helpedBySomeoneElse(e) {
+			continue
+		}
+		if e.RemovedAt.Valid && (!t.Valid || e.RemovedAt.Time.After(t.Time)) {
+			t = e.RemovedAt
+		}
+	}
+	return t, nil
+}
+
+func (s *Store) GetEntryPriority(ctx context.Context, queue ksuid.KSUID, email string) (int, error) {
+	st := getTransaction(ctx)
+	config, err := s.GetQueueConfiguration(ctx, queue)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get queue configuration: %w", err)
+	}
+
+	if !config.PrioritizeNew {
+		return 0, nil
+	}
+
+	loc := st.queueZone(queue)
+	start, _ := api.WeekdayBounds(api.CurrentWeekday(loc), loc)
+	var payload [16]byte
+	firstIDOfDay, err := ksuid.FromParts(start, payload[:])
+	if err != nil {
+		return 0, fmt.Errorf("failed to generate first KSUID of day: %w", err)
+	}
+
+	helpedToday := func(email string) bool {
+		for _, e := range st.entries {
+			if e.Queue == queue && e.Email == email && ksuid.Compare(e.ID, firstIDOfDay) >= 0 && helpedBySomeoneElse(e) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if helpedToday(email) {
+		return 0, nil
+	}
+
+	if !config.PreventGroupsBoost {
+		return 1, nil
+	}
+
+	for _, teammate := range st.teammates(queue, email) {
+		if helpedToday(teammate) {
+			return 0, nil
+		}
+	}
+	return 1, nil
+}
+
+func (s *Store) AddQueueEntry(ctx context.Context, e *api.QueueEntry) (*api.QueueEntry, error) {
+	st := getTransaction(ctx)
+	if _, ok := st.queues[e.Queue]; !ok {
+		return nil, fmt.Errorf("queue %s doesn't exist", e.Queue)
+	}
+
+	if len(st.activeEntriesForUser(e.Queue, e.Email)) > 0 {
+		return nil, uniqueViolation("one_active_entry_per_student_per_queue")
+	}
+
+	entry := &api.QueueEntry{
+		ID:          ksuid.New(),
+		Queue:       e.Queue,
+		Email:       e.Email,
+		Name:        e.Name,
+		Description: e.Description,
+		Location:    e.Location,
+		MapX:        e.MapX,
+		MapY:        e.MapY,
+		Priority:    e.Priority,
+		Active:      sql.NullBool{Bool: true, Valid: true},
+		Helped:      true,
+	}
+	st.entries[entry.ID] = entry
+
+	newEntry := *entry
+	return &newEntry, nil
+}
+
+func (s *Store) UpdateQueueEntry(ctx context.Context, entry ksuid.KSUID, e *api.QueueEntry) error {
+	st := getTransaction(ctx)
+	existing, ok := st.entries[entry]
+	if !ok || !existing.Active.Valid {
+		return nil
+	}
+
+	existing.Name = e.Name
+	existing.Location = e.Location
+	existing.Description = e.Description
+	existing.MapX = e.MapX
+	existing.MapY = e.MapY
+	return nil
+}
+
+func (s *Store) CanRemoveQueueEntry(ctx context.Context, queue ksuid.KSUID, entry ksuid.KSUID, email string) (bool, error) {
+	st := getTransaction(ctx)
+	q, err := s.GetQueue(ctx, queue)
+	if err != nil {
+		return false, fmt.Errorf("failed to get queue: %w", err)
+	}
+
+	role, err := s.CourseRole(ctx, q.Course, email)
+	if err != nil {
+		return false, fmt.Errorf("failed to determine role in course: %w", err)
+	}
+
+	if role.AtLeast(api.RoleTA) {
+		return true, nil
+	}
+
+	e, ok := st.entries[entry]
+	return ok && e.Email == email, nil
+}
+
+// removedEntry converts an entry to the shape of SELECT * scanned
+// into an api.RemovedQueueEntry.
+func removedEntry(e *api.QueueEntry) *api.RemovedQueueEntry {
+	return &api.RemovedQueueEntry{
+		ID:          e.ID,
+		Queue:       e.Queue,
+		Email:       e.Email,
+		Name:        e.Name,
+		Description: e.Description,
+		Location:    e.Location,
+		MapX:        e.MapX,
+		MapY:        e.MapY,
+		Priority:    e.Priority,
+		Pinned:      e.Pinned,
+		Active:      e.Active,
+		RemovedBy:   e.RemovedBy.String,
+		RemovedAt:   e.RemovedAt.Time,
+		Helped:      e.Helped,
+		Helping:     e.Helping,
+
+		HelpingBy:    e.HelpingBy,
+		HelpingName:  e.HelpingName,
+		HelpingSince: e.HelpingSince,
+	}
+}
+
+func (st *state) remove(entry *api.QueueEntry, remover string, helped bool) {
+	entry.Pinned = false
+	entry.Active = sql.NullBool{}
+	entry.RemovedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	entry.RemovedBy = sql.NullString{String: remover, Valid: true}
+	entry.Helped = helped
+}
+
+func (s *Store) RemoveQueueEntry(ctx context.Context, entry ksuid.KSUID, remover string) (*api.RemovedQueueEntry, error) {
+	st := getTransaction(ctx)
+	e, ok := st.entries[entry]
+	if !ok || !e.Active.Valid {
+		return &api.RemovedQueueEntry{}, sql.ErrNoRows
+	}
+
+	st.remove(e, remover, true)
+	return removedEntry(e), nil
+}
+
+func (s *Store) PinQueueEntry(ctx context.Context, entry ksuid.KSUID) error {
+	st := getTransaction(ctx)
+	e, ok := st.entries[entry]
+	if !ok {
+		return nil
+	}
+
+	if !e.Active.Valid {
+		for _, other := range st.activeEntriesForUser(e.Queue, e.Email) {
+			if other.ID != e.ID {
+				return uniqueViolation("one_active_entry_per_student_per_queue")
+			}
+		}
+	}
+
+	e.Active = sql.NullBool{Bool: true, Valid: true}
+	e.RemovedAt = sql.NullTime{}
+	e.RemovedBy = sql.NullString{}
+	e.Helped = false
+	e.Pinned = true
+	return nil
+}
+
+func (s *Store) SetQueueEntryHelping(ctx context.Context, entry ksuid.KSUID, helping bool, helper, helperName string) error {
+	st := getTransaction(ctx)
+	e, ok := st.entries[entry]
+	if !ok {
+		return nil
+	}
+
+	if !helping {
+		e.Helping = false
+		e.HelpingBy = nil
+		e.HelpingName = nil
+		e.HelpingSince = nil
+		return nil
+	}
+
+	if !e.Helping || e.HelpingBy == nil || *e.HelpingBy != helper || e.HelpingSince == nil {
+		now := time.Now()
+		e.HelpingSince = &now
+	}
+	e.Helping = true
+	e.HelpingBy = &helper
+	e.HelpingName = &helperName
+	return nil
+}
+
+func (s *Store) SetHelpedStatus(ctx context.Context, entry ksuid.KSUID, helped bool) error {
+	st := getTransaction(ctx)
+	if e, ok := st.entries[entry]; ok {
+		e.Helped = helped
+	}
+	return nil
+}
+
+func (s *Store) RandomizeQueueEntries(ctx context.Context, queue ksuid.KSUID) error {
+	st := getTransaction(ctx)
+	for _, e := range st.activeEntries(queue) {
+		e.Priority = rand.Intn(10) + 1
+	}
+	return nil
+}
+
+func (s *Store) ClearQueueEntries(ctx context.Context, queue ksuid.KSUID, remover string) error {
+	st := getTransaction(ctx)
+	for _, e := range st.activeEntries(queue) {
+		st.remove(e, remover, false)
+	}
+	return nil
+}
+
+func (s *Store) BoostQueueEntries(ctx context.Context, queue ksuid.KSUID, boost int) error {
+	st := getTransaction(ctx)
+	for _, e := range st.activeEntries(queue) {
+		e.Priority += boost
+	}
+	return nil
+}
+
+func (s *Store) GetQueueStack(ctx context.Context, queue ksuid.KSUID, limit int) ([]*api.RemovedQueueEntry, error) {
+	st := getTransaction(ctx)
+	entries := make([]*api.RemovedQueueEntry, 0)
+	for _, e := range st.entries {
+		if e.Queue == queue && !e.Active.Valid {
+			entries = append(entries, removedEntry(e))
+		}
+	}
+
+	// ORDER BY removed_at DESC, id DESC
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if !a.RemovedAt.Equal(b.RemovedAt) {
+			return a.RemovedAt.After(b.RemovedAt)
+		}
+		return ksuid.Compare(a.ID, b.ID) > 0
+	})
+
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries, nil
+}
+
+func (s *Store) GetRemovedQueueEntries(ctx context.Context, queue ksuid.KSUID, from, to time.Time) ([]*api.RemovedQueueEntry, error) {
+	st := getTransaction(ctx)
+	entries := make([]*api.RemovedQueueEntry, 0)
+	for _, e := range st.entries {
+		created := e.ID.Time()
+		if e.Queue != queue || e.Active.Valid || created.Before(from) || !created.Before(to) {
+			continue
+		}
+		entries = append(entries, removedEntry(e))
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return ksuid.Compare(entries[i].ID, entries[j].ID) < 0
+	})
+	return entries, nil
+}
+
+func (s *Store) ExportQueueEntries(ctx context.Context, queue ksuid.KSUID, from, to time.Time, f func(*api.QueueEntry) error) error {
+	st := getTransaction(ctx)
+	var entries []*api.QueueEntry
+	for _, e := range st.entries {
+		created := e.ID.Time()
+		if e.Queue != queue || created.Before(from) || !created.Before(to) {
+			continue
+		}
+		newEntry := *e
+		entries = append(entries, &newEntry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return ksuid.Compare(entries[i].ID, entries[j].ID) < 0
+	})
+	for _, e := range entries {
+		err := f(e)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) GetHelpThroughput(ctx context.Context, queue ksuid.KSUID, since time.Time) (*api.HelpThroughput, error) {
+	st := getTransaction(ctx)
+	var t api.HelpThroughput
+	helpers := make(map[string]bool)
+	for _, e := range st.entries {
+		if e.Queue != queue || !helpedBySomeoneElse(e) || e.RemovedAt.Time.Before(since) {
+			continue
+		}
+
+		t.Helped++
+		helpers[e.RemovedBy.String] = true
+		if !t.First.Valid || e.RemovedAt.Time.Before(t.First.Time) {
+			t.First = e.RemovedAt
+		}
+	}
+	t.Helpers = len(helpers)
+	return &t, nil
+}
+
+func (s *Store) GetQueueAnnouncements(ctx context.Context, queue ksuid.KSUID) ([]*api.Announcement, error) {
+	st := getTransaction(ctx)
+	var ids []ksuid.KSUID
+	for id, a := range st.announcements {
+		if a.Queue == queue {
+			ids = append(ids, id)
+		}
+	}
+	sortByID(ids)
+
+	announcements := make([]*api.Announcement, 0, len(ids))
+	for _, id := range ids {
+		a := *st.announcements[id]
+		announcements = append(announcements, &a)
+	}
+	return announcements, nil
+}
+
+func (s *Store) AddQueueAnnouncement(ctx context.Context, queue ksuid.KSUID, announcement *api.Announcement) (*api.Announcement, error) {
+	st := getTransaction(ctx)
+	a := &api.Announcement{
+		ID:      ksuid.New(),
+		Queue:   announcement.Queue,
+		Content: announcement.Content,
+	}
+	st.announcements[a.ID] = a
+
+	newAnnouncement := *a
+	return &newAnnouncement, nil
+}
+
+func (s *Store) RemoveQueueAnnouncement(ctx context.Context, announcement ksuid.KSUID) error {
+	st := getTransaction(ctx)
+	delete(st.announcements, announcement)
+	return nil
+}
+
+func (s *Store) GetQueueSchedule(ctx context.Context, queue ksuid.KSUID) ([]api.DaySchedule, error) {
+	st := getTransaction(ctx)
+	var days []int
+	for day := range st.schedules[queue] {
+		days = append(days, day)
+	}
+	sort.Ints(days)
+
+	schedules := make([]api.DaySchedule, 0, len(days))
+	for _, day := range days {
+		schedules = append(schedules, copySchedule(st.schedules[queue][day]))
+	}
+	return schedules, nil
+}
+
+func (s *Store) AddQueueSchedule(ctx context.Context, queue ksuid.KSUID, day int, schedule api.DaySchedule) error {
+	st := getTransaction(ctx)
+	days := st.schedules[queue]
+	if days == nil {
+		days = make(map[int]api.DaySchedule)
+		st.schedules[queue] = days
+	}
+
+	if _, ok := days[day]; ok {
+		return uniqueViolation("schedules_pkey")
+	}
+	days[day] = copySchedule(schedule)
+	return nil
+}
+
+func (s *Store) UpdateQueueSchedule(ctx context.Context, queue ksuid.KSUID, schedules []api.DaySchedule) error {
+	st := getTransaction(ctx)
+	for i, schedule := range schedules {
+		if _, ok := st.schedules[queue][i]; ok {
+			st.schedules[queue][i] = copySchedule(schedule)
+		}
+	}
+	st.forgetScheduledOpen(queue)
+	return nil
+}
+
+func (s *Store) SendMessage(ctx context.Context, queue ksuid.KSUID, content, sender, receiver string) (*api.Message, error) {
+	st := getTransaction(ctx)
+	m := &api.Message{
+		ID:       ksuid.New(),
+		Queue:    queue,
+		Content:  content,
+		Sender:   sender,
+		Receiver: receiver,
+	}
+	st.messages[m.ID] = m
+
+	message := *m
+	return &message, nil
+}
+
+func (s *Store) ViewMessage(ctx context.Context, queue ksuid.KSUID, receiver string) (*api.Message, error) {
+	st := getTransaction(ctx)
+	var first *api.Message
+	for _, m := range st.messages {
+		if m.Queue == queue && m.Receiver == receiver && (first == nil || ksuid.Compare(m.ID, first.ID) < 0) {
+			first = m
+		}
+	}
+
+	if first == nil {
+		return &api.Message{}, sql.ErrNoRows
+	}
+
+	delete(st.messages, first.ID)
+	return first, nil
+}
+
+func (s *Store) QueueStats() ([]api.QueueStats, error) {
+	var queues []api.QueueStats
+	s.locked(func(st *state) {
+		now := time.Now()
+		for _, q := range st.queues {
+			if !q.Active {
+				continue
+			}
+
+			stats := api.QueueStats{
+				Queue:  q.ID.String(),
+				Course: q.Course.String(),
+				Type:   q.Type,
+			}
+			switch q.Type {
+			case api.Ordered:
+				stats.Students = len(st.activeEntries(q.ID))
+			case api.Appointments:
+				for _, a := range st.appointments {
+					if a.Queue == q.ID && a.StudentEmail != nil && !a.ScheduledTime.Before(now) {
+						stats.Students++
+					}
+				}
+			default:
+				continue
+			}
+			queues = append(queues, stats)
+		}
+	})
+	return queues, nil
+}
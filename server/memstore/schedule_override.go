@@ -0,0 +1,58 @@
+package memstore
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+
+	"github.com/CarsonHoffman/office-hours-queue/server/api"
+	"github.com/segmentio/ksuid"
+)
+
+func (s *Store) GetScheduleOverrides(ctx context.Context, queue ksuid.KSUID, from string) ([]*api.ScheduleOverride, error) {
+	st := getTransaction(ctx)
+	overrides := make([]*api.ScheduleOverride, 0)
+	for date, o := range st.scheduleOverrides[queue] {
+		if date >= from {
+			override := *o
+			override.Intervals = copySchedule(o.Intervals)
+			overrides = append(overrides, &override)
+		}
+	}
+	sort.Slice(overrides, func(i, j int) bool {
+		return overrides[i].Date < overrides[j].Date
+	})
+	return overrides, nil
+}
+
+func (s *Store) GetScheduleOverride(ctx context.Context, queue ksuid.KSUID, date string) (*api.ScheduleOverride, error) {
+	st := getTransaction(ctx)
+	o, ok := st.scheduleOverrides[queue][date]
+	if !ok {
+		return &api.ScheduleOverride{}, sql.ErrNoRows
+	}
+	override := *o
+	override.Intervals = copySchedule(o.Intervals)
+	return &override, nil
+}
+
+func (s *Store) SetScheduleOverride(ctx context.Context, override *api.ScheduleOverride) error {
+	st := getTransaction(ctx)
+	dates := st.scheduleOverrides[override.Queue]
+	if dates == nil {
+		dates = make(map[string]*api.ScheduleOverride)
+		st.scheduleOverrides[override.Queue] = dates
+	}
+	o := *override
+	o.Intervals = copySchedule(override.Intervals)
+	dates[o.Date] = &o
+	st.forgetScheduledOpen(override.Queue)
+	return nil
+}
+
+func (s *Store) RemoveScheduleOverride(ctx context.Context, queue ksuid.KSUID, date string) error {
+	st := getTransaction(ctx)
+	delete(st.scheduleOverrides[queue], date)
+	st.forgetScheduledOpen(queue)
+	return nil
+}
@@ -0,0 +1,258 @@
+// Package memstore is an in-memory implementation of the queue's backing
+// store. It mirrors the behavior of the SQL in the db package closely
+// enough that the API can be run (and its handlers exercised through
+// httptest) without a Postgres instance, which makes it handy for tests
+// and local development. Nothing is persisted across restarts.
+package memstore
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"sync"
+
+	"github.com/CarsonHoffman/office-hours-queue/server/api"
+	"github.com/lib/pq"
+	"github.com/segmentio/ksuid"
+)
+
+type queueRow struct {
+	api.Queue
+	config api.QueueConfiguration
+
+	// Whether the scheduler last saw the queue open, if it's looked.
+	scheduledOpen *bool
+}
+
+// state holds every "table" in the store. Each transaction works on its
+// own deep copy, which replaces the committed state on commit.
+type state struct {
+	siteAdmins           map[string]bool
+	courses              map[ksuid.KSUID]*api.Course
+	courseAdmins         map[ksuid.KSUID]map[string]api.CourseRole
+	allowedEmails        map[ksuid.KSUID]map[string]bool
+	queues               map[ksuid.KSUID]*queueRow
+	schedules            map[ksuid.KSUID]map[int]api.DaySchedule
+	scheduleOverrides    map[ksuid.KSUID]map[string]*api.ScheduleOverride
+	entries              map[ksuid.KSUID]*api.QueueEntry
+	announcements        map[ksuid.KSUID]*api.Announcement
+	messages             map[ksuid.KSUID]*api.Message
+	roster               map[ksuid.KSUID]map[string]bool
+	groups               map[ksuid.KSUID]map[string]ksuid.KSUID
+	appointmentSchedules map[ksuid.KSUID]map[int]*api.AppointmentSchedule
+	appointments         map[ksuid.KSUID]*api.AppointmentSlot
+	apiTokens            map[ksuid.KSUID]*apiTokenRow
+	userSessions         map[ksuid.KSUID]*api.UserSession
+
+	// Entries are never changed once they're added, so they're shared
+	// between copies.
+	auditLog []*api.AuditLogEntry
+}
+
+func newState() *state {
+	return &state{
+		siteAdmins:           make(map[string]bool),
+		courses:              make(map[ksuid.KSUID]*api.Course),
+		courseAdmins:         make(map[ksuid.KSUID]map[string]api.CourseRole),
+		allowedEmails:        make(map[ksuid.KSUID]map[string]bool),
+		queues:               make(map[ksuid.KSUID]*queueRow),
+		schedules:            make(map[ksuid.KSUID]map[int]api.DaySchedule),
+		scheduleOverrides:    make(map[ksuid.KSUID]map[string]*api.ScheduleOverride),
+		entries:              make(map[ksuid.KSUID]*api.QueueEntry),
+		announcements:        make(map[ksuid.KSUID]*api.Announcement),
+		messages:             make(map[ksuid.KSUID]*api.Message),
+		roster:               make(map[ksuid.KSUID]map[string]bool),
+		groups:               make(map[ksuid.KSUID]map[string]ksuid.KSUID),
+		appointmentSchedules: make(map[ksuid.KSUID]map[int]*api.AppointmentSchedule),
+		appointments:         make(map[ksuid.KSUID]*api.AppointmentSlot),
+		apiTokens:            make(map[ksuid.KSUID]*apiTokenRow),
+		userSessions:         make(map[ksuid.KSUID]*api.UserSession),
+	}
+}
+
+// clone deep-copies the state. Rows are copied by value; the pointer
+// fields inside them (e.g. the optional strings on appointments) are
+// shared, which is fine since they're only ever replaced, never mutated.
+func (st *state) clone() *state {
+	n := newState()
+	for k, v := range st.siteAdmins {
+		n.siteAdmins[k] = v
+	}
+	for k, v := range st.courses {
+		c := *v
+		n.courses[k] = &c
+	}
+	for k, v := range st.courseAdmins {
+		roles := make(map[string]api.CourseRole, len(v))
+		for email, role := range v {
+			roles[email] = role
+		}
+		n.courseAdmins[k] = roles
+	}
+	for k, v := range st.allowedEmails {
+		n.allowedEmails[k] = copySet(v)
+	}
+	for k, v := range st.queues {
+		q := *v
+		n.queues[k] = &q
+	}
+	for k, v := range st.schedules {
+		days := make(map[int]api.DaySchedule, len(v))
+		for day, schedule := range v {
+			days[day] = copySchedule(schedule)
+		}
+		n.schedules[k] = days
+	}
+	for k, v := range st.scheduleOverrides {
+		dates := make(map[string]*api.ScheduleOverride, len(v))
+		for date, override := range v {
+			o := *override
+			o.Intervals = copySchedule(o.Intervals)
+			dates[date] = &o
+		}
+		n.scheduleOverrides[k] = dates
+	}
+	for k, v := range st.entries {
+		e := *v
+		n.entries[k] = &e
+	}
+	for k, v := range st.announcements {
+		a := *v
+		n.announcements[k] = &a
+	}
+	for k, v := range st.messages {
+		m := *v
+		n.messages[k] = &m
+	}
+	for k, v := range st.roster {
+		n.roster[k] = copySet(v)
+	}
+	for k, v := range st.groups {
+		g := make(map[string]ksuid.KSUID, len(v))
+		for email, group := range v {
+			g[email] = group
+		}
+		n.groups[k] = g
+	}
+	for k, v := range st.appointmentSchedules {
+		days := make(map[int]*api.AppointmentSchedule, len(v))
+		for day, schedule := range v {
+			s := *schedule
+			days[day] = &s
+		}
+		n.appointmentSchedules[k] = days
+	}
+	for k, v := range st.appointments {
+		a := *v
+		n.appointments[k] = &a
+	}
+	for k, v := range st.apiTokens {
+		t := *v
+		n.apiTokens[k] = &t
+	}
+	for k, v := range st.userSessions {
+		us := *v
+		n.userSessions[k] = &us
+	}
+	n.auditLog = append(n.auditLog, st.auditLog...)
+	return n
+}
+
+func copySet(m map[string]bool) map[string]bool {
+	n := make(map[string]bool, len(m))
+	for k, v := range m {
+		n[k] = v
+	}
+	return n
+}
+
+func copySchedule(d api.DaySchedule) api.DaySchedule {
+	n := make(api.DaySchedule, len(d))
+	copy(n, d)
+	return n
+}
+
+// Store is an in-memory queue store. Transactions are serialized: a
+// request holds the store for as long as its transaction is open, which
+// is plenty for tests and a single developer clicking around.
+type Store struct {
+	lock sync.Mutex
+	data *state
+}
+
+func New() *Store {
+	return &Store{data: newState()}
+}
+
+type tx struct {
+	s    *Store
+	data *state
+	done bool
+}
+
+func (t *tx) Commit() error {
+	if t.done {
+		return sql.ErrTxDone
+	}
+	t.done = true
+	t.s.data = t.data
+	t.s.lock.Unlock()
+	return nil
+}
+
+func (t *tx) Rollback() error {
+	if t.done {
+		return sql.ErrTxDone
+	}
+	t.done = true
+	t.s.lock.Unlock()
+	return nil
+}
+
+func (s *Store) BeginTx() (api.Tx, error) {
+	s.lock.Lock()
+	return &tx{s: s, data: s.data.clone()}, nil
+}
+
+// Just like the db package, every method pulls the request's
+// transaction out of the context and works on its copy of the data.
+func getTransaction(ctx context.Context) *state {
+	return ctx.Value(api.TransactionContextKey).(*tx).data
+}
+
+// locked runs f against the committed state outside of any request,
+// for seeding data and for callers (like metrics) that don't have one.
+func (s *Store) locked(f func(st *state)) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	f(s.data)
+}
+
+// AddSiteAdmin grants site admin to email. There's no endpoint for this
+// in the API either; it's the equivalent of the INSERT in the README.
+func (s *Store) AddSiteAdmin(email string) {
+	s.locked(func(st *state) {
+		st.siteAdmins[email] = true
+	})
+}
+
+func (s *Store) SiteAdmin(ctx context.Context, email string) (bool, error) {
+	st := getTransaction(ctx)
+	return st.siteAdmins[email], nil
+}
+
+// uniqueViolation builds the same error Postgres would return for a
+// violated unique constraint, since some handlers check for it.
+func uniqueViolation(constraint string) error {
+	return &pq.Error{
+		Code:       "23505",
+		Message:    `duplicate key value violates unique constraint "` + constraint + `"`,
+		Constraint: constraint,
+	}
+}
+
+func sortByID(ids []ksuid.KSUID) {
+	sort.Slice(ids, func(i, j int) bool {
+		return ksuid.Compare(ids[i], ids[j]) < 0
+	})
+}
@@ -0,0 +1,102 @@
+package memstore
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/CarsonHoffman/office-hours-queue/server/api"
+	"github.com/segmentio/ksuid"
+)
+
+// activeUserSession returns the session with id, if it hasn't expired.
+func (st *state) activeUserSession(id ksuid.KSUID) (*api.UserSession, bool) {
+	us, ok := st.userSessions[id]
+	if !ok || !us.ExpiresAt.After(time.Now()) {
+		return nil, false
+	}
+	return us, true
+}
+
+func (s *Store) UseUserSession(ctx context.Context, id ksuid.KSUID) (*api.UserSession, error) {
+	st := getTransaction(ctx)
+	us, ok := st.activeUserSession(id)
+	if !ok {
+		return &api.UserSession{}, sql.ErrNoRows
+	}
+	if time.Since(us.LastSeenAt) > api.LastSeenResolution {
+		us.LastSeenAt = time.Now()
+	}
+	session := *us
+	return &session, nil
+}
+
+func (s *Store) GetUserSession(ctx context.Context, id ksuid.KSUID) (*api.UserSession, error) {
+	st := getTransaction(ctx)
+	us, ok := st.activeUserSession(id)
+	if !ok {
+		return &api.UserSession{}, sql.ErrNoRows
+	}
+	session := *us
+	return &session, nil
+}
+
+func (s *Store) GetUserSessions(ctx context.Context, email string) ([]*api.UserSession, error) {
+	st := getTransaction(ctx)
+	sessions := make([]*api.UserSession, 0)
+	for id, us := range st.userSessions {
+		if _, ok := st.activeUserSession(id); ok && us.Email == email {
+			session := *us
+			sessions = append(sessions, &session)
+		}
+	}
+
+	// ORDER BY last_seen_at DESC
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt)
+	})
+	return sessions, nil
+}
+
+func (s *Store) AddUserSession(ctx context.Context, session *api.UserSession) (*api.UserSession, error) {
+	st := getTransaction(ctx)
+	for id, us := range st.userSessions {
+		if _, ok := st.activeUserSession(id); !ok && us.Email == session.Email {
+			delete(st.userSessions, id)
+		}
+	}
+
+	us := &api.UserSession{
+		ID:         ksuid.New(),
+		Email:      session.Email,
+		UserAgent:  session.UserAgent,
+		CreatedAt:  session.CreatedAt,
+		LastSeenAt: session.CreatedAt,
+		ExpiresAt:  session.ExpiresAt,
+	}
+	st.userSessions[us.ID] = us
+
+	newSession := *us
+	return &newSession, nil
+}
+
+func (s *Store) RemoveUserSession(ctx context.Context, id ksuid.KSUID) error {
+	st := getTransaction(ctx)
+	delete(st.userSessions, id)
+	return nil
+}
+
+func (s *Store) RemoveUserSessions(ctx context.Context, email string) (int, error) {
+	st := getTransaction(ctx)
+	n := 0
+	for id, us := range st.userSessions {
+		if us.Email == email {
+			if _, ok := st.activeUserSession(id); ok {
+				n++
+			}
+			delete(st.userSessions, id)
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,107 @@
+package memstore
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/CarsonHoffman/office-hours-queue/server/api"
+	"github.com/segmentio/ksuid"
+)
+
+type apiTokenRow struct {
+	api.APIToken
+	hash string
+}
+
+// findAPITokens returns the tokens matching f, ordered by ID.
+func (st *state) findAPITokens(f func(*apiTokenRow) bool) []*api.APIToken {
+	var ids []ksuid.KSUID
+	for id, t := range st.apiTokens {
+		if f(t) {
+			ids = append(ids, id)
+		}
+	}
+	sortByID(ids)
+
+	tokens := make([]*api.APIToken, 0, len(ids))
+	for _, id := range ids {
+		t := st.apiTokens[id].APIToken
+		tokens = append(tokens, &t)
+	}
+	return tokens
+}
+
+func (s *Store) UseAPIToken(ctx context.Context, hash string) (*api.APIToken, error) {
+	st := getTransaction(ctx)
+	for _, t := range st.apiTokens {
+		if t.hash == hash {
+			if t.LastUsedAt == nil || time.Since(*t.LastUsedAt) > api.LastSeenResolution {
+				now := time.Now()
+				t.LastUsedAt = &now
+			}
+			token := t.APIToken
+			return &token, nil
+		}
+	}
+	return &api.APIToken{}, sql.ErrNoRows
+}
+
+func (s *Store) GetAPIToken(ctx context.Context, id ksuid.KSUID) (*api.APIToken, error) {
+	st := getTransaction(ctx)
+	t, ok := st.apiTokens[id]
+	if !ok {
+		return &api.APIToken{}, sql.ErrNoRows
+	}
+	token := t.APIToken
+	return &token, nil
+}
+
+func (s *Store) GetAPITokens(ctx context.Context, email string) ([]*api.APIToken, error) {
+	st := getTransaction(ctx)
+	return st.findAPITokens(func(t *apiTokenRow) bool {
+		return t.Email == email
+	}), nil
+}
+
+func (s *Store) GetCourseAPITokens(ctx context.Context, course ksuid.KSUID) ([]*api.APIToken, error) {
+	st := getTransaction(ctx)
+	return st.findAPITokens(func(t *apiTokenRow) bool {
+		return t.Course != nil && *t.Course == course
+	}), nil
+}
+
+func (s *Store) AddAPIToken(ctx context.Context, token *api.APIToken, hash string) (*api.APIToken, error) {
+	st := getTransaction(ctx)
+	for _, t := range st.apiTokens {
+		if t.hash == hash {
+			return nil, uniqueViolation("api_tokens_token_hash_key")
+		}
+	}
+
+	t := &apiTokenRow{APIToken: *token, hash: hash}
+	t.ID = ksuid.New()
+	t.LastUsedAt = nil
+	st.apiTokens[t.ID] = t
+
+	newToken := t.APIToken
+	return &newToken, nil
+}
+
+func (s *Store) RemoveAPIToken(ctx context.Context, id ksuid.KSUID) error {
+	st := getTransaction(ctx)
+	delete(st.apiTokens, id)
+	return nil
+}
+
+func (s *Store) RemoveAPITokens(ctx context.Context, email string) (int, error) {
+	st := getTransaction(ctx)
+	n := 0
+	for id, t := range st.apiTokens {
+		if t.Email == email {
+			delete(st.apiTokens, id)
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/CarsonHoffman/office-hours-queue/server/db"
+	"go.uber.org/zap"
+)
+
+// migrateCommand handles `main migrate status` and `main migrate up`,
+// for looking at or applying schema migrations without starting the
+// server (e.g. when QUEUE_DB_AUTO_MIGRATE=false).
+func migrateCommand(l *zap.SugaredLogger, args []string) {
+	if len(args) != 1 || (args[0] != "status" && args[0] != "up") {
+		fmt.Fprintln(os.Stderr, "usage: main migrate status|up")
+		os.Exit(2)
+	}
+
+	s, err := db.Connect(dbConfig(l))
+	if err != nil {
+		l.Fatalw("failed to connect to database", "err", err)
+	}
+
+	ctx := context.Background()
+	switch args[0] {
+	case "status":
+		migrations, err := s.Migrations(ctx)
+		if err != nil {
+			l.Fatalw("failed to get migration status", "err", err)
+		}
+		for _, m := range migrations {
+			applied := "pending"
+			if m.AppliedAt != nil {
+				applied = m.AppliedAt.Format("2006-01-02 15:04:05 MST")
+			}
+			fmt.Printf("%04d_%s\t%s\n", m.Version, m.Name, applied)
+		}
+	case "up":
+		applied, err := s.Migrate(ctx)
+		for _, m := range applied {
+			fmt.Printf("applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			l.Fatalw("failed to migrate database", "err", err)
+		}
+		if len(applied) == 0 {
+			fmt.Println("database is up to date")
+		}
+	}
+}